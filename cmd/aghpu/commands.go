@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/ashep/aghpu/httpclient"
+	"github.com/ashep/aghpu/util"
+)
+
+// runFetch performs a request and prints the response body
+func runFetch(ctx context.Context, e *env, args []string) error {
+	method := e.fs.String("X", "", "request `method`, GET by default or POST if data is given")
+	data := e.fs.String("d", "", "request body; @file reads it from the file")
+	include := e.fs.Bool("i", false, "print response status and headers")
+	out := e.fs.String("o", "", "write response body to `file` instead of stdout")
+
+	args, err := e.parse(args, 1)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	if *data != "" {
+		if (*data)[0] == '@' {
+			if body, err = ioutil.ReadFile((*data)[1:]); err != nil {
+				return err
+			}
+		} else {
+			body = []byte(*data)
+		}
+	}
+
+	if *method == "" {
+		*method = http.MethodGet
+		if body != nil {
+			*method = http.MethodPost
+		}
+	}
+
+	cli, err := e.newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := e.context(ctx)
+	defer cancel()
+
+	rsp, rspBody, err := cli.DoRequest(ctx, *method, args[0], http.Header(e.opts.header), body)
+	if err != nil {
+		return err
+	}
+
+	return e.writeResponse(rsp, rspBody, *include, *out)
+}
+
+// runGetFile downloads a file
+func runGetFile(ctx context.Context, e *env, args []string) error {
+	args, err := e.parse(args, 2)
+	if err != nil {
+		return err
+	}
+
+	cli, err := e.newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := e.context(ctx)
+	defer cancel()
+
+	ext, err := cli.GetFile(ctx, args[0], nil, http.Header(e.opts.header), args[1])
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(e.stdout, args[1]+ext)
+
+	return err
+}
+
+// queryMatch is a selector match printed in JSON format
+type queryMatch struct {
+	Text  string            `json:"text"`
+	HTML  string            `json:"html"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+// runQuery runs a CSS selector against a page and prints matches
+func runQuery(ctx context.Context, e *env, args []string) error {
+	attr := e.fs.String("attr", "", "print values of the `attribute` instead of text")
+	html := e.fs.Bool("html", false, "print outer HTML instead of text")
+	asJSON := e.fs.Bool("json", false, "print matches as a JSON array")
+
+	args, err := e.parse(args, 2)
+	if err != nil {
+		return err
+	}
+
+	cli, err := e.newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := e.context(ctx)
+	defer cancel()
+
+	doc, err := cli.GetQueryDoc(ctx, args[0], nil, http.Header(e.opts.header))
+	if err != nil {
+		return err
+	}
+
+	sel := doc.Find(args[1])
+
+	if *asJSON {
+		matches := make([]queryMatch, 0, sel.Length())
+		var hErr error
+		sel.Each(func(_ int, s *goquery.Selection) {
+			m := queryMatch{Text: util.TidyHTMLText(s.Text())}
+			if h, err := goquery.OuterHtml(s); err != nil {
+				hErr = err
+			} else {
+				m.HTML = h
+			}
+			for _, a := range s.Nodes[0].Attr {
+				if m.Attrs == nil {
+					m.Attrs = make(map[string]string)
+				}
+				m.Attrs[a.Key] = a.Val
+			}
+			matches = append(matches, m)
+		})
+		if hErr != nil {
+			return hErr
+		}
+
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+
+		return enc.Encode(matches)
+	}
+
+	var wErr error
+	sel.EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		var v string
+		switch {
+		case *attr != "":
+			var ok bool
+			if v, ok = s.Attr(*attr); !ok {
+				return true
+			}
+		case *html:
+			if v, wErr = goquery.OuterHtml(s); wErr != nil {
+				return false
+			}
+		default:
+			v = util.TidyHTMLText(s.Text())
+		}
+
+		_, wErr = fmt.Fprintln(e.stdout, v)
+		return wErr == nil
+	})
+
+	return wErr
+}
+
+// runReplay performs a dumped request again and prints the response body
+func runReplay(ctx context.Context, e *env, args []string) error {
+	include := e.fs.Bool("i", false, "print response status and headers")
+	out := e.fs.String("o", "", "write response body to `file` instead of stdout")
+
+	args, err := e.parse(args, 1)
+	if err != nil {
+		return err
+	}
+
+	d, err := httpclient.ReadDumpFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	cli, err := e.newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := e.context(ctx)
+	defer cancel()
+
+	// Headers given on the command line override dumped ones
+	for k, vs := range e.opts.header {
+		if d.ReqHeader == nil {
+			d.ReqHeader = http.Header{}
+		}
+		d.ReqHeader[k] = vs
+	}
+
+	rsp, rspBody, err := cli.ReplayDump(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	return e.writeResponse(rsp, rspBody, *include, *out)
+}
+
+// runIP prints external IP address information
+func runIP(ctx context.Context, e *env, args []string) error {
+	endpoint := e.fs.String("endpoint", httpclient.DefaultIPInfoURL,
+		"base `URL` of an ifconfig.io compatible service serving /ip and /country_code")
+
+	if _, err := e.parse(args, 0); err != nil {
+		return err
+	}
+
+	cli, err := e.newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := e.context(ctx)
+	defer cancel()
+
+	info, err := cli.GetExtIPAddrInfoFrom(ctx, *endpoint)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(e.stdout, info)
+
+	return err
+}
+
+// writeResponse prints a response
+func (e *env) writeResponse(rsp *http.Response, body []byte, include bool, out string) error {
+	if include {
+		if err := writeResponseHead(e.stdout, rsp); err != nil {
+			return err
+		}
+	}
+
+	if out != "" {
+		return ioutil.WriteFile(out, body, 0644)
+	}
+
+	_, err := e.stdout.Write(body)
+
+	return err
+}
+
+// writeResponseHead prints response status line and headers
+func writeResponseHead(w io.Writer, rsp *http.Response) error {
+	if _, err := fmt.Fprintf(w, "%s %s\n", rsp.Proto, rsp.Status); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(rsp.Header))
+	for k := range rsp.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range rsp.Header[k] {
+			if _, err := fmt.Fprintf(w, "%s: %s\n", k, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintln(w)
+
+	return err
+}
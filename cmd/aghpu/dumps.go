@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ashep/aghpu/dumps"
+	"github.com/ashep/aghpu/httpclient"
+)
+
+const dumpsArgs = "list [flags] DIR | show [flags] FILE | diff [flags] FILE FILE | diff -url URL [flags] SESSION SESSION"
+
+// runDumps runs a dumps subcommand
+func runDumps(_ context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		return runDumpsList(e, args[1:])
+	case "show":
+		return runDumpsShow(e, args[1:])
+	case "diff":
+		return runDumpsDiff(e, args[1:])
+	default:
+		return errUsage
+	}
+}
+
+// runDumpsList lists dumped transactions of a session or all the sessions of a dump directory
+func runDumpsList(e *env, args []string) error {
+	status := e.fs.String("status", "", "status `codes`, classes and ranges, e.g. 200,4xx,500-503,error")
+	host := e.fs.String("host", "", "`host` or its parent domain")
+	method := e.fs.String("method", "", "request `method`")
+	since := e.fs.String("since", "", "list transactions since `time`: RFC 3339 time, date or duration ago")
+	until := e.fs.String("until", "", "list transactions until `time`: RFC 3339 time, date or duration ago")
+	failed := e.fs.Bool("failed", false, "list failed transactions only")
+
+	args, err := e.parse(args, 1)
+	if err != nil {
+		return err
+	}
+
+	f := dumps.Filter{Host: *host, Method: *method, Failed: *failed}
+	if f.Status, err = dumps.ParseStatusRanges(*status); err != nil {
+		return err
+	}
+	if f.Since, err = parseTime(*since); err != nil {
+		return err
+	}
+	if f.Until, err = parseTime(*until); err != nil {
+		return err
+	}
+
+	sessions, err := dumps.Open(args[0])
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	for _, s := range sessions {
+		for _, name := range s.Invalid {
+			_, _ = fmt.Fprintf(e.stderr, "warning: skipping invalid dump file %s/%s\n", s.Name, name)
+		}
+		for _, en := range s.Filter(f) {
+			status := en.Status
+			if en.Err != "" {
+				status = "ERROR: " + en.Err
+			} else if status == "" {
+				status = "-"
+			}
+			file := en.File
+			if en.Path == "" {
+				file += " (removed)"
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s/%s\t%s\t%s\t%s\n",
+				en.Time.Format("2006-01-02 15:04:05"), en.Session, file, en.Method, en.URL, status)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// parseTime parses an RFC 3339 time, a date or a duration ago
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time: %q", s)
+}
+
+// runDumpsShow prints a dump having JSON and HTML bodies indented
+func runDumpsShow(e *env, args []string) error {
+	raw := e.fs.Bool("raw", false, "print bodies as is")
+
+	args, err := e.parse(args, 1)
+	if err != nil {
+		return err
+	}
+
+	d, err := httpclient.ReadDumpFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	b := dumps.Format(d)
+	if *raw {
+		b = httpclient.FormatDump(d)
+	}
+	_, err = fmt.Fprintf(e.stdout, "%s\n", b)
+
+	return err
+}
+
+// runDumpsDiff compares two dumps or the last transactions of a URL in two sessions
+func runDumpsDiff(e *env, args []string) error {
+	u := e.fs.String("url", "", "compare the last transactions of the `URL` in two session directories")
+	method := e.fs.String("method", "", "request `method` of transactions compared with -url")
+	ctxLines := e.fs.Int("context", 3, "number of unchanged `lines` around changes, negative means all")
+	ignore := e.fs.String("ignore", strings.Join(dumps.DefaultIgnoredHeaders, ","), "comma separated `headers` not to compare")
+
+	args, err := e.parse(args, 2)
+	if err != nil {
+		return err
+	}
+
+	var a, b *httpclient.Dump
+	if *u != "" {
+		if a, err = loadLast(args[0], *method, *u); err != nil {
+			return err
+		}
+		if b, err = loadLast(args[1], *method, *u); err != nil {
+			return err
+		}
+	} else {
+		if a, err = httpclient.ReadDumpFile(args[0]); err != nil {
+			return err
+		}
+		if b, err = httpclient.ReadDumpFile(args[1]); err != nil {
+			return err
+		}
+	}
+
+	opts := dumps.DiffOptions{Context: *ctxLines}
+	for _, h := range strings.Split(*ignore, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			opts.IgnoreHeaders = append(opts.IgnoreHeaders, h)
+		}
+	}
+
+	diff := dumps.Diff(a, b, opts)
+	if diff == "" {
+		diff = "no changes\n"
+	}
+	_, err = fmt.Fprint(e.stdout, diff)
+
+	return err
+}
+
+// loadLast loads the last dump of a URL in a session directory
+func loadLast(dir, method, u string) (*httpclient.Dump, error) {
+	s, err := dumps.OpenSession(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	en, ok := s.Last(method, u)
+	if !ok {
+		return nil, fmt.Errorf("no transactions of %s in session %s", u, s.Name)
+	}
+
+	return en.Load()
+}
@@ -0,0 +1,268 @@
+// Command aghpu exposes the HTTP client features on the command line.
+//
+// Usage:
+//
+//	aghpu <command> [flags] [arguments]
+//
+// Commands:
+//
+//	fetch     perform a request and print the response body
+//	get-file  download a file
+//	query     run a CSS selector against a page
+//	replay    perform a dumped request again
+//	ip        print external IP address information
+//	dumps     list, show and compare transaction dumps
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ashep/aghpu/httpclient"
+	"github.com/ashep/aghpu/logger"
+)
+
+// Exit codes
+const (
+	exitOK    = 0
+	exitErr   = 1
+	exitUsage = 2
+)
+
+// command is a subcommand
+type command struct {
+	name   string
+	args   string
+	descr  string
+	client bool // command makes requests and accepts client options
+	run    func(ctx context.Context, e *env, args []string) error
+}
+
+// env is a command environment
+type env struct {
+	stdout io.Writer
+	stderr io.Writer
+	fs     *flag.FlagSet
+	opts   options
+}
+
+// errUsage is returned by commands when they are used incorrectly
+var errUsage = errors.New("invalid usage")
+
+var commands = []command{
+	{"fetch", "[flags] URL", "perform a request and print the response body", true, runFetch},
+	{"get-file", "[flags] URL PATH", "download a file; extension is added according to content type", true, runGetFile},
+	{"query", "[flags] URL SELECTOR", "run a CSS selector against a page and print matches", true, runQuery},
+	{"replay", "[flags] DUMP_FILE", "perform a dumped request again and print the response body", true, runReplay},
+	{"ip", "[flags]", "print external IP address information", true, runIP},
+	{"dumps", dumpsArgs, "list, show and compare transaction dumps", false, runDumps},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the program and returns an exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		usage(stderr)
+		return exitUsage
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		_, _ = fmt.Fprintf(stderr, "unknown command: %s\n\n", args[0])
+		usage(stderr)
+		return exitUsage
+	}
+
+	e := &env{
+		stdout: stdout,
+		stderr: stderr,
+		fs:     flag.NewFlagSet(cmd.name, flag.ContinueOnError),
+	}
+	e.fs.SetOutput(stderr)
+	e.fs.Usage = func() {
+		_, _ = fmt.Fprintf(stderr, "usage: aghpu %s %s\n\n%s\n\nflags:\n", cmd.name, cmd.args, cmd.descr)
+		e.fs.PrintDefaults()
+	}
+	if cmd.client {
+		e.opts.register(e.fs)
+	}
+
+	// Commands register their own flags and parse arguments themselves
+	ctx := context.Background()
+	err := cmd.run(ctx, e, args[1:])
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitUsage
+	case errors.Is(err, errUsage):
+		e.fs.Usage()
+		return exitUsage
+	default:
+		_, _ = fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitErr
+	}
+}
+
+// usage prints the program usage
+func usage(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "usage: aghpu <command> [flags] [arguments]\n\ncommands:\n")
+	for _, c := range commands {
+		_, _ = fmt.Fprintf(w, "  %-10s %s\n", c.name, c.descr)
+	}
+	_, _ = fmt.Fprintf(w, "\nrun 'aghpu <command> -h' for command's flags\n")
+}
+
+// parse parses command's flags and checks number of positional arguments
+func (e *env) parse(args []string, nArgs int) ([]string, error) {
+	if err := e.fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if e.fs.NArg() != nArgs {
+		return nil, errUsage
+	}
+
+	return e.fs.Args(), nil
+}
+
+// headerFlag is a repeatable header flag
+type headerFlag http.Header
+
+// String implements flag.Value
+func (h headerFlag) String() string {
+	var r []string
+	for k, vs := range h {
+		for _, v := range vs {
+			r = append(r, k+": "+v)
+		}
+	}
+
+	return strings.Join(r, ", ")
+}
+
+// Set implements flag.Value
+func (h headerFlag) Set(s string) error {
+	i := strings.Index(s, ":")
+	if i <= 0 {
+		return fmt.Errorf("invalid header %q, must be in 'Name: value' format", s)
+	}
+	http.Header(h).Add(strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]))
+
+	return nil
+}
+
+// options are client options common for the commands making requests
+type options struct {
+	header     headerFlag
+	proxy      string
+	ua         string
+	profile    string
+	dumpDir    string
+	retries    int
+	timeout    time.Duration
+	insecure   bool
+	allowRetry bool
+	verbose    bool
+	quiet      bool
+}
+
+// register registers flags of the options
+func (o *options) register(fs *flag.FlagSet) {
+	o.header = headerFlag{}
+	fs.Var(o.header, "H", "request `header` in 'Name: value' format, may be repeated")
+	fs.StringVar(&o.proxy, "proxy", "", "proxy `URL`")
+	fs.StringVar(&o.ua, "ua", "", "user agent, overrides one of the browser profile")
+	fs.StringVar(&o.profile, "profile", httpclient.ProfileChrome.Name, "browser `profile`: "+profileNames())
+	fs.StringVar(&o.dumpDir, "dump", "", "dump transactions into a session subdirectory of `dir`")
+	fs.IntVar(&o.retries, "retries", 3, "maximum number of request attempts")
+	fs.DurationVar(&o.timeout, "timeout", 0, "overall command timeout, zero means no timeout")
+	fs.BoolVar(&o.insecure, "k", false, "skip TLS certificate verification")
+	fs.BoolVar(&o.allowRetry, "allow-retry", false, "retry failed non-idempotent requests, like POST, up to -retries attempts")
+	fs.BoolVar(&o.verbose, "v", false, "verbose output")
+	fs.BoolVar(&o.quiet, "q", false, "print nothing but results and errors")
+}
+
+// profileNames returns names of predefined browser profiles
+func profileNames() string {
+	var r []string
+	for _, p := range httpclient.Profiles {
+		r = append(r, p.Name)
+	}
+
+	return strings.Join(r, ", ")
+}
+
+// newClient creates a client according to the options
+func (e *env) newClient() (*httpclient.Cli, error) {
+	lv := logger.LvInfo
+	if e.opts.verbose {
+		lv = logger.LvDebug
+	} else if e.opts.quiet {
+		lv = logger.LvDisabled
+	}
+
+	log.SetOutput(e.stderr)
+	log.SetFlags(0)
+	l, err := logger.New("aghpu", lv, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	cli, err := httpclient.New("aghpu", e.opts.dumpDir, e.opts.ua, e.opts.proxy, e.opts.dumpDir != "", l)
+	if err != nil {
+		return nil, err
+	}
+
+	prof, ok := httpclient.ProfileByName(e.opts.profile)
+	if !ok {
+		return nil, fmt.Errorf("unknown browser profile: %s", e.opts.profile)
+	}
+	cli.SetProfile(prof)
+
+	if e.opts.retries < 1 {
+		return nil, fmt.Errorf("invalid number of retries: %d", e.opts.retries)
+	}
+	cli.SetMaxRetries(e.opts.retries)
+
+	if e.opts.insecure {
+		if err := cli.SetTLS(httpclient.TLSOptions{Insecure: true}); err != nil {
+			return nil, err
+		}
+		// The client warns through its logger which is disabled in quiet mode
+		if lv == logger.LvDisabled {
+			_, _ = fmt.Fprintln(e.stderr, "warning: TLS certificate verification is disabled")
+		}
+	}
+
+	return cli, nil
+}
+
+// context returns a command context according to the options
+func (e *env) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if e.opts.allowRetry {
+		ctx = httpclient.AllowRetry(ctx)
+	}
+
+	if e.opts.timeout > 0 {
+		return context.WithTimeout(ctx, e.opts.timeout)
+	}
+
+	return context.WithCancel(ctx)
+}
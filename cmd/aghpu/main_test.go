@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// runCmd runs the program and returns its exit code and output
+func runCmd(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRunUsage(t *testing.T) {
+	if code, _, stderr := runCmd(); code != exitUsage || !strings.Contains(stderr, "commands:") {
+		t.Errorf("got %d, %q", code, stderr)
+	}
+	if code, _, stderr := runCmd("nope"); code != exitUsage || !strings.Contains(stderr, "unknown command: nope") {
+		t.Errorf("got %d, %q", code, stderr)
+	}
+	if code, _, _ := runCmd("fetch"); code != exitUsage {
+		t.Errorf("got %d", code)
+	}
+}
+
+func TestRunFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Test", "1")
+		_, _ = w.Write([]byte(r.Method + " " + r.Header.Get("X-Custom") + " " + string(b)))
+	}))
+	defer srv.Close()
+
+	code, stdout, stderr := runCmd("fetch", "-q", "-H", "X-Custom: v", srv.URL)
+	if code != exitOK || stdout != "GET v " {
+		t.Errorf("got %d, %q, %q", code, stdout, stderr)
+	}
+
+	code, stdout, stderr = runCmd("fetch", "-q", "-i", "-d", "data", srv.URL)
+	if code != exitOK || !strings.HasPrefix(stdout, "HTTP/1.1 200 OK\n") || !strings.Contains(stdout, "X-Test: 1\n") ||
+		!strings.HasSuffix(stdout, "\n\nPOST  data") {
+		t.Errorf("got %d, %q, %q", code, stdout, stderr)
+	}
+}
+
+func TestRunFetchRetryPost(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	code, _, stderr := runCmd("fetch", "-q", "-X", "POST", "-retries", "2", srv.URL)
+	if code != exitErr || !strings.Contains(stderr, "503") {
+		t.Errorf("got %d, %q", code, stderr)
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("got %d requests without -allow-retry, want 1", n)
+	}
+
+	atomic.StoreInt32(&hits, 0)
+	code, stdout, stderr := runCmd("fetch", "-q", "-X", "POST", "-retries", "2", "-allow-retry", srv.URL)
+	if code != exitOK || stdout != "ok" {
+		t.Errorf("got %d, %q, %q", code, stdout, stderr)
+	}
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+}
+
+func TestRunInsecureWarning(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	for _, quiet := range []bool{false, true} {
+		args := []string{"fetch", "-k", srv.URL}
+		if quiet {
+			args = []string{"fetch", "-k", "-q", srv.URL}
+		}
+		code, _, stderr := runCmd(args...)
+		if code != exitOK || !strings.Contains(strings.ToLower(stderr), "verification is disabled") {
+			t.Errorf("quiet %v: got %d, %q", quiet, code, stderr)
+		}
+	}
+}
+
+func TestRunIP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ip":
+			_, _ = w.Write([]byte("192.0.2.1\n"))
+		case "/country_code":
+			_, _ = w.Write([]byte("UA\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	code, stdout, stderr := runCmd("ip", "-q", "-endpoint", srv.URL+"/")
+	if code != exitOK || stdout != "address: 192.0.2.1, region: UA\n" {
+		t.Errorf("got %d, %q, %q", code, stdout, stderr)
+	}
+}
+
+func TestRunQuery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html><body><a href="/a">
+  First  link
+</a><a href="/b">Second</a></body></html>`))
+	}))
+	defer srv.Close()
+
+	code, stdout, stderr := runCmd("query", "-q", srv.URL, "a")
+	if code != exitOK || stdout != "First link\nSecond\n" {
+		t.Errorf("got %d, %q, %q", code, stdout, stderr)
+	}
+
+	code, stdout, stderr = runCmd("query", "-q", "-attr", "href", srv.URL, "a")
+	if code != exitOK || stdout != "/a\n/b\n" {
+		t.Errorf("got %d, %q, %q", code, stdout, stderr)
+	}
+}
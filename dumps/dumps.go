@@ -0,0 +1,347 @@
+// Package dumps browses, filters and compares HTTP transaction dumps written by httpclient.DirSink.
+package dumps
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashep/aghpu/httpclient"
+)
+
+// Entry is a dumped transaction of a session
+type Entry struct {
+	httpclient.DumpIndexEntry
+	Session string // session name
+	Path    string // dump file path, empty if the file has been removed
+}
+
+// Host returns host of entry's URL
+func (e Entry) Host() string {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
+
+// Failed reports whether the transaction failed, like httpclient.Dump.Failed does
+func (e Entry) Failed() bool {
+	return httpclient.TransactionFailed(e.StatusCode, e.Err)
+}
+
+// Load loads entry's dump
+func (e Entry) Load() (*httpclient.Dump, error) {
+	if e.Path == "" {
+		return nil, fmt.Errorf("dump file %s of session %s has been removed", e.File, e.Session)
+	}
+
+	d, err := httpclient.ReadDumpFile(e.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fill fields which are not kept in dump files
+	d.ReqNum = e.ReqNum
+	d.TryNum = e.TryNum
+	d.Time = e.Time
+	d.Curl = e.Curl
+
+	return d, nil
+}
+
+// Session is a directory with dumps of a client session
+type Session struct {
+	Name    string
+	Dir     string
+	Entries []Entry
+	Invalid []string // dump files which couldn't be parsed while scanning a session without index
+}
+
+// dumpFileRe matches names of dump files
+var dumpFileRe = regexp.MustCompile(`^(\d+)-(\d+)(?:-\d+)?\.txt(?:\.gz)?$`)
+
+// IsSession reports whether a directory contains dumps
+func IsSession(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, httpclient.DumpIndexFile)); err == nil {
+		return true
+	}
+
+	fInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, fi := range fInfos {
+		if !fi.IsDir() && dumpFileRe.MatchString(fi.Name()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Open opens a session directory or all the session subdirectories of a dump directory.
+//
+// Sessions are ordered by name, which is a creation timestamp for sessions created by httpclient.New.
+func Open(dir string) ([]*Session, error) {
+	if IsSession(dir) {
+		s, err := OpenSession(dir)
+		if err != nil {
+			return nil, err
+		}
+		return []*Session{s}, nil
+	}
+
+	fInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var r []*Session
+	for _, fi := range fInfos {
+		sDir := filepath.Join(dir, fi.Name())
+		if !fi.IsDir() || !IsSession(sDir) {
+			continue
+		}
+
+		s, err := OpenSession(sDir)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, s)
+	}
+
+	if len(r) == 0 {
+		return nil, fmt.Errorf("no dump sessions found in %v", dir)
+	}
+
+	return r, nil
+}
+
+// OpenSession opens a session directory.
+//
+// Entries are read from the index file. Directories without index, created by older versions,
+// are scanned and each dump file is parsed.
+func OpenSession(dir string) (*Session, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{Name: filepath.Base(dir), Dir: dir}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, httpclient.DumpIndexFile))
+	switch {
+	case err == nil:
+		err = s.readIndex(b)
+	case os.IsNotExist(err):
+		err = s.scan()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dump session %v: %v", dir, err)
+	}
+
+	sort.SliceStable(s.Entries, func(i, j int) bool {
+		return s.Entries[i].Time.Before(s.Entries[j].Time)
+	})
+
+	return s, nil
+}
+
+// readIndex reads entries from index file content
+func (s *Session) readIndex(b []byte) error {
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(nil, 1024*1024)
+
+	for n := 1; sc.Scan(); n++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+
+		e := Entry{Session: s.Name}
+		if err := json.Unmarshal(sc.Bytes(), &e.DumpIndexEntry); err != nil {
+			return fmt.Errorf("invalid index entry at line %d: %v", n, err)
+		}
+
+		fPath := filepath.Join(s.Dir, e.File)
+		if _, err := os.Stat(fPath); err == nil {
+			e.Path = fPath
+		}
+
+		s.Entries = append(s.Entries, e)
+	}
+
+	return sc.Err()
+}
+
+// scan reads entries from dump files
+func (s *Session) scan() error {
+	fInfos, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range fInfos {
+		m := dumpFileRe.FindStringSubmatch(fi.Name())
+		if fi.IsDir() || m == nil {
+			continue
+		}
+
+		fPath := filepath.Join(s.Dir, fi.Name())
+		d, err := httpclient.ReadDumpFile(fPath)
+		if err != nil {
+			s.Invalid = append(s.Invalid, fi.Name())
+			continue
+		}
+
+		reqNum, _ := strconv.Atoi(m[1])
+		tryNum, _ := strconv.Atoi(m[2])
+
+		s.Entries = append(s.Entries, Entry{
+			DumpIndexEntry: httpclient.DumpIndexEntry{
+				File:       fi.Name(),
+				ReqNum:     int32(reqNum),
+				TryNum:     tryNum,
+				Time:       fi.ModTime(),
+				Method:     d.Method,
+				URL:        d.URL,
+				Status:     d.Status,
+				StatusCode: d.StatusCode,
+				Err:        d.Err,
+				Timing:     d.Timing,
+			},
+			Session: s.Name,
+			Path:    fPath,
+		})
+	}
+
+	return nil
+}
+
+// Filter returns entries matching a filter
+func (s *Session) Filter(f Filter) []Entry {
+	var r []Entry
+	for _, e := range s.Entries {
+		if f.Match(e) {
+			r = append(r, e)
+		}
+	}
+
+	return r
+}
+
+// Last returns the last entry having a method and a URL
+func (s *Session) Last(method, u string) (Entry, bool) {
+	for i := len(s.Entries) - 1; i >= 0; i-- {
+		if e := s.Entries[i]; e.URL == u && (method == "" || e.Method == method) {
+			return e, true
+		}
+	}
+
+	return Entry{}, false
+}
+
+// StatusRange is a range of status codes. Status code 0 stands for transactions without response.
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+// ParseStatusRanges parses a comma separated list of status codes, classes and ranges,
+// e.g. "200,4xx,500-503". "error" stands for transactions without response.
+func ParseStatusRanges(s string) ([]StatusRange, error) {
+	var r []StatusRange
+
+	for _, p := range strings.Split(s, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+
+		switch {
+		case p == "":
+			continue
+		case p == "error":
+			r = append(r, StatusRange{0, 0})
+		case len(p) == 3 && strings.HasSuffix(p, "xx") && p[0] >= '1' && p[0] <= '5':
+			c := int(p[0]-'0') * 100
+			r = append(r, StatusRange{c, c + 99})
+		case strings.Contains(p, "-"):
+			parts := strings.SplitN(p, "-", 2)
+			lo, err1 := strconv.Atoi(parts[0])
+			hi, err2 := strconv.Atoi(parts[1])
+			if err1 != nil || err2 != nil || lo > hi {
+				return nil, fmt.Errorf("invalid status range: %q", p)
+			}
+			r = append(r, StatusRange{lo, hi})
+		default:
+			c, err := strconv.Atoi(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid status: %q", p)
+			}
+			r = append(r, StatusRange{c, c})
+		}
+	}
+
+	return r, nil
+}
+
+// Filter is an entry filter. Zero fields match any entry.
+type Filter struct {
+	Status []StatusRange
+	Host   string // host or its parent domain
+	Method string
+	Since  time.Time
+	Until  time.Time
+	Failed bool // match failed transactions only
+}
+
+// Match reports whether an entry matches the filter
+func (f Filter) Match(e Entry) bool {
+	if len(f.Status) > 0 {
+		ok := false
+		for _, r := range f.Status {
+			// Dumps of older versions have neither status nor error
+			if e.StatusCode >= r.Min && e.StatusCode <= r.Max && (e.StatusCode != 0 || e.Err != "") {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if f.Host != "" {
+		h, fh := strings.ToLower(e.Host()), strings.ToLower(f.Host)
+		if h != fh && !strings.HasSuffix(h, "."+fh) {
+			return false
+		}
+	}
+
+	if f.Method != "" && !strings.EqualFold(e.Method, f.Method) {
+		return false
+	}
+
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+
+	if f.Failed && !e.Failed() {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,154 @@
+package dumps
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashep/aghpu/httpclient"
+)
+
+// legacyDump is a dump in the format of older versions, which have no status line
+const legacyDump = "GET https://example.com/a\n\nUser-Agent: test\n\nEMPTY BODY\n\n---\n\nContent-Type: text/html\n\n<html></html>"
+
+func TestOpenSessionLegacy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dumps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	files := map[string]string{
+		"0001-01.txt": legacyDump,
+		"0002-01.txt": strings.Replace(legacyDump, "/a", "/b", 1),
+		"0003-01.txt": "garbage",
+		"notes.txt":   "not a dump",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !IsSession(dir) {
+		t.Fatal("legacy session is not detected")
+	}
+
+	s, err := OpenSession(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", s.Entries)
+	}
+	if !reflect.DeepEqual(s.Invalid, []string{"0003-01.txt"}) {
+		t.Errorf("unexpected invalid files: %v", s.Invalid)
+	}
+
+	e, ok := s.Last("GET", "https://example.com/b")
+	if !ok {
+		t.Fatal("entry is not found")
+	}
+	if e.ReqNum != 2 || e.TryNum != 1 || e.Failed() {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+
+	d, err := e.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d.RspBody) != "<html></html>" {
+		t.Errorf("unexpected body: %q", d.RspBody)
+	}
+
+	// Legacy entries have no status, so they match neither status nor error filters
+	if n := len(s.Filter(Filter{Status: []StatusRange{{0, 0}}})); n != 0 {
+		t.Errorf("expected no error entries, got %d", n)
+	}
+}
+
+func TestOpenSessionIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dumps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	sink, err := httpclient.NewDirSink(dir, httpclient.DirSinkOptions{Gzip: true, MaxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i, status := range []int{200, 503, 404} {
+		d := &httpclient.Dump{
+			ReqNum:     int32(i + 1),
+			TryNum:     1,
+			Time:       now.Add(time.Duration(i) * time.Second),
+			Method:     "GET",
+			URL:        "https://www.example.com/",
+			Proto:      "HTTP/1.1",
+			Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+			StatusCode: status,
+		}
+		if err := sink.WriteDump(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sessions, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sessions[0]
+	if len(s.Entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(s.Entries))
+	}
+	if s.Entries[0].Path != "" {
+		t.Error("removed dump file has a path")
+	}
+	if _, err := s.Entries[0].Load(); err == nil {
+		t.Error("expected an error loading removed dump")
+	}
+	if _, err := s.Entries[2].Load(); err != nil {
+		t.Error(err)
+	}
+
+	status, err := ParseStatusRanges("4xx,500-503")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Filter(Filter{Status: status, Host: "example.com"})); n != 2 {
+		t.Errorf("expected 2 entries, got %d", n)
+	}
+	if n := len(s.Filter(Filter{Failed: true, Since: now.Add(1500 * time.Millisecond)})); n != 1 {
+		t.Errorf("expected 1 entry, got %d", n)
+	}
+	if n := len(s.Filter(Filter{Host: "ample.com"})); n != 0 {
+		t.Errorf("expected no entries, got %d", n)
+	}
+}
+
+func TestParseStatusRanges(t *testing.T) {
+	r, err := ParseStatusRanges("200, 4xx,500-503,error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []StatusRange{{200, 200}, {400, 499}, {500, 503}, {0, 0}}
+	if !reflect.DeepEqual(r, exp) {
+		t.Errorf("expected %v, got %v", exp, r)
+	}
+
+	for _, s := range []string{"abc", "6xx", "503-500", "1-x"} {
+		if _, err := ParseStatusRanges(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
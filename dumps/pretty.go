@@ -0,0 +1,207 @@
+package dumps
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/ashep/aghpu/httpclient"
+	"github.com/ashep/aghpu/util"
+)
+
+// bodyKind is a kind of body content
+type bodyKind int
+
+const (
+	bodyOther bodyKind = iota
+	bodyJSON
+	bodyHTML
+)
+
+// detectBody detects kind of body content
+func detectBody(h http.Header, body []byte) bodyKind {
+	ct := strings.ToLower(h.Get("Content-Type"))
+	switch {
+	case strings.Contains(ct, "json"):
+		return bodyJSON
+	case strings.Contains(ct, "html"):
+		return bodyHTML
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		return bodyJSON
+	}
+	if strings.HasPrefix(http.DetectContentType(body), "text/html") {
+		return bodyHTML
+	}
+
+	return bodyOther
+}
+
+// PrettyBody returns a JSON or HTML body indented, other bodies are returned as is
+func PrettyBody(h http.Header, body []byte) []byte {
+	switch detectBody(h, body) {
+	case bodyJSON:
+		buf := bytes.NewBuffer(nil)
+		if err := json.Indent(buf, bytes.TrimSpace(body), "", "  "); err == nil {
+			return buf.Bytes()
+		}
+	case bodyHTML:
+		return prettyHTML(body)
+	}
+
+	return body
+}
+
+// rawTextTags are tags which content is kept as is
+var rawTextTags = map[string]bool{"pre": true, "textarea": true, "script": true, "style": true}
+
+// voidTags are tags which have no end tag
+var voidTags = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// prettyHTML puts every tag and text on its own line indented according to nesting
+func prettyHTML(body []byte) []byte {
+	var (
+		buf   bytes.Buffer
+		depth int
+		raw   int
+	)
+
+	writeLine := func(s string) {
+		buf.WriteString(strings.Repeat("  ", depth))
+		buf.WriteString(s)
+		buf.WriteString("\n")
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				return body
+			}
+			break
+		}
+
+		tok := z.Token()
+		switch tt {
+		case html.StartTagToken:
+			writeLine(tok.String())
+			if !voidTags[tok.Data] {
+				depth++
+				if rawTextTags[tok.Data] {
+					raw++
+				}
+			}
+		case html.EndTagToken:
+			if voidTags[tok.Data] {
+				continue
+			}
+			if depth > 0 {
+				depth--
+			}
+			if rawTextTags[tok.Data] && raw > 0 {
+				raw--
+			}
+			writeLine(tok.String())
+		case html.TextToken:
+			if raw > 0 {
+				if s := strings.Trim(tok.Data, "\r\n"); s != "" {
+					writeLine(s)
+				}
+				continue
+			}
+			if s := util.CollapseSpace(tok.String()); s != "" {
+				writeLine(s)
+			}
+		default:
+			writeLine(tok.String())
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// Format formats a dump for reading, having JSON and HTML bodies indented
+func Format(d *httpclient.Dump) []byte {
+	p := *d
+	p.ReqBody = PrettyBody(d.ReqHeader, d.ReqBody)
+	p.RspBody = PrettyBody(d.RspHeader, d.RspBody)
+
+	return httpclient.FormatDump(&p)
+}
+
+// DiffOptions are options of dumps comparison
+type DiffOptions struct {
+	Context       int      // number of unchanged lines around changes, negative means all
+	IgnoreHeaders []string // headers excluded from comparison, e.g. Date
+}
+
+// DefaultIgnoredHeaders are headers which usually differ in every response
+var DefaultIgnoredHeaders = []string{"Date", "Expires", "Last-Modified", "Age", "Set-Cookie", "Content-Length"}
+
+// Diff compares two dumps and returns changes of their request lines, statuses, headers and bodies.
+//
+// Bodies are compared pretty-printed. Empty result means there are no changes.
+func Diff(a, b *httpclient.Dump, opts DiffOptions) string {
+	ignore := make(map[string]bool)
+	for _, h := range opts.IgnoreHeaders {
+		ignore[http.CanonicalHeaderKey(h)] = true
+	}
+
+	var buf strings.Builder
+	section := func(name, x, y string) {
+		if d := util.Diff(x, y); util.DiffChanged(d) {
+			buf.WriteString(fmt.Sprintf("=== %s\n", name))
+			buf.WriteString(util.FormatDiff(d, opts.Context))
+		}
+	}
+
+	section("Request", a.Method+" "+a.URL, b.Method+" "+b.URL)
+	section("Request headers", formatHeader(a.ReqHeader, ignore), formatHeader(b.ReqHeader, ignore))
+	section("Request body", string(PrettyBody(a.ReqHeader, a.ReqBody)), string(PrettyBody(b.ReqHeader, b.ReqBody)))
+	section("Status", statusLine(a), statusLine(b))
+	section("Response headers", formatHeader(a.RspHeader, ignore), formatHeader(b.RspHeader, ignore))
+	section("Response body", string(PrettyBody(a.RspHeader, a.RspBody)), string(PrettyBody(b.RspHeader, b.RspBody)))
+
+	return buf.String()
+}
+
+// statusLine returns dump's status line or error
+func statusLine(d *httpclient.Dump) string {
+	if d.Status == "" {
+		return "ERROR: " + d.Err
+	}
+
+	return d.Proto + " " + d.Status
+}
+
+// formatHeader formats a header as sorted lines skipping ignored names
+func formatHeader(h http.Header, ignore map[string]bool) string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		if !ignore[http.CanonicalHeaderKey(k)] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var buf strings.Builder
+	for _, k := range keys {
+		for _, v := range h[k] {
+			buf.WriteString(k + ": " + v + "\n")
+		}
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,116 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// JSONLDBlock is a JSON-LD script block of a document
+type JSONLDBlock struct {
+	Raw  string
+	Data interface{} // decoded data, numbers are json.Number
+	Err  error       // decoding error
+}
+
+// Items returns JSON-LD nodes of the block: top-level objects, elements of top-level arrays and @graph contents
+func (b JSONLDBlock) Items() []map[string]interface{} {
+	var r []map[string]interface{}
+
+	var add func(v interface{})
+	add = func(v interface{}) {
+		switch t := v.(type) {
+		case []interface{}:
+			for _, e := range t {
+				add(e)
+			}
+		case map[string]interface{}:
+			if g, ok := t["@graph"]; ok {
+				add(g)
+				if len(t) == 1 || (len(t) == 2 && t["@context"] != nil) {
+					return
+				}
+			}
+			r = append(r, t)
+		}
+	}
+	add(b.Data)
+
+	return r
+}
+
+// JSONLDTypes returns @type values of a JSON-LD node
+func JSONLDTypes(item map[string]interface{}) []string {
+	switch t := item["@type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		r := make([]string, 0, len(t))
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				r = append(r, s)
+			}
+		}
+		return r
+	}
+
+	return nil
+}
+
+// jsonLDReplacer removes HTML comment and CDATA wrappers sometimes put around JSON-LD
+var jsonLDReplacer = strings.NewReplacer("<!--", "", "-->", "", "//<![CDATA[", "", "//]]>", "", "<![CDATA[", "", "]]>", "")
+
+// JSONLD extracts JSON-LD blocks of a document
+func JSONLD(doc *goquery.Document) []JSONLDBlock {
+	var r []JSONLDBlock
+	doc.Find("script[type]").Each(func(_ int, s *goquery.Selection) {
+		mt, _, err := mime.ParseMediaType(s.AttrOr("type", ""))
+		if err != nil || mt != "application/ld+json" {
+			return
+		}
+
+		raw := strings.TrimSpace(s.Text())
+		if raw == "" {
+			return
+		}
+
+		b := JSONLDBlock{Raw: raw}
+		b.Data, b.Err = decodeJSONLD(raw)
+		r = append(r, b)
+	})
+
+	return r
+}
+
+// decodeJSONLD decodes a JSON-LD block tolerating common markup errors
+func decodeJSONLD(raw string) (interface{}, error) {
+	v, err := decodeJSONNumber(raw)
+	if err == nil {
+		return v, nil
+	}
+
+	// Comment wrappers and raw line breaks within strings
+	s := jsonLDReplacer.Replace(raw)
+	s = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ").Replace(s)
+	if v, err2 := decodeJSONNumber(s); err2 == nil {
+		return v, nil
+	}
+
+	return nil, err
+}
+
+// decodeJSONNumber decodes JSON keeping numbers as json.Number
+func decodeJSONNumber(s string) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
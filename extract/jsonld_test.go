@@ -0,0 +1,90 @@
+package extract
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSONLD(t *testing.T) {
+	doc := parseDoc(t, "", `<html><head>
+		<script type="application/ld+json">{"@context": "https://schema.org", "@type": "Product", "name": "A", "price": 1.50}</script>
+		<script type="application/ld+json; charset=utf-8">
+			[{"@type": "Offer", "name": "B"}, {"@type": ["Thing", "https://schema.org/Organization"], "name": "C"}]
+		</script>
+		<script type="application/ld+json">{
+			"@context": "https://schema.org",
+			"@graph": [{"@type": "WebSite", "name": "D"}, {"@type": "Product", "name": "E"}]
+		}</script>
+		<script type="application/ld+json">{"@graph": [{"@type": "Person", "name": "F"}], "@type": "Collection", "name": "G"}</script>
+		<script type="application/ld+json"><!--
+			{"@type": "Event", "name": "H
+line"}
+		--></script>
+		<script type="application/ld+json">//<![CDATA[
+			{"@type": "Place", "name": "I"}
+		//]]></script>
+		<script type="application/ld+json">{"broken": </script>
+		<script type="application/ld+json">  </script>
+		<script type="application/json">{"@type": "Product", "name": "J"}</script>
+		<script>var x = {"@type": "Product"};</script>
+	</head></html>`)
+
+	blocks := JSONLD(doc)
+	if len(blocks) != 7 {
+		t.Fatalf("got %d blocks, want 7", len(blocks))
+	}
+	if blocks[6].Err == nil || blocks[6].Data != nil || blocks[6].Raw != `{"broken":` {
+		t.Errorf("got broken block %+v", blocks[6])
+	}
+
+	var names []string
+	for _, b := range blocks[:6] {
+		if b.Err != nil {
+			t.Errorf("%s: %v", b.Raw, b.Err)
+		}
+		for _, it := range b.Items() {
+			names = append(names, it["name"].(string))
+		}
+	}
+	if want := []string{"A", "B", "C", "D", "E", "F", "G", "H line", "I"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got items %q, want %q", names, want)
+	}
+
+	if p, ok := blocks[0].Data.(map[string]interface{})["price"].(json.Number); !ok || p.String() != "1.50" {
+		t.Errorf("got price %#v, want json.Number", blocks[0].Data.(map[string]interface{})["price"])
+	}
+
+	m := &Metadata{JSONLD: blocks}
+	var products []string
+	for _, it := range m.JSONLDItems("Product") {
+		products = append(products, it["name"].(string))
+	}
+	if want := []string{"A", "E"}; !reflect.DeepEqual(products, want) {
+		t.Errorf("got products %q, want %q", products, want)
+	}
+	if it := m.JSONLDItems("Organization"); len(it) != 1 || it[0]["name"] != "C" {
+		t.Errorf("got organizations %v", it)
+	}
+	if it := m.JSONLDItems("Organizat"); len(it) != 0 {
+		t.Errorf("got items of a partial type %v", it)
+	}
+}
+
+func TestJSONLDTypes(t *testing.T) {
+	tests := []struct {
+		item map[string]interface{}
+		want []string
+	}{
+		{map[string]interface{}{"@type": "Product"}, []string{"Product"}},
+		{map[string]interface{}{"@type": []interface{}{"A", 1.0, "B"}}, []string{"A", "B"}},
+		{map[string]interface{}{"@type": 1.0}, nil},
+		{map[string]interface{}{}, nil},
+	}
+
+	for _, tt := range tests {
+		if got := JSONLDTypes(tt.item); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got %q, want %q", tt.item, got, tt.want)
+		}
+	}
+}
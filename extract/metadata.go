@@ -0,0 +1,340 @@
+// Package extract extracts structured data from HTML documents.
+package extract
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Metadata is structured metadata of a page
+type Metadata struct {
+	JSONLD     []JSONLDBlock
+	Microdata  []*MicrodataItem
+	OpenGraph  OpenGraphData
+	Twitter    TwitterCardData
+	Canonical  string
+	Alternates []Alternate
+}
+
+// JSONLDItems returns JSON-LD items of a type, like "Product"
+func (m *Metadata) JSONLDItems(typ string) []map[string]interface{} {
+	var r []map[string]interface{}
+	for _, b := range m.JSONLD {
+		for _, it := range b.Items() {
+			if hasType(JSONLDTypes(it), typ) {
+				r = append(r, it)
+			}
+		}
+	}
+
+	return r
+}
+
+// MicrodataItems returns top-level microdata items of a type, like "Product"
+func (m *Metadata) MicrodataItems(typ string) []*MicrodataItem {
+	var r []*MicrodataItem
+	for _, it := range m.Microdata {
+		if hasType(it.Type, typ) {
+			r = append(r, it)
+		}
+	}
+
+	return r
+}
+
+// hasType reports whether types contain typ given either as a short name or as a full IRI
+func hasType(types []string, typ string) bool {
+	for _, t := range types {
+		if t == typ || strings.HasSuffix(t, "/"+typ) || strings.HasSuffix(t, "#"+typ) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// OpenGraphMedia is an image, video or audio object of OpenGraph metadata
+type OpenGraphMedia struct {
+	URL       string
+	SecureURL string
+	Type      string
+	Alt       string
+	Width     int
+	Height    int
+}
+
+// OpenGraphData is OpenGraph metadata of a page
+type OpenGraphData struct {
+	Title       string
+	Type        string
+	URL         string
+	Description string
+	SiteName    string
+	Locale      string
+	Images      []OpenGraphMedia
+	Videos      []OpenGraphMedia
+	Audio       []OpenGraphMedia
+
+	// Properties are all meta properties having a prefix, like "og:title" or "product:price:amount"
+	Properties map[string][]string
+}
+
+// Get returns the first value of a property
+func (o OpenGraphData) Get(prop string) string {
+	if v := o.Properties[prop]; len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+// TwitterCardData is Twitter card metadata of a page
+type TwitterCardData struct {
+	Card        string
+	Site        string
+	Creator     string
+	Title       string
+	Description string
+	Image       string
+	ImageAlt    string
+
+	// Properties are all twitter:* properties keyed by full names
+	Properties map[string]string
+}
+
+// Alternate is an alternate page in another language
+type Alternate struct {
+	Lang string // hreflang value, like "en-US" or "x-default"
+	URL  string
+}
+
+// Meta extracts all metadata of a document.
+//
+// Relative URLs are resolved against doc.Url and the document's <base href>, if any.
+func Meta(doc *goquery.Document) *Metadata {
+	return &Metadata{
+		JSONLD:     JSONLD(doc),
+		Microdata:  Microdata(doc),
+		OpenGraph:  OpenGraph(doc),
+		Twitter:    TwitterCard(doc),
+		Canonical:  Canonical(doc),
+		Alternates: Alternates(doc),
+	}
+}
+
+// OpenGraph extracts OpenGraph metadata of a document
+func OpenGraph(doc *goquery.Document) OpenGraphData {
+	base := baseURL(doc)
+	og := OpenGraphData{Properties: make(map[string][]string)}
+	media := []struct {
+		prefix string
+		list   *[]OpenGraphMedia
+	}{
+		{"og:image", &og.Images},
+		{"og:video", &og.Videos},
+		{"og:audio", &og.Audio},
+	}
+
+	doc.Find("meta[property], meta[name]").Each(func(_ int, s *goquery.Selection) {
+		prop := strings.ToLower(strings.TrimSpace(s.AttrOr("property", "")))
+		if prop == "" {
+			// Some sites put OpenGraph properties into the name attribute
+			if prop = strings.ToLower(strings.TrimSpace(s.AttrOr("name", ""))); !strings.HasPrefix(prop, "og:") {
+				return
+			}
+		}
+		if !strings.Contains(prop, ":") || strings.HasPrefix(prop, "twitter:") {
+			return
+		}
+
+		val := strings.TrimSpace(s.AttrOr("content", ""))
+		og.Properties[prop] = append(og.Properties[prop], val)
+
+		switch prop {
+		case "og:title":
+			og.Title = val
+		case "og:type":
+			og.Type = val
+		case "og:url":
+			og.URL = resolveURL(base, val)
+		case "og:description":
+			og.Description = val
+		case "og:site_name":
+			og.SiteName = val
+		case "og:locale":
+			og.Locale = val
+		}
+
+		for _, m := range media {
+			if prop == m.prefix || strings.HasPrefix(prop, m.prefix+":") {
+				field := strings.TrimPrefix(strings.TrimPrefix(prop, m.prefix), ":")
+				setOpenGraphMedia(m.list, field, resolveMedia(base, prop, val))
+			}
+		}
+	})
+
+	return og
+}
+
+// resolveMedia resolves URL properties of OpenGraph media
+func resolveMedia(base *url.URL, prop, val string) string {
+	if strings.Count(prop, ":") == 1 || strings.HasSuffix(prop, ":url") || strings.HasSuffix(prop, ":secure_url") {
+		return resolveURL(base, val)
+	}
+
+	return val
+}
+
+// setOpenGraphMedia sets a structured property of OpenGraph media.
+// A media URL starts a new object, other properties apply to the last one. The url property completes the last object
+// if its URL is empty or the same, e.g. og:image followed by og:image:url.
+func setOpenGraphMedia(list *[]OpenGraphMedia, field, val string) {
+	if field == "" || field == "url" {
+		if n := len(*list); field == "url" && n > 0 && ((*list)[n-1].URL == "" || (*list)[n-1].URL == val) {
+			(*list)[n-1].URL = val
+			return
+		}
+		*list = append(*list, OpenGraphMedia{URL: val})
+		return
+	}
+
+	if len(*list) == 0 {
+		*list = append(*list, OpenGraphMedia{})
+	}
+	m := &(*list)[len(*list)-1]
+
+	switch field {
+	case "secure_url":
+		m.SecureURL = val
+	case "type":
+		m.Type = val
+	case "alt":
+		m.Alt = val
+	case "width":
+		m.Width, _ = strconv.Atoi(val)
+	case "height":
+		m.Height, _ = strconv.Atoi(val)
+	}
+}
+
+// TwitterCard extracts Twitter card metadata of a document
+func TwitterCard(doc *goquery.Document) TwitterCardData {
+	base := baseURL(doc)
+	tc := TwitterCardData{Properties: make(map[string]string)}
+
+	doc.Find("meta[name], meta[property]").Each(func(_ int, s *goquery.Selection) {
+		prop := strings.ToLower(strings.TrimSpace(s.AttrOr("name", "")))
+		if !strings.HasPrefix(prop, "twitter:") {
+			prop = strings.ToLower(strings.TrimSpace(s.AttrOr("property", "")))
+		}
+		if !strings.HasPrefix(prop, "twitter:") {
+			return
+		}
+
+		val := strings.TrimSpace(s.AttrOr("content", s.AttrOr("value", "")))
+		if _, ok := tc.Properties[prop]; ok {
+			return
+		}
+		tc.Properties[prop] = val
+
+		switch prop {
+		case "twitter:card":
+			tc.Card = val
+		case "twitter:site":
+			tc.Site = val
+		case "twitter:creator":
+			tc.Creator = val
+		case "twitter:title":
+			tc.Title = val
+		case "twitter:description":
+			tc.Description = val
+		case "twitter:image", "twitter:image:src":
+			if tc.Image == "" {
+				tc.Image = resolveURL(base, val)
+			}
+		case "twitter:image:alt":
+			tc.ImageAlt = val
+		}
+	})
+
+	return tc
+}
+
+// Canonical returns the canonical URL of a document
+func Canonical(doc *goquery.Document) string {
+	var r string
+	doc.Find("link[rel][href]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if hasRel(s, "canonical") {
+			r = resolveURL(baseURL(doc), s.AttrOr("href", ""))
+			return false
+		}
+		return true
+	})
+
+	return r
+}
+
+// Alternates returns hreflang alternates of a document
+func Alternates(doc *goquery.Document) []Alternate {
+	base := baseURL(doc)
+
+	var r []Alternate
+	doc.Find("link[rel][hreflang][href]").Each(func(_ int, s *goquery.Selection) {
+		if !hasRel(s, "alternate") {
+			return
+		}
+		r = append(r, Alternate{
+			Lang: strings.TrimSpace(s.AttrOr("hreflang", "")),
+			URL:  resolveURL(base, s.AttrOr("href", "")),
+		})
+	})
+
+	return r
+}
+
+// hasRel reports whether an element's rel attribute contains a link type
+func hasRel(s *goquery.Selection, rel string) bool {
+	for _, v := range strings.Fields(s.AttrOr("rel", "")) {
+		if strings.EqualFold(v, rel) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// baseURL returns a base URL of a document
+func baseURL(doc *goquery.Document) *url.URL {
+	base := doc.Url
+
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if u, err := url.Parse(strings.TrimSpace(href)); err == nil {
+			if base != nil {
+				u = base.ResolveReference(u)
+			}
+			if u.IsAbs() {
+				base = u
+			}
+		}
+	}
+
+	return base
+}
+
+// resolveURL resolves a URL against a base URL. It's returned as is if it can't be resolved.
+func resolveURL(base *url.URL, s string) string {
+	s = strings.TrimSpace(s)
+	if base == nil || s == "" {
+		return s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+
+	return base.ResolveReference(u).String()
+}
@@ -0,0 +1,193 @@
+package extract
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// parseDoc parses an HTML document located at a URL
+func parseDoc(t *testing.T, rawURL, s string) *goquery.Document {
+	t.Helper()
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rawURL != "" {
+		if doc.Url, err = url.Parse(rawURL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return doc
+}
+
+func TestOpenGraph(t *testing.T) {
+	doc := parseDoc(t, "https://example.com/a/page.html", `<html><head>
+		<meta property="og:title" content=" Title ">
+		<meta property="og:type" content="product">
+		<meta property="og:url" content="/a/page">
+		<meta name="og:description" content="Description">
+		<meta property="og:site_name" content="Site">
+		<meta property="og:locale" content="en_US">
+		<meta property="og:image" content="one.jpg">
+		<meta property="og:image:url" content="one.jpg">
+		<meta property="og:image:width" content="640">
+		<meta property="og:image:height" content="480">
+		<meta property="og:image:alt" content="One">
+		<meta property="og:image" content="https://cdn.example.com/two.jpg">
+		<meta property="og:image:secure_url" content="https://cdn.example.com/two-s.jpg">
+		<meta property="og:image:type" content="image/jpeg">
+		<meta property="og:image:url" content="three.jpg">
+		<meta property="og:video:url" content="/v.mp4">
+		<meta property="og:video:width" content="1280">
+		<meta property="og:audio" content="a.mp3">
+		<meta property="product:price:amount" content="10">
+		<meta property="product:price:amount" content="12">
+		<meta property="twitter:card" content="summary">
+		<meta property="title" content="Ignored">
+		<meta name="description" content="Ignored">
+	</head></html>`)
+
+	og := OpenGraph(doc)
+
+	want := OpenGraphData{
+		Title:       "Title",
+		Type:        "product",
+		URL:         "https://example.com/a/page",
+		Description: "Description",
+		SiteName:    "Site",
+		Locale:      "en_US",
+		Images: []OpenGraphMedia{
+			{URL: "https://example.com/a/one.jpg", Alt: "One", Width: 640, Height: 480},
+			{
+				URL:       "https://cdn.example.com/two.jpg",
+				SecureURL: "https://cdn.example.com/two-s.jpg",
+				Type:      "image/jpeg",
+			},
+			{URL: "https://example.com/a/three.jpg"},
+		},
+		Videos: []OpenGraphMedia{{URL: "https://example.com/v.mp4", Width: 1280}},
+		Audio:  []OpenGraphMedia{{URL: "https://example.com/a/a.mp3"}},
+	}
+	props := og.Properties
+	og.Properties = nil
+	if !reflect.DeepEqual(og, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", og, want)
+	}
+
+	if got := props["product:price:amount"]; !reflect.DeepEqual(got, []string{"10", "12"}) {
+		t.Errorf("got prices %q", got)
+	}
+	if og.Properties = props; og.Get("product:price:amount") != "10" || og.Get("og:missing") != "" {
+		t.Errorf("got %q, %q", og.Get("product:price:amount"), og.Get("og:missing"))
+	}
+	for _, p := range []string{"twitter:card", "title", "description"} {
+		if _, ok := props[p]; ok {
+			t.Errorf("got property %s", p)
+		}
+	}
+}
+
+func TestOpenGraphMediaWithoutURL(t *testing.T) {
+	doc := parseDoc(t, "", `<html><head>
+		<meta property="og:image:width" content="100">
+		<meta property="og:image:url" content="a.jpg">
+		<meta property="og:image:height" content="50">
+	</head></html>`)
+
+	want := []OpenGraphMedia{{URL: "a.jpg", Width: 100, Height: 50}}
+	if got := OpenGraph(doc).Images; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestTwitterCard(t *testing.T) {
+	doc := parseDoc(t, "https://example.com/page", `<html><head>
+		<meta name="twitter:card" content="summary_large_image">
+		<meta name="twitter:site" content="@site">
+		<meta property="twitter:creator" content="@creator">
+		<meta name="twitter:title" content="Title">
+		<meta name="twitter:title" content="Second title">
+		<meta name="twitter:description" value="Description">
+		<meta name="twitter:image:src" content="/img.png">
+		<meta name="twitter:image" content="/other.png">
+		<meta name="twitter:image:alt" content="Alt">
+	</head></html>`)
+
+	tc := TwitterCard(doc)
+	want := TwitterCardData{
+		Card:        "summary_large_image",
+		Site:        "@site",
+		Creator:     "@creator",
+		Title:       "Title",
+		Description: "Description",
+		Image:       "https://example.com/img.png",
+		ImageAlt:    "Alt",
+	}
+	props := tc.Properties
+	tc.Properties = nil
+	if !reflect.DeepEqual(tc, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", tc, want)
+	}
+	if len(props) != 8 || props["twitter:title"] != "Title" { // the second title is ignored
+		t.Errorf("got properties %v", props)
+	}
+}
+
+func TestCanonicalAndAlternates(t *testing.T) {
+	doc := parseDoc(t, "https://example.com/en/page?x=1", `<html><head>
+		<base href="https://static.example.com/base/">
+		<link rel="stylesheet" href="style.css">
+		<link rel="Canonical" href="/en/page">
+		<link rel="canonical" href="/ignored">
+		<link rel="alternate" hreflang="de" href="../de/page">
+		<link rel="alternate nofollow" hreflang=" x-default " href="https://example.com/">
+		<link rel="alternate" type="application/rss+xml" href="feed.xml">
+		<link rel="stylesheet" hreflang="fr" href="fr.css">
+	</head></html>`)
+
+	if got, want := Canonical(doc), "https://static.example.com/en/page"; got != want {
+		t.Errorf("got canonical %q, want %q", got, want)
+	}
+
+	want := []Alternate{
+		{Lang: "de", URL: "https://static.example.com/de/page"},
+		{Lang: "x-default", URL: "https://example.com/"},
+	}
+	if got := Alternates(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("got alternates %+v, want %+v", got, want)
+	}
+
+	m := Meta(doc)
+	if m.Canonical != "https://static.example.com/en/page" || len(m.Alternates) != 2 {
+		t.Errorf("got metadata %+v", m)
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	tests := []struct {
+		docURL string
+		base   string
+		want   string // resolved "x/y"
+	}{
+		{"https://example.com/a/b", "", "https://example.com/a/x/y"},
+		{"https://example.com/a/b", `<base href="/c/">`, "https://example.com/c/x/y"},
+		{"https://example.com/a/b", `<base href="https://other.com/d">`, "https://other.com/x/y"},
+		{"https://example.com/a/b", `<base target="_blank">`, "https://example.com/a/x/y"},
+		{"", `<base href="https://other.com/d/">`, "https://other.com/d/x/y"},
+		{"", `<base href="/relative/">`, "x/y"},
+		{"", "", "x/y"},
+	}
+
+	for _, tt := range tests {
+		doc := parseDoc(t, tt.docURL, "<html><head>"+tt.base+"</head></html>")
+		if got := resolveURL(baseURL(doc), " x/y "); got != tt.want {
+			t.Errorf("%s %s: got %q, want %q", tt.docURL, tt.base, got, tt.want)
+		}
+	}
+}
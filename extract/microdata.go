@@ -0,0 +1,206 @@
+package extract
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+
+	"github.com/ashep/aghpu/util"
+)
+
+// MicrodataValue is a value of a microdata property, either a string or a nested item
+type MicrodataValue struct {
+	Value string
+	Item  *MicrodataItem
+}
+
+// MicrodataItem is a microdata item
+type MicrodataItem struct {
+	Type       []string // itemtype values, like "https://schema.org/Product"
+	ID         string   // itemid
+	Properties map[string][]MicrodataValue
+}
+
+// Get returns the first string value of a property
+func (it *MicrodataItem) Get(name string) string {
+	for _, v := range it.Properties[name] {
+		if v.Item == nil {
+			return v.Value
+		}
+	}
+
+	return ""
+}
+
+// Item returns the first nested item of a property
+func (it *MicrodataItem) Item(name string) *MicrodataItem {
+	for _, v := range it.Properties[name] {
+		if v.Item != nil {
+			return v.Item
+		}
+	}
+
+	return nil
+}
+
+// Microdata extracts top-level microdata items of a document
+func Microdata(doc *goquery.Document) []*MicrodataItem {
+	base := baseURL(doc)
+
+	var r []*MicrodataItem
+	doc.Find("[itemscope]").Each(func(_ int, s *goquery.Selection) {
+		if _, ok := s.Attr("itemprop"); ok {
+			return
+		}
+		r = append(r, microdataItem(doc, base, s.Nodes[0], map[*html.Node]bool{}))
+	})
+
+	return r
+}
+
+// microdataItem builds an item of an itemscope element.
+// Visited contains elements of the items being built, so itemref loops are broken.
+func microdataItem(doc *goquery.Document, base *url.URL, n *html.Node, visited map[*html.Node]bool) *MicrodataItem {
+	visited[n] = true
+	defer delete(visited, n)
+
+	it := &MicrodataItem{
+		Type:       strings.Fields(attr(n, "itemtype")),
+		ID:         strings.TrimSpace(attr(n, "itemid")),
+		Properties: make(map[string][]MicrodataValue),
+	}
+
+	// Elements referenced by itemref may be descendants as well, each one is crawled once
+	crawled := make(map[*html.Node]bool)
+
+	var crawl func(n *html.Node)
+	crawl = func(n *html.Node) {
+		if n.Type != html.ElementNode || crawled[n] {
+			return
+		}
+		crawled[n] = true
+
+		if props := strings.Fields(attr(n, "itemprop")); len(props) > 0 {
+			var v MicrodataValue
+			if hasAttr(n, "itemscope") {
+				if visited[n] {
+					return
+				}
+				v.Item = microdataItem(doc, base, n, visited)
+			} else {
+				v.Value = microdataValue(base, n)
+			}
+			for _, p := range props {
+				it.Properties[p] = append(it.Properties[p], v)
+			}
+		}
+
+		// Properties of nested items belong to them
+		if hasAttr(n, "itemscope") {
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			crawl(c)
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		crawl(c)
+	}
+	for _, id := range strings.Fields(attr(n, "itemref")) {
+		ref := doc.FindMatcher(idMatcher(id))
+		if ref.Length() > 0 && !visited[ref.Nodes[0]] {
+			crawl(ref.Nodes[0])
+		}
+	}
+
+	return it
+}
+
+// microdataValue returns a property value of an element
+func microdataValue(base *url.URL, n *html.Node) string {
+	switch n.Data {
+	case "meta":
+		return strings.TrimSpace(attr(n, "content"))
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		return resolveURL(base, attr(n, "src"))
+	case "a", "area", "link":
+		return resolveURL(base, attr(n, "href"))
+	case "object":
+		return resolveURL(base, attr(n, "data"))
+	case "data", "meter":
+		return strings.TrimSpace(attr(n, "value"))
+	case "time":
+		if hasAttr(n, "datetime") {
+			return strings.TrimSpace(attr(n, "datetime"))
+		}
+	}
+
+	// Some sites put values into the content attribute of arbitrary elements
+	if hasAttr(n, "content") {
+		return strings.TrimSpace(attr(n, "content"))
+	}
+
+	return util.CollapseSpace(goquery.NewDocumentFromNode(n).Text())
+}
+
+// idMatcher matches an element by ID
+type idMatcher string
+
+// Match implements goquery.Matcher
+func (m idMatcher) Match(n *html.Node) bool {
+	return n.Type == html.ElementNode && attr(n, "id") == string(m)
+}
+
+// MatchAll implements goquery.Matcher
+func (m idMatcher) MatchAll(n *html.Node) []*html.Node {
+	var r []*html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if m.Match(n) {
+			r = append(r, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+
+	return r
+}
+
+// Filter implements goquery.Matcher
+func (m idMatcher) Filter(nodes []*html.Node) []*html.Node {
+	var r []*html.Node
+	for _, n := range nodes {
+		if m.Match(n) {
+			r = append(r, n)
+		}
+	}
+
+	return r
+}
+
+// attr returns an attribute value of a node
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+
+	return ""
+}
+
+// hasAttr reports whether a node has an attribute
+func hasAttr(n *html.Node, name string) bool {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return true
+		}
+	}
+
+	return false
+}
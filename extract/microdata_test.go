@@ -0,0 +1,120 @@
+package extract
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMicrodata(t *testing.T) {
+	doc := parseDoc(t, "https://example.com/shop/item.html", `<html><head><base href="/static/"></head><body>
+		<div itemscope itemtype="https://schema.org/Product" itemid="urn:p:1" itemref="extra">
+			<h1 itemprop="name">Red
+				shoes</h1>
+			<img itemprop="image" src="red.jpg">
+			<a itemprop="url" href="https://example.org/red">link</a>
+			<meta itemprop="sku" content=" 123 ">
+			<time itemprop="releaseDate" datetime="2020-01-02">Jan 2</time>
+			<data itemprop="weight" value="500">half a kilo</data>
+			<span itemprop="color material" content="red">Red</span>
+			<div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+				<span itemprop="price">10</span>
+				<div itemprop="seller" itemscope itemtype="https://schema.org/Organization">
+					<span itemprop="name">Shop</span>
+				</div>
+			</div>
+			<span itemprop="offers">none</span>
+		</div>
+		<p id="extra" itemprop="description">Comfortable</p>
+		<div itemscope itemtype="https://schema.org/Person"><span itemprop="name">Bob</span></div>
+	</body></html>`)
+
+	items := Microdata(doc)
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2", len(items))
+	}
+
+	p := items[0]
+	if !reflect.DeepEqual(p.Type, []string{"https://schema.org/Product"}) || p.ID != "urn:p:1" {
+		t.Errorf("got type %q, id %q", p.Type, p.ID)
+	}
+
+	tests := []struct {
+		prop string
+		want string
+	}{
+		{"name", "Red shoes"},
+		{"image", "https://example.com/static/red.jpg"},
+		{"url", "https://example.org/red"},
+		{"sku", "123"},
+		{"releaseDate", "2020-01-02"},
+		{"weight", "500"},
+		{"color", "red"},
+		{"material", "red"},
+		{"offers", "none"},
+		{"description", "Comfortable"},
+		{"price", ""}, // belongs to the nested item
+	}
+	for _, tt := range tests {
+		if got := p.Get(tt.prop); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.prop, got, tt.want)
+		}
+	}
+
+	offer := p.Item("offers")
+	if offer == nil || offer.Get("price") != "10" || len(p.Properties["offers"]) != 2 {
+		t.Fatalf("got offers %+v", p.Properties["offers"])
+	}
+	if s := offer.Item("seller"); s == nil || s.Get("name") != "Shop" {
+		t.Errorf("got seller %+v", s)
+	}
+	if p.Item("name") != nil {
+		t.Error("got an item of a string property")
+	}
+
+	m := &Metadata{Microdata: items}
+	if it := m.MicrodataItems("Person"); len(it) != 1 || it[0].Get("name") != "Bob" {
+		t.Errorf("got persons %v", it)
+	}
+	if it := m.MicrodataItems("Offer"); len(it) != 0 {
+		t.Errorf("got nested items %v", it)
+	}
+}
+
+func TestMicrodataItemrefLoops(t *testing.T) {
+	doc := parseDoc(t, "", `<html><body>
+		<div id="a" itemscope itemref="b self">
+			<span itemprop="name">A</span>
+			<div id="b" itemprop="child" itemscope itemref="a c">
+				<span itemprop="name">B</span>
+			</div>
+		</div>
+		<div id="self" itemprop="self" itemscope itemref="self"><span itemprop="name">S</span></div>
+		<span id="c" itemprop="extra">C</span>
+	</body></html>`)
+
+	items := Microdata(doc)
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+
+	a := items[0]
+	if a.Get("name") != "A" || len(a.Properties["name"]) != 1 {
+		t.Errorf("got names %+v", a.Properties["name"])
+	}
+	if n := len(a.Properties["child"]); n != 1 {
+		t.Errorf("got %d children, want 1", n)
+	}
+
+	b := a.Item("child")
+	if b == nil || b.Get("name") != "B" || b.Get("extra") != "C" {
+		t.Fatalf("got child %+v", b)
+	}
+	if b.Item("child") != nil {
+		t.Error("an item contains itself")
+	}
+
+	s := a.Item("self")
+	if s == nil || s.Get("name") != "S" || s.Item("self") != nil {
+		t.Errorf("got self-referencing item %+v", s)
+	}
+}
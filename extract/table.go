@@ -0,0 +1,408 @@
+package extract
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	csv "github.com/tushar2708/altcsv"
+	"golang.org/x/net/html"
+
+	"github.com/ashep/aghpu/util"
+)
+
+// maxSpan is a maximum value of rowspan and colspan attributes
+const maxSpan = 1000
+
+// TableOptions are options of table extraction
+type TableOptions struct {
+	// HeaderRows is a number of header rows. If zero, rows of thead or leading rows of th cells are headers.
+	// If negative, the table has no header. Columns without names are named "col1", "col2" and so on.
+	HeaderRows int
+
+	// HeaderSeparator joins names of multi-row headers, " / " if empty
+	HeaderSeparator string
+
+	// Links makes a "<column> URL" field of the first link of a cell
+	Links bool
+
+	// Attrs are attributes captured as "<column>@<attribute>" fields.
+	// An attribute is taken from the cell or its first descendant having it.
+	Attrs []string
+
+	// BaseURL resolves relative links
+	BaseURL *url.URL
+}
+
+// tableCell is a cell of a table grid
+type tableCell struct {
+	node *html.Node
+	text string
+	th   bool
+}
+
+// tableRow is a row of a table
+type tableRow struct {
+	cells []*html.Node
+	head  bool // row of thead
+}
+
+// Table extracts records of a table. Sel is a table or contains one, the first one is used.
+//
+// Cells spanning several rows or columns are repeated in every slot they occupy. Records are maps of column names
+// to cell texts normalized with util.CollapseSpace, like the output of util.CSVToMap. Columns are returned in order.
+func Table(sel *goquery.Selection, opts TableOptions) ([]map[string]string, []string) {
+	if !sel.Is("table") {
+		sel = sel.Find("table")
+	}
+	if sel.Length() == 0 {
+		return nil, nil
+	}
+
+	rows := tableRows(sel.Nodes[0])
+	grid := tableGrid(rows)
+
+	nHead := opts.HeaderRows
+	if nHead == 0 {
+		nHead = detectHeaderRows(rows, grid)
+	}
+	if nHead < 0 {
+		nHead = 0
+	}
+	if nHead > len(grid) {
+		nHead = len(grid)
+	}
+
+	sep := opts.HeaderSeparator
+	if sep == "" {
+		sep = " / "
+	}
+	names := headerNames(grid[:nHead], gridWidth(grid), sep)
+
+	// Extra columns of links and attributes follow their source column if any record has them
+	var extras [][]string
+	for i := range names {
+		var ex []string
+		if opts.Links {
+			ex = append(ex, names[i]+" URL")
+		}
+		for _, a := range opts.Attrs {
+			ex = append(ex, names[i]+"@"+a)
+		}
+		extras = append(extras, ex)
+	}
+	used := make(map[string]bool)
+
+	var records []map[string]string
+	for _, row := range grid[nHead:] {
+		rec := make(map[string]string)
+		empty := true
+		for i, name := range names {
+			var c *tableCell
+			if i < len(row) {
+				c = row[i]
+			}
+			if c == nil {
+				rec[name] = ""
+				continue
+			}
+
+			rec[name] = c.text
+			if c.text != "" {
+				empty = false
+			}
+
+			if opts.Links {
+				if href := findAttr(c.node, "a", "href"); href != "" {
+					rec[name+" URL"] = resolveURL(opts.BaseURL, href)
+					used[name+" URL"] = true
+				}
+			}
+			for _, a := range opts.Attrs {
+				if v := findAttr(c.node, "", a); v != "" {
+					rec[name+"@"+a] = v
+					used[name+"@"+a] = true
+				}
+			}
+		}
+		if !empty {
+			records = append(records, rec)
+		}
+	}
+
+	var columns []string
+	for i, name := range names {
+		columns = append(columns, name)
+		for _, ex := range extras[i] {
+			if used[ex] {
+				columns = append(columns, ex)
+			}
+		}
+	}
+
+	// Every record has all columns, like records read from CSV
+	for _, rec := range records {
+		for _, col := range columns {
+			if _, ok := rec[col]; !ok {
+				rec[col] = ""
+			}
+		}
+	}
+
+	return records, columns
+}
+
+// tableRows returns rows of a table excluding rows of nested tables
+func tableRows(table *html.Node) []tableRow {
+	var rows []tableRow
+
+	addRow := func(tr *html.Node, head bool) {
+		row := tableRow{head: head}
+		for c := tr.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && (c.Data == "td" || c.Data == "th") {
+				row.cells = append(row.cells, c)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	for c := table.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.Data {
+		case "tr":
+			addRow(c, false)
+		case "thead", "tbody", "tfoot":
+			for r := c.FirstChild; r != nil; r = r.NextSibling {
+				if r.Type == html.ElementNode && r.Data == "tr" {
+					addRow(r, c.Data == "thead")
+				}
+			}
+		}
+	}
+
+	return rows
+}
+
+// tableGrid expands cells spanning several rows or columns into a grid
+func tableGrid(rows []tableRow) [][]*tableCell {
+	grid := make([][]*tableCell, len(rows))
+
+	for r, row := range rows {
+		col := 0
+		for _, n := range row.cells {
+			// Skip slots occupied by cells of previous rows
+			for col < len(grid[r]) && grid[r][col] != nil {
+				col++
+			}
+
+			rowSpan := spanAttr(n, "rowspan")
+			if rowSpan == 0 || r+rowSpan > len(rows) {
+				rowSpan = len(rows) - r
+			}
+			colSpan := spanAttr(n, "colspan")
+			if colSpan == 0 {
+				colSpan = 1
+			}
+
+			c := &tableCell{node: n, text: cellText(n), th: n.Data == "th"}
+			for i := r; i < r+rowSpan; i++ {
+				for len(grid[i]) < col+colSpan {
+					grid[i] = append(grid[i], nil)
+				}
+				for j := col; j < col+colSpan; j++ {
+					if grid[i][j] == nil {
+						grid[i][j] = c
+					}
+				}
+			}
+			col += colSpan
+		}
+	}
+
+	return grid
+}
+
+// spanAttr returns a value of rowspan or colspan attribute, 1 if it's not set or invalid
+func spanAttr(n *html.Node, name string) int {
+	v, err := strconv.Atoi(strings.TrimSpace(attr(n, name)))
+	if err != nil || v < 0 {
+		return 1
+	}
+	if v > maxSpan {
+		return maxSpan
+	}
+
+	return v
+}
+
+// gridWidth returns a number of grid columns
+func gridWidth(grid [][]*tableCell) int {
+	w := 0
+	for _, row := range grid {
+		if len(row) > w {
+			w = len(row)
+		}
+	}
+
+	return w
+}
+
+// detectHeaderRows returns a number of header rows: rows of thead or leading rows of th cells
+func detectHeaderRows(rows []tableRow, grid [][]*tableCell) int {
+	n := 0
+	for n < len(rows) && rows[n].head {
+		n++
+	}
+	if n > 0 {
+		return n
+	}
+
+	for ; n < len(grid); n++ {
+		if len(grid[n]) == 0 {
+			break
+		}
+		for _, c := range grid[n] {
+			if c == nil || !c.th {
+				return n
+			}
+		}
+	}
+
+	// Tables made of th cells only have a single header row
+	if n == len(grid) && n > 1 {
+		return 1
+	}
+
+	return n
+}
+
+// headerNames returns unique column names joining texts of header rows
+func headerNames(head [][]*tableCell, width int, sep string) []string {
+	names := make([]string, width)
+	seen := make(map[string]int)
+
+	for i := range names {
+		var parts []string
+		var prev *tableCell
+		for _, row := range head {
+			if i >= len(row) || row[i] == nil || row[i] == prev {
+				continue
+			}
+			prev = row[i]
+			if t := row[i].text; t != "" && (len(parts) == 0 || parts[len(parts)-1] != t) {
+				parts = append(parts, t)
+			}
+		}
+
+		name := strings.Join(parts, sep)
+		if name == "" {
+			name = "col" + strconv.Itoa(i+1)
+		}
+		if seen[name]++; seen[name] > 1 {
+			name = fmt.Sprintf("%s (%d)", name, seen[name])
+		}
+		names[i] = name
+	}
+
+	return names
+}
+
+// cellText returns normalized text of a cell
+func cellText(n *html.Node) string {
+	var buf strings.Builder
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			buf.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			switch n.Data {
+			case "script", "style", "template", "table":
+				return
+			case "br", "p", "div", "li":
+				buf.WriteString(" ")
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+
+	return util.CollapseSpace(buf.String())
+}
+
+// findAttr returns an attribute of a node or its first descendant having it.
+// If tag is not empty, only elements of the tag are considered.
+func findAttr(n *html.Node, tag, name string) string {
+	if n.Type == html.ElementNode && (tag == "" || n.Data == tag) && hasAttr(n, name) {
+		return strings.TrimSpace(attr(n, name))
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if v := findAttr(c, tag, name); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// WriteCSV writes records as CSV having a header row of columns.
+// If columns are empty, they are sorted keys of all records.
+func WriteCSV(w io.Writer, records []map[string]string, columns []string) error {
+	if len(columns) == 0 {
+		keys := make(map[string]bool)
+		for _, rec := range records {
+			for k := range rec {
+				keys[k] = true
+			}
+		}
+		for k := range keys {
+			columns = append(columns, k)
+		}
+		sort.Strings(columns)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+
+	row := make([]string, len(columns))
+	for _, rec := range records {
+		for i, col := range columns {
+			row[i] = rec[col]
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// SaveCSV saves records to a CSV file which can be loaded with util.CSVToMap
+func SaveCSV(fPath string, records []map[string]string, columns []string) error {
+	fp, err := os.Create(fPath)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteCSV(fp, records, columns); err != nil {
+		_ = fp.Close()
+		return fmt.Errorf("failed to write %s: %v", fPath, err)
+	}
+
+	return fp.Close()
+}
@@ -0,0 +1,218 @@
+package extract
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/ashep/aghpu/util"
+)
+
+// parseTable parses an HTML fragment
+func parseTable(t *testing.T, s string) *goquery.Selection {
+	t.Helper()
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return doc.Selection
+}
+
+func TestTableSpans(t *testing.T) {
+	sel := parseTable(t, `<table>
+		<thead>
+			<tr><th rowspan="2">Name</th><th colspan="2">Price</th></tr>
+			<tr><th>Old</th><th>New</th></tr>
+		</thead>
+		<tbody>
+			<tr><td rowspan="2">A<br>item</td><td>1</td><td>2</td></tr>
+			<tr><td colspan="2">3</td></tr>
+			<tr><td></td><td></td><td></td></tr>
+			<tr><td>B</td></tr>
+		</tbody>
+	</table>`)
+
+	records, columns := Table(sel, TableOptions{})
+	if want := []string{"Name", "Price / Old", "Price / New"}; !reflect.DeepEqual(columns, want) {
+		t.Fatalf("got columns %q, want %q", columns, want)
+	}
+
+	want := []map[string]string{
+		{"Name": "A item", "Price / Old": "1", "Price / New": "2"},
+		{"Name": "A item", "Price / Old": "3", "Price / New": "3"},
+		{"Name": "B", "Price / Old": "", "Price / New": ""},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got %q, want %q", records, want)
+	}
+
+	_, columns = Table(sel, TableOptions{HeaderSeparator: ": "})
+	if columns[1] != "Price: Old" {
+		t.Errorf("got columns %q", columns)
+	}
+}
+
+func TestTableHeaderDetection(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		opts    TableOptions
+		columns []string
+		records int
+	}{
+		{
+			name:    "th row",
+			html:    `<table><tr><th>A</th><th>B</th></tr><tr><td>1</td><td>2</td></tr></table>`,
+			columns: []string{"A", "B"},
+			records: 1,
+		},
+		{
+			name:    "row header cells",
+			html:    `<table><tr><th>A</th><th>B</th></tr><tr><th>x</th><td>2</td></tr></table>`,
+			columns: []string{"A", "B"},
+			records: 1,
+		},
+		{
+			name:    "no header",
+			html:    `<table><tr><td>1</td><td>2</td><td>3</td></tr><tr><td>4</td></tr></table>`,
+			columns: []string{"col1", "col2", "col3"},
+			records: 2,
+		},
+		{
+			name:    "th only",
+			html:    `<table><tr><th>A</th></tr><tr><th>1</th></tr></table>`,
+			columns: []string{"A"},
+			records: 1,
+		},
+		{
+			name:    "explicit rows",
+			html:    `<table><tr><td>A</td><td>B</td></tr><tr><td>1</td><td>2</td></tr></table>`,
+			opts:    TableOptions{HeaderRows: 1},
+			columns: []string{"A", "B"},
+			records: 1,
+		},
+		{
+			name:    "disabled",
+			html:    `<table><thead><tr><th>A</th></tr></thead><tr><td>1</td></tr></table>`,
+			opts:    TableOptions{HeaderRows: -1},
+			columns: []string{"col1"},
+			records: 2,
+		},
+		{
+			name:    "duplicate and empty names",
+			html:    `<table><tr><th>A</th><th>A</th><th></th></tr><tr><td>1</td><td>2</td><td>3</td></tr></table>`,
+			columns: []string{"A", "A (2)", "col3"},
+			records: 1,
+		},
+		{
+			name: "nested table",
+			html: `<div><table><tr><th>A</th></tr>
+				<tr><td>1<table><tr><td>inner</td></tr></table></td></tr></table></div>`,
+			columns: []string{"A"},
+			records: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		records, columns := Table(parseTable(t, tt.html), tt.opts)
+		if !reflect.DeepEqual(columns, tt.columns) || len(records) != tt.records {
+			t.Errorf("%s: got %q, %q", tt.name, columns, records)
+		}
+	}
+
+	if records, columns := Table(parseTable(t, "<p>no table</p>"), TableOptions{}); records != nil || columns != nil {
+		t.Errorf("got %q, %q", records, columns)
+	}
+}
+
+func TestTableLinksAndAttrs(t *testing.T) {
+	base, _ := url.Parse("https://example.com/list/")
+	sel := parseTable(t, `<table>
+		<tr><th>Name</th><th>Date</th></tr>
+		<tr><td><a href="item/1" title="First">One</a></td><td><time datetime="2020-01-02">Jan 2</time></td></tr>
+		<tr><td>Two</td><td data-id=" 7 ">Feb 3</td></tr>
+	</table>`)
+
+	records, columns := Table(sel, TableOptions{Links: true, Attrs: []string{"datetime", "data-id"}, BaseURL: base})
+	if want := []string{"Name", "Name URL", "Date", "Date@datetime", "Date@data-id"}; !reflect.DeepEqual(columns, want) {
+		t.Fatalf("got columns %q, want %q", columns, want)
+	}
+
+	want := []map[string]string{
+		{
+			"Name": "One", "Name URL": "https://example.com/list/item/1",
+			"Date": "Jan 2", "Date@datetime": "2020-01-02", "Date@data-id": "",
+		},
+		{
+			"Name": "Two", "Name URL": "",
+			"Date": "Feb 3", "Date@datetime": "", "Date@data-id": "7",
+		},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got %q, want %q", records, want)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	records := []map[string]string{
+		{"b": "1", "a": "x, \"y\""},
+		{"b": "line\nbreak", "c": "3"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, records, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "a,b,c\n\"x, \"\"y\"\"\",1,\"\"\n\"\",\"line\nbreak\",3\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteCSV(&buf, records, []string{"c", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "c,b\n\"\",1\n3,\"line\nbreak\"\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestSaveCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aghpu-extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	records, columns := Table(parseTable(t, `<table>
+		<tr><th>Name</th><th>Note</th></tr>
+		<tr><td>A</td><td>x, "y"</td></tr>
+	</table>`), TableOptions{})
+
+	fPath := filepath.Join(dir, "table.csv")
+	if err := SaveCSV(fPath, records, columns); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := util.CSVToMap(fPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, records) {
+		t.Errorf("got %q, want %q", got, records)
+	}
+
+	if err := SaveCSV(filepath.Join(dir, "missing", "table.csv"), records, columns); err == nil {
+		t.Error("no error")
+	}
+}
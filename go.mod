@@ -4,5 +4,6 @@ go 1.15
 
 require (
 	github.com/PuerkitoBio/goquery v1.6.0
-	github.com/tushar2708/altcsv v0.0.0-20190930232535-20830d2e2c68 // indirect
+	github.com/tushar2708/altcsv v0.0.0-20190930232535-20830d2e2c68
+	golang.org/x/net v0.0.0-20200202094626-16171245cfb2
 )
@@ -6,11 +6,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"mime"
 	"net"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -31,22 +31,71 @@ type Cli struct {
 	handlingError bool
 
 	id         string
-	dump       bool
-	dumpDir    string
 	maxRetries int
 	userAgent  string
+	trace      bool
+
+	idempotencyKeys bool
+	detectRules     []Rule
+	captchaSolver   CaptchaSolver
+
+	recoveryHandler RecoveryHandler
+	reqNum          int32
+
+	dumpSink            DumpSink
+	dumpMode            DumpMode
+	dumpFilter          DumpFilter
+	dumpRedactedHeaders map[string]bool
+	dumpBodyRedactions  []bodyRedaction
+
+	dedupMux     sync.Mutex
+	dedup        bool
+	dedupKeyFunc DedupKeyFunc
+	dedupCalls   map[string]*dedupCall
+
+	metricsMux sync.RWMutex
+	metrics    *Metrics
+
+	events    eventHub
+	bandwidth bandwidth
+	browser   browser
+	jsonOpts  JSONOptions
+
+	proxyMux sync.RWMutex
+	proxyURL *url.URL
+
+	// Transport settings are changed by replacing the transport with a modified copy
+	trMux   sync.RWMutex
+	tlsPins map[string]map[string]bool
+	schemes map[string]http.RoundTripper
+
+	dialer *net.Dialer
+	tr     *http.Transport
+	cli    *http.Client
+	l      *logger.Logger
+}
 
-	errorHandler ErrorHandler
-	reqNum       int32
+// ErrorHandler is HTTP request error handler.
+//
+// If a response is classified by a detection rule, err is a *DetectedError.
+type ErrorHandler func(ctx context.Context, c *Cli, req *http.Request, rsp *http.Response, err error, tryN int) error
 
-	cli *http.Client
-	l   *logger.Logger
+// StatusError is an error of a response having non-2xx status
+type StatusError struct {
+	Status     string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
 }
 
-// ErrorHandler is HTTP request error handler
-type ErrorHandler func(ctx context.Context, c *Cli, req *http.Request, rsp *http.Response, err error, tryN int) error
+// Error implements error
+func (e *StatusError) Error() string {
+	return e.Status
+}
 
-// New instantiates a client
+// New instantiates a client.
+//
+// If ua is not empty, it overrides User-Agent of browser profiles.
 func New(name string, dumpDir, ua, prxURL string, dump bool, log *logger.Logger) (*Cli, error) {
 	var err error
 
@@ -58,33 +107,23 @@ func New(name string, dumpDir, ua, prxURL string, dump bool, log *logger.Logger)
 
 	sID := fmt.Sprintf("%d", time.Now().Unix())
 
+	var sink DumpSink
 	if dump {
-		// Calculate dump directory
-		dumpDir, err = filepath.Abs(dumpDir)
+		ds, err := NewDirSink(filepath.Join(dumpDir, sID), DirSinkOptions{})
 		if err != nil {
 			return nil, err
 		}
-		dumpDir = filepath.Join(dumpDir, sID)
+		log.Info("dump directory: %v\n", ds.Dir())
+		sink = ds
+	}
 
-		// Make dump directory
-		err = os.MkdirAll(dumpDir, 0700)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create dump directory: %v", err)
-		}
-		log.Info("dump directory: %v\n", dumpDir)
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
 	}
 
 	tr := &http.Transport{
-		Proxy: func(r *http.Request) (*url.URL, error) {
-			if prxURL != "" {
-				return url.Parse(prxURL)
-			}
-			return nil, nil
-		},
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+		DialContext:           dialer.DialContext,
 		ForceAttemptHTTP2:     true,
 		MaxIdleConns:          100,
 		IdleConnTimeout:       90 * time.Second,
@@ -97,26 +136,31 @@ func New(name string, dumpDir, ua, prxURL string, dump bool, log *logger.Logger)
 		Timeout:   60 * time.Second,
 	}
 
-	c.Jar, err = cookiejar.New(&cookiejar.Options{})
+	jar, err := newRecordingJar()
 	if err != nil {
 		return nil, err
 	}
-
-	if ua == "" {
-		ua = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 " +
-			"(KHTML, like Gecko) Chrome/86.0.4240.75 Safari/537.36"
-	}
+	c.Jar = jar
 
 	cli := &Cli{
 		mux:        &sync.Mutex{},
+		dialer:     dialer,
+		tr:         tr,
 		cli:        &c,
-		dump:       dump,
-		dumpDir:    dumpDir,
+		dumpSink:   sink,
 		id:         sID,
 		l:          log,
 		userAgent:  ua,
 		maxRetries: 10,
+		metrics:    NewMetrics(),
 	}
+	cli.SetDumpRedactedHeaders(DefaultRedactedHeaders...)
+	tr.Proxy = cli.proxy
+	if err := cli.SetProxy(prxURL); err != nil {
+		return nil, err
+	}
+	cli.browser.profile = ProfileChrome
+	cli.browser.locale = LocaleEnUS
 
 	return cli, nil
 }
@@ -126,115 +170,119 @@ func (c *Cli) Client() *http.Client {
 	return c.cli
 }
 
-// SetErrorHandler sets HTTP request error handler
-func (c *Cli) SetErrorHandler(fn ErrorHandler) {
-	c.errorHandler = fn
+// transport returns the current transport
+func (c *Cli) transport() *http.Transport {
+	c.trMux.RLock()
+	defer c.trMux.RUnlock()
+
+	return c.tr
 }
 
-// SetMaxRetries sets maximum number of request retries
-func (c *Cli) SetMaxRetries(n int) {
-	c.maxRetries = n
+// updateTransport replaces the transport with a copy modified by fn.
+// Requests in progress keep using the old transport, its idle connections are closed.
+func (c *Cli) updateTransport(fn func(tr *http.Transport)) {
+	c.trMux.Lock()
+	old := c.tr
+	tr := old.Clone()
+	for scheme, rt := range c.schemes {
+		tr.RegisterProtocol(scheme, rt)
+	}
+	fn(tr)
+	c.tr = tr
+	c.cli.Transport = tr
+	c.trMux.Unlock()
+
+	old.CloseIdleConnections()
 }
 
-// Reset resets the client
-func (c *Cli) Reset() error {
-	j, err := cookiejar.New(nil)
-	if err != nil {
-		return err
+// SetErrorHandler sets HTTP request error handler. It replaces the recovery handler.
+func (c *Cli) SetErrorHandler(fn ErrorHandler) {
+	c.recoveryHandler = AdaptErrorHandler(fn)
+}
+
+// SetProxy sets proxy URL. Empty URL means direct connection.
+func (c *Cli) SetProxy(u string) error {
+	var pURL *url.URL
+	if u != "" {
+		var err error
+		if pURL, err = url.Parse(u); err != nil {
+			return fmt.Errorf("invalid proxy URL: %v", err)
+		}
 	}
 
-	c.cli.Jar = j
+	c.proxyMux.Lock()
+	c.proxyURL = pURL
+	c.proxyMux.Unlock()
+
+	c.transport().CloseIdleConnections()
 
 	return nil
 }
 
-// DumpTransaction dumps an HTTP transaction content into a file
-func (c *Cli) DumpTransaction(
-	req *http.Request,
-	resp *http.Response,
-	reqBody, respBody []byte,
-	tryNum int,
-) {
-	// Create a dump file
-	fPath := filepath.Join(c.dumpDir, fmt.Sprintf("%04d-%02d.txt", c.reqNum, tryNum))
-	f, err := os.Create(fPath)
-	if err != nil {
-		c.l.Err("error creating http dump file %v: %v", fPath, err)
-		return
-	}
-	defer func() {
-		_ = f.Close()
-	}()
+// Proxy returns proxy URL, or empty string if a direct connection is used
+func (c *Cli) Proxy() string {
+	c.proxyMux.RLock()
+	defer c.proxyMux.RUnlock()
 
-	// Dump method and URL
-	if _, err := f.WriteString(fmt.Sprintf("%v %v\n\n", req.Method, req.URL)); err != nil {
-		c.l.Err("failed to write string: %s", err.Error())
-		return
+	if c.proxyURL == nil {
+		return ""
 	}
 
-	// Dump request headers
-	for k, h := range req.Header {
-		for _, v := range h {
-			if _, err := f.Write([]byte(fmt.Sprintf("%v: %v\n", k, v))); err != nil {
-				c.l.Err("error writing http dump file %v: %v", fPath, err)
-				return
-			}
-		}
-	}
-	if _, err := f.WriteString("\n"); err != nil {
-		c.l.Err("failed to write string: %s", err.Error())
-		return
-	}
+	return c.proxyURL.String()
+}
 
-	// Dump request body
-	if len(reqBody) > 0 {
-		if _, err := f.Write(reqBody); err != nil {
-			c.l.Err("error writing http dump file %v: %v", fPath, err)
-			return
-		}
-	} else {
-		if _, err := f.Write([]byte("EMPTY BODY")); err != nil {
-			c.l.Err("error writing http dump file %v: %v", fPath, err)
-			return
-		}
-	}
-	if _, err := f.WriteString("\n"); err != nil {
-		c.l.Err("failed to write string: %s", err.Error())
-		return
-	}
+// proxyCtxKey is a context key of a proxy overriding the client's one
+type proxyCtxKey struct{}
 
-	// DoRequest and response separator
-	if _, err := f.WriteString("\n---\n\n"); err != nil {
-		c.l.Err("failed to write string: %s", err.Error())
-		return
-	}
+// proxyOverride is a proxy of a request, nil URL means direct connection
+type proxyOverride struct {
+	u *url.URL
+}
 
-	// Dump response headers
-	for k, h := range resp.Header {
-		for _, v := range h {
-			if _, err := f.Write([]byte(fmt.Sprintf("%v: %v\n", k, v))); err != nil {
-				c.l.Err("error writing http dump file %v: %v", fPath, err)
-				return
-			}
+// withProxy returns a context of requests going through a proxy instead of the client's one
+func withProxy(ctx context.Context, u string) (context.Context, error) {
+	var pURL *url.URL
+	if u != "" {
+		var err error
+		if pURL, err = url.Parse(u); err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %v", err)
 		}
 	}
-	if _, err := f.WriteString("\n"); err != nil {
-		c.l.Err("failed to write string: %s", err.Error())
-		return
+
+	return context.WithValue(ctx, proxyCtxKey{}, proxyOverride{pURL}), nil
+}
+
+// proxy returns proxy URL for a request
+func (c *Cli) proxy(req *http.Request) (*url.URL, error) {
+	if p, ok := req.Context().Value(proxyCtxKey{}).(proxyOverride); ok {
+		return p.u, nil
 	}
 
-	// Dump response body
-	if len(respBody) > 0 {
-		if _, err := f.Write(respBody); err != nil {
-			c.l.Err("error writing http dump file %v: %v", fPath, err)
-			return
-		}
-	} else {
-		if _, err := f.Write([]byte("EMPTY BODY")); err != nil {
-			c.l.Err("error writing http dump file %v: %v", fPath, err)
-			return
-		}
+	c.proxyMux.RLock()
+	defer c.proxyMux.RUnlock()
+
+	return c.proxyURL, nil
+}
+
+// SetMaxRetries sets maximum number of request retries
+func (c *Cli) SetMaxRetries(n int) {
+	c.maxRetries = n
+}
+
+// Reset resets the client: clears cookies and chooses a new browser profile if profile rotation is enabled
+func (c *Cli) Reset() error {
+	j, err := newRecordingJar()
+	if err != nil {
+		return err
 	}
+
+	c.cli.Jar = j
+
+	c.browser.mux.Lock()
+	c.browser.rotate()
+	c.browser.mux.Unlock()
+
+	return nil
 }
 
 func (c *Cli) newRequest(ctx context.Context, method, u string, header http.Header, body []byte) (*http.Request, error) {
@@ -242,20 +290,15 @@ func (c *Cli) newRequest(ctx context.Context, method, u string, header http.Head
 		header = http.Header{}
 	}
 
-	if header.Get("User-Agent") == "" {
-		header.Set("User-Agent", c.userAgent)
-	}
+	c.setProfileHeaders(header)
 
+	// Profiles may have no Accept header
 	if header.Get("Accept") == "" {
 		header.Set("Accept", "*/*")
 	}
 
-	if header.Get("Accept-Language") == "" {
-		header.Set("Accept-Language", "en-US,en;q=0.9,ru;q=0.8,uk;q=0.7")
-	}
-
-	if header.Get("Cache-Control") == "" {
-		header.Set("Cache-Control", "max-age=0")
+	if c.trace {
+		ctx = withTracer(ctx)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, method, u, strings.NewReader(string(body)))
@@ -264,16 +307,35 @@ func (c *Cli) newRequest(ctx context.Context, method, u string, header http.Head
 	}
 	req.Header = header
 
+	if len(body) > 0 && len(c.limiters(Upload, req.URL.Hostname())) > 0 {
+		req.Body = c.limitedBody(ctx, req.URL.Hostname(), body)
+		req.GetBody = func() (io.ReadCloser, error) {
+			return c.limitedBody(ctx, req.URL.Hostname(), body), nil
+		}
+	}
+
 	return req, nil
 }
 
-// DoRequest performs an HTTP request
+// DoRequest performs an HTTP request.
+//
+// If deduplication is enabled, concurrent identical requests share a single underlying request.
 func (c *Cli) DoRequest(
 	ctx context.Context,
 	method,
 	u string,
 	header http.Header,
 	body []byte,
+) (*http.Response, []byte, error) {
+	return c.doDedup(ctx, method, u, header, body)
+}
+
+func (c *Cli) doRequest(
+	ctx context.Context,
+	method,
+	u string,
+	header http.Header,
+	body []byte,
 ) (*http.Response, []byte, error) {
 	var (
 		err     error
@@ -282,11 +344,32 @@ func (c *Cli) DoRequest(
 		rspBody []byte
 	)
 
-	reqNum := c.reqNum
+	if c.idempotencyKeys && !IsIdempotent(method) && header.Get(IdempotencyKeyHeader) == "" {
+		key, err := NewIdempotencyKey()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate idempotency key: %v", err)
+		}
+
+		if header == nil {
+			header = http.Header{}
+		} else {
+			header = header.Clone()
+		}
+		header.Set(IdempotencyKeyHeader, key)
+	}
+
+	stream := isStream(ctx)
+	start := time.Now()
+	// Requests are numbered once, attempts are told apart by tryNum
+	reqNum := atomic.AddInt32(&c.reqNum, 1)
+	info := EventInfo{ReqNum: reqNum, Method: method, URL: u}
+	c.emit(RequestStartEvent{info})
+
 	tryNum := 1
 	for ; ; tryNum++ {
 		select {
 		case <-ctx.Done():
+			c.giveUp(info, ctx.Err(), start)
 			return nil, nil, ctx.Err()
 		default:
 			// While handling error, it's allowed to work only to error handler, others must wait
@@ -299,71 +382,217 @@ func (c *Cli) DoRequest(
 			}
 		}
 
-		reqNum = atomic.AddInt32(&c.reqNum, 1)
-
 		req, err = c.newRequest(ctx, method, u, header.Clone(), body)
 		if err != nil {
+			c.giveUp(info, err, start)
 			return nil, nil, err
 		}
 
-		rsp, err = c.cli.Do(req)
-		if err == nil && rsp.StatusCode > 199 && rsp.StatusCode < 300 {
+		info.TryNum = tryNum
+		info.Status = 0
+		info.Err = nil
+		info.Duration = 0
+		c.emit(AttemptEvent{info})
+
+		aStart := time.Now()
+		rsp, rspBody, err = c.attempt(req, body, tryNum, stream)
+		if rsp != nil {
+			info.Status = rsp.StatusCode
+		}
+		if err == nil {
+			if dErr := c.detect(req, rsp, rspBody); dErr != nil {
+				err = dErr
+			} else if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+				err = &StatusError{Status: rsp.Status, StatusCode: rsp.StatusCode, Header: rsp.Header, Body: rspBody}
+			} else if check := responseCheck(ctx); check != nil && !stream {
+				err = check(rsp, rspBody)
+			}
+		}
+		if rsp != nil && err != nil {
+			if sb, ok := rsp.Body.(*streamBody); ok {
+				_ = sb.Close()
+			}
+		}
+		info.Err = err
+		info.Duration = time.Since(aStart)
+		c.emit(ResponseEvent{info})
+
+		if err == nil {
 			break
-		} else if err == nil {
-			err = errors.New(rsp.Status)
 		}
 		c.l.Err("req #%d(%v): %v %v; error: %v", reqNum, tryNum, method, u, err)
+		c.l.Debug("req #%d(%v): %s", reqNum, tryNum, c.curlCommand(req, body, true))
 
-		if rsp != nil {
-			if rb, re := ioutil.ReadAll(rsp.Body); re == nil && c.dump {
-				c.DumpTransaction(req, rsp, body, rb, tryNum)
-			}
-			_ = rsp.Body.Close()
+		c.dumpTransaction(reqNum, req, rsp, body, rspBody, tryNum, err)
+
+		// Failures which can't be fixed by retrying
+		var permErr *permanentError
+		if errors.As(err, &permErr) {
+			c.giveUp(info, permErr.err, start)
+			return nil, nil, permErr.err
 		}
 
-		if c.errorHandler != nil {
+		decision := DecideRetry()
+		if c.recoveryHandler != nil {
 			if c.handlingError {
-				return nil, nil, fmt.Errorf("error is already being handled by another goroutine")
+				err = fmt.Errorf("error is already being handled by another goroutine")
+				c.giveUp(info, err, start)
+				return nil, nil, err
 			}
 
 			c.mux.Lock()
 			c.handlingError = true
-			hErr := c.errorHandler(context.WithValue(ctx, "errorHandler", true), c, req, rsp, err, tryNum)
+			c.Metrics().addErrorHandlerCall()
+			decision = c.recoveryHandler(handlerContext(ctx), c,
+				newFailure(reqNum, tryNum, req, rsp, rspBody, err))
 			c.handlingError = false
 			c.mux.Unlock()
-			if hErr != nil {
-				return nil, nil, fmt.Errorf("%v, %v", err, hErr)
+		}
+
+		// Non-idempotent requests are retried by default only if it's explicitly allowed
+		if decision.Action == Retry && !retryAllowed(ctx, method) {
+			c.l.Debug("req #%d(%v): %v %v; not retrying non-idempotent request", reqNum, tryNum, method, u)
+			c.giveUp(info, err, start)
+			return nil, nil, err
+		}
+
+		switch decision.Action {
+		case Abort:
+			if decision.Err != nil {
+				err = fmt.Errorf("%v, %w", err, decision.Err)
 			}
+			c.giveUp(info, err, start)
+			return nil, nil, err
+		case Skip:
+			err = fmt.Errorf("%w: %v", ErrSkipped, err)
+			c.giveUp(info, err, start)
+			return nil, nil, err
+		case RetryWithProxy:
+			pCtx, pErr := withProxy(ctx, decision.Proxy)
+			if pErr != nil {
+				err = fmt.Errorf("%v, %v", err, pErr)
+				c.giveUp(info, err, start)
+				return nil, nil, err
+			}
+			ctx = pCtx
 		}
 
-		if tryNum == c.maxRetries || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		var pinErr *PinError
+		if tryNum == c.maxRetries || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+			errors.As(err, &pinErr) {
+			c.giveUp(info, err, start)
 			return nil, nil, err
 		}
 
-		time.Sleep(time.Second * time.Duration(tryNum))
+		delay := c.backoff(tryNum)
+		switch decision.Action {
+		case RetryNow, RetryWithProxy:
+			delay = 0
+		case RetryAfter:
+			delay = decision.Delay
+		}
+
+		c.Metrics().addRetry(req.URL.Host)
+		c.emit(RetryScheduledEvent{info, delay})
+		if err := sleepCtx(ctx, delay); err != nil {
+			c.giveUp(info, err, start)
+			return nil, nil, err
+		}
 	}
 
-	c.l.Debug("req #%d(%v): %v %v; status: %v", reqNum, tryNum, method, u, rsp.Status)
+	if t, ok := TimingFromRequest(req); ok {
+		c.l.Debug("req #%d(%v): %v %v; status: %v; timing: %v", reqNum, tryNum, method, u, rsp.Status, t)
+	} else {
+		c.l.Debug("req #%d(%v): %v %v; status: %v", reqNum, tryNum, method, u, rsp.Status)
+	}
 
-	defer func() {
-		_ = rsp.Body.Close()
-	}()
-	if rspBody, err = ioutil.ReadAll(rsp.Body); err != nil {
-		return rsp, nil, fmt.Errorf("error while reading response body: %v", err)
+	if !stream {
+		c.dumpTransaction(reqNum, req, rsp, body, rspBody, tryNum, nil)
 	}
 
-	if c.dump {
-		c.DumpTransaction(req, rsp, body, rspBody, tryNum)
+	info.Duration = time.Since(start)
+	c.emit(SuccessEvent{info})
+
+	return rsp, rspBody, nil
+}
+
+// giveUp emits an event about failed request
+func (c *Cli) giveUp(info EventInfo, err error, start time.Time) {
+	info.Err = err
+	info.Duration = time.Since(start)
+	c.emit(GiveUpEvent{info})
+}
+
+// backoff returns a delay before the next attempt
+func (c *Cli) backoff(tryNum int) time.Duration {
+	return time.Second * time.Duration(tryNum)
+}
+
+// attempt performs a single request attempt and reads the response body.
+//
+// If stream is true, body of a successful response is left open and wrapped into a streamBody.
+func (c *Cli) attempt(req *http.Request, body []byte, tryNum int, stream bool) (*http.Response, []byte, error) {
+	start := time.Now()
+
+	// The collector may be replaced during the attempt, its metrics must go to the same one
+	m := c.Metrics()
+	m.incInFlight()
+
+	c.trMux.RLock()
+	hc := *c.cli
+	c.trMux.RUnlock()
+	if stream {
+		// Streams may last longer than the client's timeout, they are limited by the request context only
+		hc.Timeout = 0
+	}
+
+	rsp, err := hc.Do(req)
+	if err == nil {
+		if err = c.checkPins(rsp); err != nil {
+			_ = rsp.Body.Close()
+			rsp = nil
+		}
+	}
+
+	if err == nil && stream && rsp.StatusCode >= 200 && rsp.StatusCode <= 299 {
+		if err = c.streamBody(m, req, rsp, len(body), tryNum, start); err == nil {
+			return rsp, nil, nil
+		}
 	}
 
-	// Check response status
-	if rsp.StatusCode >= 400 {
-		return rsp, rspBody, fmt.Errorf("HTTP response status: %v", rsp.Status)
+	var rspBody []byte
+	if err == nil {
+		rspBody, err = ioutil.ReadAll(c.limitReader(req.Context(), Download, req.URL.Hostname(), rsp.Body))
+		_ = rsp.Body.Close()
+		if err != nil {
+			err = fmt.Errorf("error while reading response body: %v", err)
+		} else {
+			rspBody, err = decodeBody(rsp, rspBody)
+		}
 	}
 
+	c.finishAttempt(m, req, rsp, err, tryNum, len(body), len(rspBody), start)
+
 	return rsp, rspBody, err
 }
 
+// finishAttempt finishes tracing and records metrics of a request attempt
+func (c *Cli) finishAttempt(
+	m *Metrics,
+	req *http.Request,
+	rsp *http.Response,
+	err error,
+	tryNum, reqLen, rspLen int,
+	start time.Time,
+) {
+	if tr, ok := req.Context().Value(tracerCtxKey{}).(*tracer); ok {
+		tr.finish()
+	}
+
+	m.decInFlight()
+	m.observe(req.URL.Host, req.Method, rsp, err, tryNum, reqLen, rspLen, time.Since(start))
+}
+
 // Get perform a GET request
 func (c *Cli) Get(ctx context.Context, u string, args url.Values, header http.Header) ([]byte, error) {
 	if args != nil {
@@ -374,9 +603,15 @@ func (c *Cli) Get(ctx context.Context, u string, args url.Values, header http.He
 	return body, err
 }
 
-// GetQueryDoc performs a GET request and transform response into a goquery document
+// GetQueryDoc performs a GET request and transform response into a goquery document.
+//
+// Document's Url is the final URL of the request, so relative URLs of the document can be resolved against it.
 func (c *Cli) GetQueryDoc(ctx context.Context, u string, args url.Values, header http.Header) (*goquery.Document, error) {
-	body, err := c.Get(ctx, u, args, header)
+	if args != nil {
+		u = util.CombineURL(u, "", args)
+	}
+
+	rsp, body, err := c.DoRequest(ctx, "GET", u, header, []byte(""))
 	if err != nil {
 		return nil, err
 	}
@@ -386,24 +621,26 @@ func (c *Cli) GetQueryDoc(ctx context.Context, u string, args url.Values, header
 		return nil, err
 	}
 
+	if rsp.Request != nil {
+		doc.Url = rsp.Request.URL
+	}
+
 	return doc, nil
 }
 
-// GetJSON performs a GET HTTP request and parses the response into a JSON
+// GetJSON performs a GET HTTP request and parses the response into a JSON.
+//
+// Responses failing validation are retried. A *DecodeError is returned if the response cannot be decoded or validated.
 func (c *Cli) GetJSON(ctx context.Context, u string, args url.Values, header http.Header, target interface{}) error {
-	if header == nil {
-		header = http.Header{}
-	}
-	if header.Get("X-Requested-With") == "" {
-		header.Set("X-Requested-With", "XMLHttpRequest")
-	}
+	header = jsonRequestHeader(header)
 
-	body, err := c.Get(ctx, u, args, header)
-	if err != nil {
-		return err
+	if args != nil {
+		u = util.CombineURL(u, "", args)
 	}
 
-	return json.Unmarshal(body, target)
+	return c.doJSON(ctx, target, func(ctx context.Context) (*http.Response, []byte, error) {
+		return c.DoRequest(ctx, "GET", u, header, []byte(""))
+	})
 }
 
 // GetFile gets a file and stores it on the disk.
@@ -456,7 +693,9 @@ func (c *Cli) GetFile(ctx context.Context, u string, args url.Values, header htt
 	return fExt, nil
 }
 
-// Post performs a POST request
+// Post performs a POST request.
+//
+// Failed POST requests are not retried unless ctx is wrapped with AllowRetry.
 func (c *Cli) Post(ctx context.Context, u string, header http.Header, body []byte) ([]byte, error) {
 	if header == nil {
 		header = http.Header{}
@@ -479,12 +718,11 @@ func (c *Cli) PostForm(ctx context.Context, u string, args url.Values, header ht
 
 // PostJSON posts a JSON request
 func (c *Cli) PostJSON(ctx context.Context, u string, header http.Header, data interface{}) ([]byte, error) {
-	if header == nil {
-		header = http.Header{}
+	header = jsonRequestHeader(header)
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/json")
 	}
 
-	header.Add("Content-Type", "application/json")
-
 	dataB, err := json.Marshal(data)
 	if err != nil {
 		return nil, err
@@ -493,52 +731,53 @@ func (c *Cli) PostJSON(ctx context.Context, u string, header http.Header, data i
 	return c.Post(ctx, u, header, dataB)
 }
 
-// PostFormParseJSON performs a POST request and parses JSON response
+// PostFormParseJSON performs a POST request and parses JSON response.
+//
+// The response is decoded and validated like GetJSON does.
 func (c *Cli) PostFormParseJSON(ctx context.Context, u string, args url.Values, header http.Header, target interface{}) error {
-	if header == nil {
-		header = http.Header{}
-	}
-
-	resp, err := c.PostForm(ctx, u, args, header)
-	if err != nil {
-		return err
-	}
+	header = jsonRequestHeader(header)
 
-	return json.Unmarshal(resp, target)
+	return c.doJSON(ctx, target, func(ctx context.Context) (*http.Response, []byte, error) {
+		b, err := c.PostForm(ctx, u, args, header)
+		return nil, b, err
+	})
 }
 
-// PostJSONParseJSON performs a POST request having JSON body and parses JSON response
+// PostJSONParseJSON performs a POST request having JSON body and parses JSON response.
+//
+// The response is decoded and validated like GetJSON does.
 func (c *Cli) PostJSONParseJSON(ctx context.Context, u string, data interface{}, header http.Header, target interface{}) error {
-	if header == nil {
-		header = http.Header{}
-	}
-
-	if header.Get("Content-Type") == "" {
-		header.Add("Content-Type", "application/json")
-	}
-
-	resp, err := c.PostJSON(ctx, u, header, data)
-	if err != nil {
-		return err
-	}
-
-	return json.Unmarshal(resp, target)
+	return c.doJSON(ctx, target, func(ctx context.Context) (*http.Response, []byte, error) {
+		b, err := c.PostJSON(ctx, u, header, data)
+		return nil, b, err
+	})
 }
 
+// DefaultIPInfoURL is a base URL of a service telling client's external IP address
+const DefaultIPInfoURL = "https://ifconfig.io"
+
 // GetExtIPAddrInfo returns information about client's external IP address
 func (c *Cli) GetExtIPAddrInfo(ctx context.Context) (string, error) {
+	return c.GetExtIPAddrInfoFrom(ctx, DefaultIPInfoURL)
+}
+
+// GetExtIPAddrInfoFrom returns information about client's external IP address using an ifconfig.io compatible service
+// at baseURL, which serves the address at /ip and its country code at /country_code
+func (c *Cli) GetExtIPAddrInfoFrom(ctx context.Context, baseURL string) (string, error) {
 	var (
 		b   []byte
 		r   string
 		err error
 	)
 
-	if b, err = c.Get(ctx, "https://ifconfig.io/ip", nil, nil); err != nil {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	if b, err = c.Get(ctx, baseURL+"/ip", nil, nil); err != nil {
 		return r, err
 	}
 	r += fmt.Sprintf("address: %s", b)
 
-	if b, err = c.Get(ctx, "https://ifconfig.io/country_code", nil, nil); err != nil {
+	if b, err = c.Get(ctx, baseURL+"/country_code", nil, nil); err != nil {
 		return r, err
 	}
 	r = fmt.Sprintf("%v, region: %s", r, b)
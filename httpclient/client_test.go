@@ -0,0 +1,54 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ashep/aghpu/logger"
+)
+
+// newTestCli creates a client with logging disabled and quick retries
+func newTestCli(t *testing.T) *Cli {
+	t.Helper()
+
+	l, err := logger.New("test", logger.LvDisabled, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New("test", "", "", "", false, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetMaxRetries(2)
+
+	return c
+}
+
+func TestGetQueryDocURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new/page?q=1", http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte(`<html><body><a href="img.png">img</a></body></html>`))
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	doc, err := c.GetQueryDoc(context.Background(), srv.URL+"/old", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Url == nil || doc.Url.String() != srv.URL+"/new/page?q=1" {
+		t.Fatalf("got document URL %v", doc.Url)
+	}
+	ref, _ := url.Parse(doc.Find("a").AttrOr("href", ""))
+	if got := doc.Url.ResolveReference(ref).String(); got != srv.URL+"/new/img.png" {
+		t.Errorf("got resolved URL %s", got)
+	}
+}
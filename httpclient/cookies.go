@@ -0,0 +1,104 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// CookieSet is a set of cookies keyed by URL they were set by
+type CookieSet map[string][]*http.Cookie
+
+// recordingJar is a cookie jar which remembers received cookies, so they can be exported
+type recordingJar struct {
+	*cookiejar.Jar
+
+	mux     sync.Mutex
+	cookies map[string]map[string]*http.Cookie
+}
+
+// newRecordingJar creates a new recording cookie jar
+func newRecordingJar() (*recordingJar, error) {
+	j, err := cookiejar.New(&cookiejar.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &recordingJar{Jar: j, cookies: make(map[string]map[string]*http.Cookie)}, nil
+}
+
+// SetCookies implements http.CookieJar
+func (j *recordingJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.Jar.SetCookies(u, cookies)
+
+	origin := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}).String()
+
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	if j.cookies[origin] == nil {
+		j.cookies[origin] = make(map[string]*http.Cookie)
+	}
+
+	for _, c := range cookies {
+		c := *c
+		key := c.Name + ";" + c.Domain + ";" + c.Path
+
+		// Make expiration absolute, so the cookie may be imported later
+		if c.MaxAge > 0 {
+			c.Expires = time.Now().Add(time.Duration(c.MaxAge) * time.Second)
+			c.MaxAge = 0
+		}
+
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(time.Now())) {
+			delete(j.cookies[origin], key)
+			continue
+		}
+
+		j.cookies[origin][key] = &c
+	}
+}
+
+// export returns recorded cookies which are not expired
+func (j *recordingJar) export() CookieSet {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	r := make(CookieSet)
+	now := time.Now()
+	for origin, cookies := range j.cookies {
+		for _, c := range cookies {
+			if !c.Expires.IsZero() && c.Expires.Before(now) {
+				continue
+			}
+			cc := *c
+			r[origin] = append(r[origin], &cc)
+		}
+	}
+
+	return r
+}
+
+// ExportCookies returns cookies received by the client
+func (c *Cli) ExportCookies() CookieSet {
+	if j, ok := c.cli.Jar.(*recordingJar); ok {
+		return j.export()
+	}
+
+	return CookieSet{}
+}
+
+// ImportCookies adds cookies to the client's jar
+func (c *Cli) ImportCookies(set CookieSet) error {
+	for rawURL, cookies := range set {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return err
+		}
+		c.cli.Jar.SetCookies(u, cookies)
+	}
+
+	return nil
+}
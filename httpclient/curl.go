@@ -0,0 +1,487 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// CurlRequest is a request parsed from a curl command line
+type CurlRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+// CurlCommand renders a request as a curl command line.
+//
+// Headers are rendered in order of the current browser profile, cookies are taken from the client's jar
+// unless the request already has a Cookie header.
+func (c *Cli) CurlCommand(req *http.Request, body []byte) string {
+	return c.curlCommand(req, body, false)
+}
+
+// curlCommand renders a request as a curl command line, optionally redacting it the way dumps are redacted
+func (c *Cli) curlCommand(req *http.Request, body []byte, redact bool) string {
+	header := req.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	if header.Get("Cookie") == "" && c.cli.Jar != nil {
+		var cs []string
+		for _, ck := range c.cli.Jar.Cookies(req.URL) {
+			cs = append(cs, ck.Name+"="+ck.Value)
+		}
+		if len(cs) > 0 {
+			header.Set("Cookie", strings.Join(cs, "; "))
+		}
+	}
+
+	if redact {
+		header = c.redactHeader(header)
+		body = c.redactBody(body)
+	}
+
+	buf := bytes.NewBufferString("curl")
+	if req.Method != http.MethodGet || len(body) > 0 {
+		if req.Method == http.MethodHead {
+			buf.WriteString(" -I")
+		} else {
+			buf.WriteString(" -X " + req.Method)
+		}
+	}
+	buf.WriteString(" " + shellQuote(req.URL.String()))
+
+	// Headers of the profile go first in the profile's order
+	written := make(map[string]bool)
+	order := append(c.Profile().HeaderOrder(), sortedHeaderKeys(header)...)
+	for _, k := range order {
+		k = http.CanonicalHeaderKey(k)
+		if written[k] {
+			continue
+		}
+		written[k] = true
+
+		for _, v := range header[k] {
+			buf.WriteString(" -H " + shellQuote(k+": "+v))
+		}
+	}
+
+	if len(body) > 0 {
+		buf.WriteString(" --data-raw " + shellQuote(string(body)))
+	}
+
+	if enc := header.Get("Accept-Encoding"); enc != "" {
+		buf.WriteString(" --compressed")
+	}
+
+	return buf.String()
+}
+
+// sortedHeaderKeys returns header keys in alphabetical order
+func sortedHeaderKeys(h http.Header) []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// shellQuote quotes a string for POSIX shells
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@%+,", r))
+	}) < 0 {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// DoCurl performs a request parsed from a curl command line
+func (c *Cli) DoCurl(ctx context.Context, cmd string) (*http.Response, []byte, error) {
+	r, err := ParseCurl(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c.DoRequest(ctx, r.Method, r.URL, r.Header, r.Body)
+}
+
+// ParseCurl parses a curl command line, e.g. copied from browser developer tools
+func ParseCurl(cmd string) (*CurlRequest, error) {
+	args, err := splitShell(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 0 || args[0] != "curl" {
+		return nil, fmt.Errorf("not a curl command")
+	}
+	args = args[1:]
+
+	r := &CurlRequest{Header: http.Header{}}
+	var (
+		data    []string
+		getData bool
+		method  string
+	)
+
+	noArg := map[string]bool{
+		"--compressed": true, "-L": true, "--location": true, "-k": true, "--insecure": true,
+		"-s": true, "--silent": true, "-S": true, "--show-error": true, "-i": true, "--include": true,
+		"-v": true, "--verbose": true, "-g": true, "--globoff": true, "-f": true, "--fail": true,
+		"-N": true, "--no-buffer": true, "--http1.1": true, "--http2": true, "--http2-prior-knowledge": true,
+	}
+	ignoredArg := map[string]bool{
+		"-o": true, "--output": true, "-m": true, "--max-time": true, "--connect-timeout": true,
+		"--retry": true, "-x": true, "--proxy": true, "-w": true, "--write-out": true,
+	}
+	shortWithArg := "XHdbAeuox"
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		// Positional argument is the URL
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			r.URL = arg
+			continue
+		}
+
+		// Split option and its value
+		opt, val, hasVal := arg, "", false
+		if strings.HasPrefix(arg, "--") {
+			if j := strings.Index(arg, "="); j > 0 {
+				opt, val, hasVal = arg[:j], arg[j+1:], true
+			}
+		} else if len(arg) > 2 {
+			if strings.ContainsRune(shortWithArg, rune(arg[1])) {
+				opt, val, hasVal = arg[:2], arg[2:], true
+			} else {
+				// Combined short options like -sSL
+				for _, ch := range arg[1:] {
+					if !noArg["-"+string(ch)] {
+						return nil, fmt.Errorf("unsupported curl option: %s", arg)
+					}
+				}
+				continue
+			}
+		}
+
+		if noArg[opt] {
+			continue
+		}
+
+		value := func() (string, error) {
+			if hasVal {
+				return val, nil
+			}
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("curl option %s requires a value", opt)
+			}
+			i++
+			return args[i], nil
+		}
+
+		switch opt {
+		case "-X", "--request":
+			if method, err = value(); err != nil {
+				return nil, err
+			}
+		case "-H", "--header":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			j := strings.Index(v, ":")
+			if j <= 0 {
+				return nil, fmt.Errorf("invalid header: %q", v)
+			}
+			r.Header.Add(strings.TrimSpace(v[:j]), strings.TrimSpace(v[j+1:]))
+		case "-d", "--data", "--data-ascii", "--data-binary":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			if strings.HasPrefix(v, "@") {
+				b, err := ioutil.ReadFile(v[1:])
+				if err != nil {
+					return nil, err
+				}
+				v = string(b)
+				if opt != "--data-binary" {
+					v = strings.NewReplacer("\r", "", "\n", "").Replace(v)
+				}
+			}
+			data = append(data, v)
+		case "--data-raw":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, v)
+		case "--data-urlencode":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			if j := strings.Index(v, "="); j >= 0 {
+				v = v[:j+1] + url.QueryEscape(v[j+1:])
+			} else {
+				v = url.QueryEscape(v)
+			}
+			data = append(data, v)
+		case "--json":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, v)
+			if r.Header.Get("Content-Type") == "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			if r.Header.Get("Accept") == "" {
+				r.Header.Set("Accept", "application/json")
+			}
+		case "-b", "--cookie":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			if !strings.Contains(v, "=") {
+				return nil, fmt.Errorf("cookie files are not supported: %s", v)
+			}
+			r.Header.Add("Cookie", v)
+		case "-A", "--user-agent":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			r.Header.Set("User-Agent", v)
+		case "-e", "--referer":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			r.Header.Set("Referer", v)
+		case "-u", "--user":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			r.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(v)))
+		case "--url":
+			if r.URL, err = value(); err != nil {
+				return nil, err
+			}
+		case "-G", "--get":
+			getData = true
+		case "-I", "--head":
+			method = http.MethodHead
+		default:
+			if ignoredArg[opt] {
+				if _, err := value(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, fmt.Errorf("unsupported curl option: %s", opt)
+		}
+	}
+
+	if r.URL == "" {
+		return nil, fmt.Errorf("no URL in curl command")
+	}
+
+	if len(data) > 0 {
+		joined := strings.Join(data, "&")
+		if getData {
+			u, err := url.Parse(r.URL)
+			if err != nil {
+				return nil, err
+			}
+			if u.RawQuery != "" {
+				u.RawQuery += "&"
+			}
+			u.RawQuery += joined
+			r.URL = u.String()
+		} else {
+			r.Body = []byte(joined)
+			if method == "" {
+				method = http.MethodPost
+			}
+			if r.Header.Get("Content-Type") == "" {
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+		}
+	}
+
+	if method == "" {
+		method = http.MethodGet
+	}
+	r.Method = method
+
+	return r, nil
+}
+
+// splitShell splits a command line into arguments the way POSIX shells do.
+//
+// It supports single, double and ANSI-C ($'...') quoting, backslash escapes and line continuations.
+func splitShell(s string) ([]string, error) {
+	var (
+		args    []string
+		cur     strings.Builder
+		inArg   bool
+		runes   = []rune(s)
+		n       = len(runes)
+		isSpace = func(r rune) bool { return r == ' ' || r == '\t' || r == '\n' || r == '\r' }
+	)
+
+	for i := 0; i < n; i++ {
+		r := runes[i]
+
+		switch {
+		case isSpace(r):
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+
+		case r == '\\':
+			if i+1 < n && runes[i+1] == '\n' {
+				i++
+				continue
+			}
+			if i+2 < n && runes[i+1] == '\r' && runes[i+2] == '\n' {
+				i += 2
+				continue
+			}
+			if i+1 < n {
+				i++
+				cur.WriteRune(runes[i])
+			}
+			inArg = true
+
+		case r == '\'':
+			inArg = true
+			j := i + 1
+			for j < n && runes[j] != '\'' {
+				j++
+			}
+			if j >= n {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			cur.WriteString(string(runes[i+1 : j]))
+			i = j
+
+		case r == '$' && i+1 < n && runes[i+1] == '\'':
+			inArg = true
+			j, err := ansiCQuoted(runes, i+2, &cur)
+			if err != nil {
+				return nil, err
+			}
+			i = j
+
+		case r == '"':
+			inArg = true
+			j := i + 1
+			for ; j < n && runes[j] != '"'; j++ {
+				if runes[j] == '\\' && j+1 < n && strings.ContainsRune("\"\\$`\n", runes[j+1]) {
+					j++
+					if runes[j] == '\n' {
+						continue
+					}
+				}
+				cur.WriteRune(runes[j])
+			}
+			if j >= n {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			i = j
+
+		default:
+			inArg = true
+			cur.WriteRune(r)
+		}
+	}
+
+	if inArg {
+		args = append(args, cur.String())
+	}
+
+	return args, nil
+}
+
+// ansiCQuoted decodes $'...' string content starting at i and returns position of the closing quote
+func ansiCQuoted(runes []rune, i int, cur *strings.Builder) (int, error) {
+	n := len(runes)
+	var raw []byte
+
+	flush := func() {
+		if len(raw) > 0 {
+			cur.Write(raw)
+			raw = raw[:0]
+		}
+	}
+
+	for ; i < n; i++ {
+		r := runes[i]
+		if r == '\'' {
+			flush()
+			return i, nil
+		}
+		if r != '\\' || i+1 >= n {
+			flush()
+			cur.WriteRune(r)
+			continue
+		}
+
+		i++
+		switch e := runes[i]; e {
+		case 'n':
+			raw = append(raw, '\n')
+		case 't':
+			raw = append(raw, '\t')
+		case 'r':
+			raw = append(raw, '\r')
+		case '0':
+			raw = append(raw, 0)
+		case '\\', '\'', '"', '?':
+			raw = append(raw, byte(e))
+		case 'x', 'u', 'U':
+			size := map[rune]int{'x': 2, 'u': 4, 'U': 8}[e]
+			j := i + 1
+			for j < n && j-i-1 < size && strings.ContainsRune("0123456789abcdefABCDEF", runes[j]) {
+				j++
+			}
+			v, err := strconv.ParseUint(string(runes[i+1:j]), 16, 32)
+			if err != nil {
+				return 0, fmt.Errorf("invalid escape sequence in $'...' string")
+			}
+			if e == 'x' {
+				raw = append(raw, byte(v))
+			} else {
+				b := make([]byte, utf8.UTFMax)
+				raw = append(raw, b[:utf8.EncodeRune(b, rune(v))]...)
+			}
+			i = j - 1
+		default:
+			raw = append(raw, '\\', byte(e))
+		}
+	}
+
+	return 0, fmt.Errorf("unterminated $'...' string")
+}
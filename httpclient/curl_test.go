@@ -0,0 +1,166 @@
+package httpclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitShell(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"curl a b", []string{"curl", "a", "b"}},
+		{`curl 'a b' "c d"`, []string{"curl", "a b", "c d"}},
+		{`curl 'it'\''s'`, []string{"curl", "it's"}},
+		{`curl "say \"hi\" \$x"`, []string{"curl", `say "hi" $x`}},
+		{`curl $'a\nb\t\'c\''`, []string{"curl", "a\nb\t'c'"}},
+		{"curl a \\\n  b", []string{"curl", "a", "b"}},
+		{`curl a\ b ''`, []string{"curl", "a b", ""}},
+	}
+
+	for _, tt := range tests {
+		got, err := splitShell(tt.in)
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{`curl 'a`, `curl "a`} {
+		if _, err := splitShell(in); err == nil {
+			t.Errorf("%q: no error", in)
+		}
+	}
+}
+
+func TestParseCurl(t *testing.T) {
+	tests := []struct {
+		cmd    string
+		method string
+		url    string
+		header http.Header
+		body   string
+	}{
+		{
+			cmd:    `curl 'https://example.com/a' -H 'Accept: text/html' -H 'X-A: 1' --compressed -sSL`,
+			method: "GET",
+			url:    "https://example.com/a",
+			header: http.Header{"Accept": {"text/html"}, "X-A": {"1"}},
+		},
+		{
+			cmd:    `curl -X PUT https://example.com -d a=1 --data-raw 'b=2&c' --data-urlencode 'q=x y'`,
+			method: "PUT",
+			url:    "https://example.com",
+			header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+			body:   "a=1&b=2&c&q=x+y",
+		},
+		{
+			cmd:    `curl https://example.com?x=1 -G -d a=1 -d b=2`,
+			method: "GET",
+			url:    "https://example.com?x=1&a=1&b=2",
+			header: http.Header{},
+		},
+		{
+			cmd:    `curl --url https://example.com --json '{"a":1}' -A agent -e https://ref -u user:pass -b 'k=v'`,
+			method: "POST",
+			url:    "https://example.com",
+			header: http.Header{
+				"Content-Type":  {"application/json"},
+				"Accept":        {"application/json"},
+				"User-Agent":    {"agent"},
+				"Referer":       {"https://ref"},
+				"Authorization": {"Basic dXNlcjpwYXNz"},
+				"Cookie":        {"k=v"},
+			},
+			body: `{"a":1}`,
+		},
+		{
+			cmd:    `curl -I -HX-A:1 -o out --max-time=5 https://example.com`,
+			method: "HEAD",
+			url:    "https://example.com",
+			header: http.Header{"X-A": {"1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseCurl(tt.cmd)
+		if err != nil {
+			t.Errorf("%s: %v", tt.cmd, err)
+			continue
+		}
+		if r.Method != tt.method || r.URL != tt.url || string(r.Body) != tt.body {
+			t.Errorf("%s: got %s %s %q", tt.cmd, r.Method, r.URL, r.Body)
+		}
+		if !reflect.DeepEqual(r.Header, tt.header) {
+			t.Errorf("%s: got header %v, want %v", tt.cmd, r.Header, tt.header)
+		}
+	}
+
+	for _, cmd := range []string{
+		"wget https://example.com",
+		"curl -H 'X: 1'",
+		"curl https://example.com --frobnicate",
+		"curl https://example.com -H nocolon",
+		"curl https://example.com -b cookies.txt",
+		"curl https://example.com -H",
+		"curl https://example.com -sZ",
+	} {
+		if _, err := ParseCurl(cmd); err == nil {
+			t.Errorf("%s: no error", cmd)
+		}
+	}
+}
+
+func TestCurlCommandRoundTrip(t *testing.T) {
+	c := newTestCli(t)
+
+	req, err := http.NewRequest(http.MethodPost, "https://example.com/path?q=it's", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Custom", `a "quoted" value`)
+	req.Header.Set("Content-Type", "application/json")
+	body := []byte(`{"name":"O'Brien"}`)
+
+	cmd := c.CurlCommand(req, body)
+	if !strings.HasPrefix(cmd, "curl -X POST ") {
+		t.Errorf("got %s", cmd)
+	}
+
+	r, err := ParseCurl(cmd)
+	if err != nil {
+		t.Fatalf("%s: %v", cmd, err)
+	}
+	if r.Method != http.MethodPost || r.URL != req.URL.String() || string(r.Body) != string(body) {
+		t.Errorf("got %s %s %q", r.Method, r.URL, r.Body)
+	}
+	if r.Header.Get("X-Custom") != `a "quoted" value` || r.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("got header %v", r.Header)
+	}
+}
+
+func TestDoCurl(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		_, _ = w.Write([]byte(r.Method + " " + r.Header.Get("X-A") + " " + string(b)))
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	_, body, err := c.DoCurl(context.Background(), "curl "+srv.URL+" -X PATCH -H 'X-A: 1' --data-raw x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "PATCH 1 x" {
+		t.Errorf("got %q", body)
+	}
+}
@@ -0,0 +1,295 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrHTMLResponse is a DecodeError cause when an HTML page is received instead of JSON
+	ErrHTMLResponse = errors.New("HTML response")
+
+	// ErrUnexpectedContentType is a DecodeError cause when a response content type is not allowed
+	ErrUnexpectedContentType = errors.New("unexpected content type")
+)
+
+// DefaultJSONContentTypes are content types of JSON responses allowed by default.
+// Responses without Content-Type are always allowed.
+var DefaultJSONContentTypes = []string{
+	"application/json",
+	"text/json",
+	"application/javascript",
+	"text/javascript",
+	"text/plain",
+}
+
+// excerptSize is a maximum size of a body excerpt in DecodeError
+const excerptSize = 256
+
+// DecodeError is an error of decoding a JSON response
+type DecodeError struct {
+	URL         string
+	Status      int
+	ContentType string
+	Excerpt     string // beginning of the body
+	Err         error
+}
+
+// Error implements error
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode JSON response of %s (status %d, content type %q): %v; body: %q",
+		e.URL, e.Status, e.ContentType, e.Err, e.Excerpt)
+}
+
+// Unwrap returns the cause
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is a DecodeError cause when a decoded response fails validation
+type ValidationError struct {
+	Err error
+}
+
+// Error implements error
+func (e *ValidationError) Error() string {
+	return "validation failed: " + e.Err.Error()
+}
+
+// Unwrap returns the cause
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// permanentError is an error of a response check or decoding which must not be retried
+type permanentError struct {
+	err error
+}
+
+// Error implements error
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the cause
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Validator is implemented by JSON targets which can validate themselves after decoding
+type Validator interface {
+	Validate() error
+}
+
+// ValidateFunc validates a decoded JSON target
+type ValidateFunc func(target interface{}) error
+
+// JSONOptions are options of JSON response decoding
+type JSONOptions struct {
+	ContentTypes          []string // allowed content types, DefaultJSONContentTypes if empty; "+json" suffixes are always allowed
+	DisallowUnknownFields bool     // fail on object keys which don't match target fields
+}
+
+// SetJSONOptions sets options of JSON response decoding
+func (c *Cli) SetJSONOptions(o JSONOptions) {
+	c.jsonOpts = o
+}
+
+// ResponseCheck checks a successful response. A non-nil error makes the attempt fail.
+type ResponseCheck func(rsp *http.Response, body []byte) error
+
+// responseCheckCtxKey is a context key of a response check
+type responseCheckCtxKey struct{}
+
+// WithResponseCheck returns a context making requests check successful responses with fn,
+// so invalid responses are handled as failures and may be retried.
+//
+// Requests having a response check are not deduplicated.
+func WithResponseCheck(ctx context.Context, fn ResponseCheck) context.Context {
+	if prev := responseCheck(ctx); prev != nil {
+		next := fn
+		fn = func(rsp *http.Response, body []byte) error {
+			if err := prev(rsp, body); err != nil {
+				return err
+			}
+			return next(rsp, body)
+		}
+	}
+
+	return context.WithValue(ctx, responseCheckCtxKey{}, fn)
+}
+
+// responseCheck returns a response check of a context
+func responseCheck(ctx context.Context) ResponseCheck {
+	fn, _ := ctx.Value(responseCheckCtxKey{}).(ResponseCheck)
+	return fn
+}
+
+// validateFuncCtxKey is a context key of a JSON validation function
+type validateFuncCtxKey struct{}
+
+// WithJSONValidator returns a context making JSON helpers validate decoded targets with fn
+func WithJSONValidator(ctx context.Context, fn ValidateFunc) context.Context {
+	return context.WithValue(ctx, validateFuncCtxKey{}, fn)
+}
+
+// decodeJSON decodes and validates a JSON response
+func (c *Cli) decodeJSON(ctx context.Context, rsp *http.Response, body []byte, target interface{}) error {
+	dErr := &DecodeError{Excerpt: excerpt(body)}
+	if rsp != nil {
+		dErr.Status = rsp.StatusCode
+		dErr.ContentType = rsp.Header.Get("Content-Type")
+		if rsp.Request != nil {
+			dErr.URL = rsp.Request.URL.String()
+		}
+	}
+
+	if isHTML(dErr.ContentType, body) {
+		dErr.Err = ErrHTMLResponse
+		return dErr
+	}
+
+	if !c.jsonContentTypeAllowed(dErr.ContentType) {
+		dErr.Err = ErrUnexpectedContentType
+		return dErr
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if c.jsonOpts.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(target); err != nil {
+		dErr.Err = err
+		return dErr
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		dErr.Err = errors.New("unexpected data after top-level value")
+		return dErr
+	}
+
+	if v, ok := target.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			dErr.Err = &ValidationError{Err: err}
+			return dErr
+		}
+	}
+
+	if fn, ok := ctx.Value(validateFuncCtxKey{}).(ValidateFunc); ok && fn != nil {
+		if err := fn(target); err != nil {
+			dErr.Err = &ValidationError{Err: err}
+			return dErr
+		}
+	}
+
+	return nil
+}
+
+// jsonContentTypeAllowed reports whether a content type is allowed for JSON responses
+func (c *Cli) jsonContentTypeAllowed(ct string) bool {
+	if ct == "" {
+		return true
+	}
+
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	if strings.HasSuffix(mt, "+json") {
+		return true
+	}
+
+	allowed := c.jsonOpts.ContentTypes
+	if len(allowed) == 0 {
+		allowed = DefaultJSONContentTypes
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(mt, a) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isHTML reports whether a response is an HTML document
+func isHTML(ct string, body []byte) bool {
+	if mt, _, err := mime.ParseMediaType(ct); err == nil && (mt == "text/html" || mt == "application/xhtml+xml") {
+		return true
+	}
+
+	b := bytes.TrimLeft(body, " \t\r\n\ufeff")
+	return len(b) > 0 && b[0] == '<'
+}
+
+// excerpt returns the beginning of a body
+func excerpt(body []byte) string {
+	b := bytes.TrimSpace(body)
+	if len(b) <= excerptSize {
+		return string(b)
+	}
+
+	b = b[:excerptSize]
+	for len(b) > 0 && !utf8.Valid(b) {
+		b = b[:len(b)-1]
+	}
+
+	return string(b) + "..."
+}
+
+// doJSON performs a request by do and decodes its JSON response into target.
+//
+// The response is decoded and validated within the request's retry loop, so responses failing validation are retried.
+// Responses which cannot be decoded fail at once. Target is replaced with the decoded value only if the request succeeds.
+func (c *Cli) doJSON(
+	ctx context.Context,
+	target interface{},
+	do func(ctx context.Context) (*http.Response, []byte, error),
+) error {
+	tv := reflect.ValueOf(target)
+	if tv.Kind() != reflect.Ptr || tv.IsNil() {
+		return &json.InvalidUnmarshalError{Type: reflect.TypeOf(target)}
+	}
+
+	// Every attempt decodes into a new value, so a failed attempt doesn't leave garbage in the target,
+	// even if it's a map or contains pointers
+	var decoded reflect.Value
+	check := func(rsp *http.Response, body []byte) error {
+		v := reflect.New(tv.Elem().Type())
+		if err := c.decodeJSON(ctx, rsp, body, v.Interface()); err != nil {
+			var vErr *ValidationError
+			if !errors.As(err, &vErr) {
+				return &permanentError{err: err}
+			}
+			return err
+		}
+		decoded = v
+		return nil
+	}
+
+	rsp, body, err := do(WithResponseCheck(ctx, check))
+	if err != nil {
+		return err
+	}
+
+	// The response check hasn't been called
+	if !decoded.IsValid() {
+		v := reflect.New(tv.Elem().Type())
+		if err := c.decodeJSON(ctx, rsp, body, v.Interface()); err != nil {
+			return err
+		}
+		decoded = v
+	}
+
+	tv.Elem().Set(decoded.Elem())
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+type testPayload struct {
+	Name string `json:"name"`
+}
+
+func (p *testPayload) Validate() error {
+	if p.Name == "" {
+		return errors.New("empty name")
+	}
+	return nil
+}
+
+// jsonServer returns a server responding with bodies in turn, the last one is repeated
+func jsonServer(ct string, bodies ...string) (*httptest.Server, *int32) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&hits, 1))
+		if n > len(bodies) {
+			n = len(bodies)
+		}
+		w.Header().Set("Content-Type", ct)
+		_, _ = w.Write([]byte(bodies[n-1]))
+	}))
+
+	return srv, &hits
+}
+
+func TestGetJSONDecodeErrorsNotRetried(t *testing.T) {
+	tests := []struct {
+		name   string
+		ct     string
+		body   string
+		strict bool
+		cause  error
+	}{
+		{"syntax", "application/json", `{"name":`, false, nil},
+		{"html", "text/html", `<html><body>blocked</body></html>`, false, ErrHTMLResponse},
+		{"content type", "image/png", `{"name":"a"}`, false, ErrUnexpectedContentType},
+		{"unknown field", "application/json", `{"name":"a","extra":1}`, true, nil},
+		{"trailing data", "application/json", `{"name":"a"} {}`, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, hits := jsonServer(tt.ct, tt.body)
+			defer srv.Close()
+
+			c := newTestCli(t)
+			c.SetMaxRetries(5)
+			c.SetJSONOptions(JSONOptions{DisallowUnknownFields: tt.strict})
+
+			var p testPayload
+			err := c.GetJSON(context.Background(), srv.URL, nil, nil, &p)
+
+			var dErr *DecodeError
+			if !errors.As(err, &dErr) {
+				t.Fatalf("expected *DecodeError, got %v", err)
+			}
+			if tt.cause != nil && !errors.Is(err, tt.cause) {
+				t.Errorf("expected %v cause, got %v", tt.cause, dErr.Err)
+			}
+			if n := atomic.LoadInt32(hits); n != 1 {
+				t.Errorf("expected 1 request, got %d", n)
+			}
+		})
+	}
+}
+
+func TestGetJSONValidationRetried(t *testing.T) {
+	srv, hits := jsonServer("application/json", `{"name":""}`, `{"name":"ok"}`)
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetRecoveryHandler(func(ctx context.Context, c *Cli, f *Failure) Decision {
+		return DecideRetryNow()
+	})
+
+	var p testPayload
+	if err := c.GetJSON(context.Background(), srv.URL, nil, nil, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "ok" {
+		t.Errorf("unexpected target: %+v", p)
+	}
+	if n := atomic.LoadInt32(hits); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestGetJSONValidationFails(t *testing.T) {
+	srv, hits := jsonServer("application/json", `{"name":""}`)
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetRecoveryHandler(func(ctx context.Context, c *Cli, f *Failure) Decision {
+		return DecideRetryNow()
+	})
+
+	p := testPayload{Name: "initial"}
+	err := c.GetJSON(context.Background(), srv.URL, nil, nil, &p)
+
+	var vErr *ValidationError
+	if !errors.As(err, &vErr) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	if n := atomic.LoadInt32(hits); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+	if p.Name != "initial" {
+		t.Errorf("target is modified by a failed attempt: %+v", p)
+	}
+}
+
+func TestWithJSONValidator(t *testing.T) {
+	srv, _ := jsonServer("application/json", `{"name":"a"}`)
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetMaxRetries(1)
+	ctx := WithJSONValidator(context.Background(), func(target interface{}) error {
+		if target.(*testPayload).Name != "b" {
+			return errors.New("unexpected name")
+		}
+		return nil
+	})
+
+	var p testPayload
+	if err := c.GetJSON(ctx, srv.URL, nil, nil, &p); !errors.As(err, new(*ValidationError)) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+}
+
+func TestGetJSONMapTarget(t *testing.T) {
+	srv, hits := jsonServer("application/json", `{"name":"","junk":1}`, `{"name":"ok"}`)
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetRecoveryHandler(func(ctx context.Context, c *Cli, f *Failure) Decision {
+		return DecideRetryNow()
+	})
+	ctx := WithJSONValidator(context.Background(), func(target interface{}) error {
+		if (*target.(*map[string]interface{}))["name"] == "" {
+			return errors.New("empty name")
+		}
+		return nil
+	})
+
+	// A failed attempt doesn't change the map
+	c.SetMaxRetries(1)
+	m := map[string]interface{}{"keep": true}
+	orig := m
+	if err := c.GetJSON(ctx, srv.URL, nil, nil, &m); !errors.As(err, new(*ValidationError)) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	if len(orig) != 1 || len(m) != 1 || m["keep"] != true {
+		t.Errorf("target is modified by a failed attempt: %v", m)
+	}
+
+	// The target is replaced with the value decoded by the successful attempt
+	c.SetMaxRetries(2)
+	if err := c.GetJSON(ctx, srv.URL, nil, nil, &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 1 || m["name"] != "ok" || len(orig) != 1 {
+		t.Errorf("unexpected target: %v, original map: %v", m, orig)
+	}
+	if n := atomic.LoadInt32(hits); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
@@ -0,0 +1,250 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ErrNoCaptchaSolver is returned when a captcha should be solved, but no solver is set
+var ErrNoCaptchaSolver = errors.New("captcha solver is not set")
+
+// Class is a class of a response detected as a blocking one
+type Class string
+
+const (
+	ClassBan         Class = "ban"
+	ClassCaptcha     Class = "captcha"
+	ClassRateLimited Class = "rate-limited"
+	ClassMaintenance Class = "maintenance"
+)
+
+// Rule is a response detection rule.
+//
+// A rule matches a response if all of its non-empty conditions match.
+type Rule struct {
+	Name     string
+	Class    Class
+	Status   []int          // response status is one of these
+	Header   string         // response has this header
+	HeaderRe *regexp.Regexp // value of Header matches this regexp
+	BodyRe   *regexp.Regexp // response body matches this regexp
+	Selector string         // at least one element of HTML response body matches this CSS selector
+}
+
+// DefaultDetectRules are rules detecting common anti-bot responses
+var DefaultDetectRules = []Rule{
+	{
+		Name:     "cloudflare-challenge",
+		Class:    ClassCaptcha,
+		Header:   "Cf-Mitigated",
+		HeaderRe: regexp.MustCompile(`(?i)challenge`),
+	},
+	{
+		Name:   "captcha-widget",
+		Class:  ClassCaptcha,
+		BodyRe: regexp.MustCompile(`(?i)(g-recaptcha|h-captcha|cf-turnstile)`),
+	},
+	{
+		Name:   "too-many-requests",
+		Class:  ClassRateLimited,
+		Status: []int{http.StatusTooManyRequests},
+	},
+	{
+		Name:   "service-unavailable",
+		Class:  ClassMaintenance,
+		Status: []int{http.StatusServiceUnavailable},
+		Header: "Retry-After",
+	},
+	{
+		Name:   "access-denied",
+		Class:  ClassBan,
+		Status: []int{http.StatusForbidden},
+		BodyRe: regexp.MustCompile(`(?i)(access denied|you have been blocked|request blocked)`),
+	},
+}
+
+// Challenge is a captcha challenge found in a response
+type Challenge struct {
+	Kind    string // "recaptcha", "hcaptcha", "turnstile" or empty if unknown
+	SiteKey string // site key of the captcha widget, if found
+	URL     string // URL of the page containing the captcha
+	Body    []byte // response body
+}
+
+// DetectedError is returned when a response is classified by a detection rule
+type DetectedError struct {
+	Class     Class
+	Rule      string
+	URL       string
+	Status    int
+	Challenge *Challenge // not nil for captcha responses
+}
+
+// Error implements error interface
+func (e *DetectedError) Error() string {
+	return fmt.Sprintf("%s response detected by rule %q: %d %s", e.Class, e.Rule, e.Status, e.URL)
+}
+
+// Classify returns a class of the error, or empty string if the error is not a detected response
+func Classify(err error) Class {
+	var dErr *DetectedError
+	if errors.As(err, &dErr) {
+		return dErr.Class
+	}
+
+	return ""
+}
+
+// CaptchaSolver solves captcha challenges
+type CaptchaSolver interface {
+	Solve(ctx context.Context, ch *Challenge) (string, error)
+}
+
+// CaptchaSolverFunc is a function which implements CaptchaSolver
+type CaptchaSolverFunc func(ctx context.Context, ch *Challenge) (string, error)
+
+// Solve calls fn(ctx, ch)
+func (fn CaptchaSolverFunc) Solve(ctx context.Context, ch *Challenge) (string, error) {
+	return fn(ctx, ch)
+}
+
+// AddDetectRules adds response detection rules
+func (c *Cli) AddDetectRules(rules ...Rule) {
+	c.detectRules = append(c.detectRules, rules...)
+}
+
+// SetDetectRules replaces response detection rules
+func (c *Cli) SetDetectRules(rules ...Rule) {
+	c.detectRules = append([]Rule(nil), rules...)
+}
+
+// SetCaptchaSolver sets a captcha solver
+func (c *Cli) SetCaptchaSolver(s CaptchaSolver) {
+	c.captchaSolver = s
+}
+
+// CaptchaSolver returns the captcha solver
+func (c *Cli) CaptchaSolver() CaptchaSolver {
+	return c.captchaSolver
+}
+
+// SolveCaptcha solves a captcha challenge carried by err using client's solver
+func (c *Cli) SolveCaptcha(ctx context.Context, err error) (string, error) {
+	var dErr *DetectedError
+	if !errors.As(err, &dErr) || dErr.Challenge == nil {
+		return "", fmt.Errorf("no captcha challenge in error: %v", err)
+	}
+
+	if c.captchaSolver == nil {
+		return "", ErrNoCaptchaSolver
+	}
+
+	return c.captchaSolver.Solve(ctx, dErr.Challenge)
+}
+
+// detect classifies a response using detection rules
+func (c *Cli) detect(req *http.Request, rsp *http.Response, body []byte) *DetectedError {
+	var doc *goquery.Document
+
+	for _, rule := range c.detectRules {
+		if rule.Selector != "" && doc == nil {
+			d, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+			if err != nil {
+				continue
+			}
+			doc = d
+		}
+
+		if !rule.match(rsp, body, doc) {
+			continue
+		}
+
+		dErr := &DetectedError{
+			Class:  rule.Class,
+			Rule:   rule.Name,
+			URL:    req.URL.String(),
+			Status: rsp.StatusCode,
+		}
+		if rule.Class == ClassCaptcha {
+			dErr.Challenge = newChallenge(dErr.URL, body)
+		}
+
+		return dErr
+	}
+
+	return nil
+}
+
+// match reports whether a rule matches a response
+func (r Rule) match(rsp *http.Response, body []byte, doc *goquery.Document) bool {
+	if len(r.Status) == 0 && r.Header == "" && r.BodyRe == nil && r.Selector == "" {
+		return false
+	}
+
+	if len(r.Status) > 0 {
+		found := false
+		for _, s := range r.Status {
+			if s == rsp.StatusCode {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if r.Header != "" {
+		v, ok := rsp.Header[http.CanonicalHeaderKey(r.Header)]
+		if !ok {
+			return false
+		}
+		if r.HeaderRe != nil && !r.HeaderRe.MatchString(strings.Join(v, ", ")) {
+			return false
+		}
+	}
+
+	if r.BodyRe != nil && !r.BodyRe.Match(body) {
+		return false
+	}
+
+	if r.Selector != "" && (doc == nil || doc.Find(r.Selector).Length() == 0) {
+		return false
+	}
+
+	return true
+}
+
+var (
+	reCaptchaKind    = regexp.MustCompile(`(?i)(g-recaptcha|h-captcha|cf-turnstile)`)
+	reCaptchaSiteKey = regexp.MustCompile(`data-sitekey=["']([^"']+)["']`)
+)
+
+// newChallenge extracts captcha challenge details from a page
+func newChallenge(u string, body []byte) *Challenge {
+	ch := &Challenge{URL: u, Body: body}
+
+	if m := reCaptchaKind.FindSubmatch(body); m != nil {
+		switch strings.ToLower(string(m[1])) {
+		case "g-recaptcha":
+			ch.Kind = "recaptcha"
+		case "h-captcha":
+			ch.Kind = "hcaptcha"
+		case "cf-turnstile":
+			ch.Kind = "turnstile"
+		}
+	}
+
+	if m := reCaptchaSiteKey.FindSubmatch(body); m != nil {
+		ch.SiteKey = string(m[1])
+	}
+
+	return ch
+}
@@ -0,0 +1,154 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDetectRules(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cloudflare":
+			w.Header().Set("Cf-Mitigated", "challenge")
+			w.WriteHeader(http.StatusForbidden)
+		case "/recaptcha":
+			_, _ = w.Write([]byte(`<div class="g-recaptcha" data-sitekey="key-1"></div>`))
+		case "/turnstile":
+			_, _ = w.Write([]byte(`<div class='cf-turnstile' data-sitekey='key-2'></div>`))
+		case "/rate":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/maintenance":
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/banned":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("<h1>Access Denied</h1>"))
+		case "/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		case "/custom":
+			_, _ = w.Write([]byte(`<html><body><div id="blocked">sorry</div></body></html>`))
+		default:
+			_, _ = w.Write([]byte("fine"))
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetMaxRetries(1)
+	c.SetDetectRules(DefaultDetectRules...)
+	c.AddDetectRules(
+		Rule{Name: "empty", Class: ClassBan},
+		Rule{Name: "blocked-page", Class: ClassBan, Selector: "#blocked", BodyRe: regexp.MustCompile(`sorry`)},
+	)
+
+	tests := []struct {
+		path    string
+		class   Class
+		rule    string
+		kind    string
+		siteKey string
+	}{
+		{"/cloudflare", ClassCaptcha, "cloudflare-challenge", "", ""},
+		{"/recaptcha", ClassCaptcha, "captcha-widget", "recaptcha", "key-1"},
+		{"/turnstile", ClassCaptcha, "captcha-widget", "turnstile", "key-2"},
+		{"/rate", ClassRateLimited, "too-many-requests", "", ""},
+		{"/maintenance", ClassMaintenance, "service-unavailable", "", ""},
+		{"/unavailable", "", "", "", ""},
+		{"/banned", ClassBan, "access-denied", "", ""},
+		{"/forbidden", "", "", "", ""},
+		{"/custom", ClassBan, "blocked-page", "", ""},
+		{"/ok", "", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		_, err := c.Get(context.Background(), srv.URL+tt.path, nil, nil)
+		if got := Classify(err); got != tt.class {
+			t.Errorf("%s: got class %q, want %q; error: %v", tt.path, got, tt.class, err)
+			continue
+		}
+		if tt.class == "" {
+			continue
+		}
+
+		var dErr *DetectedError
+		if !errors.As(err, &dErr) {
+			t.Fatalf("%s: got error %T", tt.path, err)
+		}
+		if dErr.Rule != tt.rule || dErr.URL != srv.URL+tt.path {
+			t.Errorf("%s: got %+v", tt.path, dErr)
+		}
+		if (dErr.Challenge != nil) != (tt.class == ClassCaptcha) {
+			t.Errorf("%s: got challenge %+v", tt.path, dErr.Challenge)
+		}
+		if ch := dErr.Challenge; ch != nil && (ch.Kind != tt.kind || ch.SiteKey != tt.siteKey || ch.URL != dErr.URL) {
+			t.Errorf("%s: got challenge %+v", tt.path, ch)
+		}
+	}
+}
+
+func TestCaptchaSolverRetry(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if ck, err := r.Cookie("clearance"); err == nil && ck.Value == "solved:key-1" {
+			_, _ = w.Write([]byte("content"))
+			return
+		}
+		_, _ = w.Write([]byte(`<div class="h-captcha" data-sitekey="key-1"></div>`))
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetMaxRetries(3)
+	c.SetDetectRules(DefaultDetectRules...)
+
+	// Solving fails without a solver
+	c.SetRecoveryHandler(func(ctx context.Context, c *Cli, f *Failure) Decision {
+		if _, err := c.SolveCaptcha(ctx, f.Err); err != nil {
+			return DecideAbort(err)
+		}
+		return DecideRetryNow()
+	})
+	if _, err := c.Get(context.Background(), srv.URL, nil, nil); !errors.Is(err, ErrNoCaptchaSolver) {
+		t.Fatalf("got error %v, want ErrNoCaptchaSolver", err)
+	}
+
+	var solved int32
+	c.SetCaptchaSolver(CaptchaSolverFunc(func(ctx context.Context, ch *Challenge) (string, error) {
+		atomic.AddInt32(&solved, 1)
+		if ch.Kind != "hcaptcha" {
+			t.Errorf("got challenge kind %q", ch.Kind)
+		}
+		return "solved:" + ch.SiteKey, nil
+	}))
+	c.SetRecoveryHandler(func(ctx context.Context, c *Cli, f *Failure) Decision {
+		if f.Kind != FailureDetected || f.Class != ClassCaptcha {
+			return DecideAbort(errors.New("unexpected failure"))
+		}
+		token, err := c.SolveCaptcha(ctx, f.Err)
+		if err != nil {
+			return DecideAbort(err)
+		}
+		c.Client().Jar.SetCookies(f.Request.URL, []*http.Cookie{{Name: "clearance", Value: token}})
+		return DecideRetryNow()
+	})
+
+	atomic.StoreInt32(&hits, 0)
+	body, err := c.Get(context.Background(), srv.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "content" {
+		t.Errorf("got body %q", body)
+	}
+	if h, s := atomic.LoadInt32(&hits), atomic.LoadInt32(&solved); h != 2 || s != 1 {
+		t.Errorf("got %d requests and %d solutions, want 2 and 1", h, s)
+	}
+}
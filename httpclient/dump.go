@@ -0,0 +1,699 @@
+package httpclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DumpIndexFile is a name of dump index file
+const DumpIndexFile = "index.jsonl"
+
+// DumpMode defines which transactions are dumped
+type DumpMode int
+
+const (
+	DumpAll    DumpMode = iota // dump all transactions
+	DumpFailed                 // dump only failed transactions
+)
+
+// DefaultRedactedHeaders are headers which values are redacted in dumps by default
+var DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Redacted is a replacement of redacted header values
+const Redacted = "REDACTED"
+
+// Dump is a dumped HTTP transaction
+type Dump struct {
+	ReqNum     int32 // request number, the same for all attempts of a request
+	TryNum     int
+	Time       time.Time
+	Method     string
+	URL        string
+	ReqHeader  http.Header
+	ReqBody    []byte
+	Proto      string
+	Status     string
+	StatusCode int
+	RspHeader  http.Header
+	RspBody    []byte
+	Timing     *Timing
+	Err        string
+	Curl       string // curl command reproducing a failed request
+}
+
+// TransactionFailed reports whether a dumped transaction having a status code and an error message failed.
+// Dumps of older versions have no status, they are considered failed only if they have an error.
+func TransactionFailed(statusCode int, errMsg string) bool {
+	return errMsg != "" || (statusCode != 0 && (statusCode < 200 || statusCode > 299))
+}
+
+// Failed reports whether the transaction failed
+func (d *Dump) Failed() bool {
+	return TransactionFailed(d.StatusCode, d.Err)
+}
+
+// DumpFilter reports whether a transaction should be dumped
+type DumpFilter func(d *Dump) bool
+
+// DumpSink stores dumps
+type DumpSink interface {
+	WriteDump(d *Dump) error
+}
+
+// DumpSinkFunc is a function which implements DumpSink
+type DumpSinkFunc func(d *Dump) error
+
+// WriteDump calls fn(d)
+func (fn DumpSinkFunc) WriteDump(d *Dump) error {
+	return fn(d)
+}
+
+// bodyRedaction is a body redaction rule
+type bodyRedaction struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// SetDumpSink sets dump sink. Nil disables dumping.
+func (c *Cli) SetDumpSink(s DumpSink) {
+	c.dumpSink = s
+}
+
+// DumpSink returns dump sink
+func (c *Cli) DumpSink() DumpSink {
+	return c.dumpSink
+}
+
+// SetDumpMode sets dump mode
+func (c *Cli) SetDumpMode(m DumpMode) {
+	c.dumpMode = m
+}
+
+// SetDumpFilter sets a filter, only transactions which match it are dumped. Nil removes the filter.
+func (c *Cli) SetDumpFilter(fn DumpFilter) {
+	c.dumpFilter = fn
+}
+
+// SetDumpRedactedHeaders sets headers which values are redacted in dumps and logged curl commands
+func (c *Cli) SetDumpRedactedHeaders(names ...string) {
+	c.dumpRedactedHeaders = make(map[string]bool)
+	for _, n := range names {
+		c.dumpRedactedHeaders[http.CanonicalHeaderKey(n)] = true
+	}
+}
+
+// AddDumpBodyRedaction adds a rule which replaces all matches of re in dumped bodies with repl.
+//
+// Inside repl, $ signs are interpreted as in regexp.Regexp.Expand.
+func (c *Cli) AddDumpBodyRedaction(re *regexp.Regexp, repl string) {
+	c.dumpBodyRedactions = append(c.dumpBodyRedactions, bodyRedaction{re, repl})
+}
+
+// DumpTransaction dumps an HTTP transaction
+func (c *Cli) DumpTransaction(
+	req *http.Request,
+	resp *http.Response,
+	reqBody, respBody []byte,
+	tryNum int,
+) {
+	c.dumpTransaction(atomic.LoadInt32(&c.reqNum), req, resp, reqBody, respBody, tryNum, nil)
+}
+
+// dumpTransaction dumps an HTTP transaction if the dump mode and the filter allow it
+func (c *Cli) dumpTransaction(
+	reqNum int32,
+	req *http.Request,
+	rsp *http.Response,
+	reqBody, rspBody []byte,
+	tryNum int,
+	err error,
+) {
+	if c.dumpSink == nil {
+		return
+	}
+
+	d := &Dump{
+		ReqNum:    reqNum,
+		TryNum:    tryNum,
+		Time:      time.Now(),
+		Method:    req.Method,
+		URL:       req.URL.String(),
+		ReqHeader: c.redactHeader(req.Header),
+		ReqBody:   c.redactBody(reqBody),
+	}
+
+	if rsp != nil {
+		d.Proto = rsp.Proto
+		d.Status = rsp.Status
+		d.StatusCode = rsp.StatusCode
+		d.RspHeader = c.redactHeader(rsp.Header)
+		d.RspBody = c.redactBody(rspBody)
+	}
+
+	if err != nil {
+		d.Err = err.Error()
+	}
+
+	if t, ok := TimingFromRequest(req); ok {
+		d.Timing = &t
+	}
+
+	if c.dumpMode == DumpFailed && !d.Failed() {
+		return
+	}
+
+	if d.Failed() {
+		d.Curl = c.curlCommand(req, reqBody, true)
+	}
+
+	if c.dumpFilter != nil && !c.dumpFilter(d) {
+		return
+	}
+
+	if err := c.dumpSink.WriteDump(d); err != nil {
+		c.l.Err("failed to dump transaction: %v", err)
+	}
+}
+
+// redactHeader returns a copy of a header having sensitive values redacted
+func (c *Cli) redactHeader(h http.Header) http.Header {
+	r := h.Clone()
+	for k, v := range r {
+		if c.dumpRedactedHeaders[k] {
+			for i := range v {
+				v[i] = Redacted
+			}
+		}
+	}
+
+	return r
+}
+
+// redactBody returns a copy of a body having sensitive data redacted
+func (c *Cli) redactBody(b []byte) []byte {
+	r := copyBytes(b)
+	for _, rd := range c.dumpBodyRedactions {
+		r = rd.re.ReplaceAll(r, []byte(rd.repl))
+	}
+
+	return r
+}
+
+// FormatDump formats a dump as a human readable text
+func FormatDump(d *Dump) []byte {
+	buf := bytes.NewBuffer(nil)
+
+	// Request
+	buf.WriteString(fmt.Sprintf("%v %v\n\n", d.Method, d.URL))
+	writeDumpHeader(buf, d.ReqHeader)
+	buf.WriteString("\n")
+	writeDumpBody(buf, d.ReqBody)
+	buf.WriteString("\n")
+
+	// Request and response separator
+	buf.WriteString("\n---\n\n")
+
+	// Response
+	if d.Status != "" {
+		buf.WriteString(fmt.Sprintf("%v %v\n", d.Proto, d.Status))
+	} else {
+		buf.WriteString(fmt.Sprintf("ERROR: %v\n", d.Err))
+	}
+	writeDumpHeader(buf, d.RspHeader)
+	buf.WriteString("\n")
+	writeDumpBody(buf, d.RspBody)
+
+	// Timing
+	if t := d.Timing; t != nil {
+		buf.WriteString(fmt.Sprintf("\n\n---\n\nDNS: %v\nConnect: %v\nTLS: %v\nTTFB: %v\nTransfer: %v\nTotal: %v\nReused: %v\n",
+			t.DNS, t.Connect, t.TLS, t.TTFB, t.Transfer, t.Total, t.Reused))
+	}
+
+	return buf.Bytes()
+}
+
+func writeDumpHeader(buf *bytes.Buffer, h http.Header) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range h[k] {
+			buf.WriteString(fmt.Sprintf("%v: %v\n", k, v))
+		}
+	}
+}
+
+func writeDumpBody(buf *bytes.Buffer, b []byte) {
+	if len(b) > 0 {
+		buf.Write(b)
+	} else {
+		buf.WriteString("EMPTY BODY")
+	}
+}
+
+// ParseDump parses a dump formatted by FormatDump.
+//
+// Request bodies containing the request and response separator cannot be parsed correctly.
+func ParseDump(data []byte) (*Dump, error) {
+	s := string(data)
+	d := &Dump{}
+
+	// Request line
+	i := strings.Index(s, "\n\n")
+	if i < 0 {
+		return nil, errors.New("invalid dump: no request line")
+	}
+	parts := strings.SplitN(s[:i], " ", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid dump request line: %q", s[:i])
+	}
+	d.Method, d.URL = parts[0], parts[1]
+	s = s[i+2:]
+
+	// Request
+	i = strings.Index(s, "\n\n---\n\n")
+	if i < 0 {
+		return nil, errors.New("invalid dump: no response")
+	}
+	var err error
+	if d.ReqHeader, d.ReqBody, err = parseDumpMessage(s[:i]); err != nil {
+		return nil, err
+	}
+	s = s[i+7:]
+
+	// Timing
+	if i = strings.LastIndex(s, "\n\n---\n\nDNS: "); i >= 0 {
+		if t, err := parseDumpTiming(s[i+7:]); err == nil {
+			d.Timing = t
+			s = s[:i]
+		}
+	}
+
+	// Status line, dumps of older versions have no status line
+	line := s
+	if i = strings.Index(s, "\n"); i >= 0 {
+		line = s[:i]
+	}
+	if strings.HasPrefix(line, "ERROR: ") {
+		d.Err = strings.TrimPrefix(line, "ERROR: ")
+		s = strings.TrimPrefix(s[len(line):], "\n")
+	} else if proto, status, ok := parseDumpStatusLine(line); ok {
+		d.Proto, d.Status = proto, status
+		d.StatusCode, _ = strconv.Atoi(status[:3])
+		s = strings.TrimPrefix(s[len(line):], "\n")
+	}
+
+	if d.RspHeader, d.RspBody, err = parseDumpMessage(s); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// dumpStatusRe matches a dumped response status line
+var dumpStatusRe = regexp.MustCompile(`^(HTTP/[0-9.]+) ([0-9]{3}(?: .*)?)$`)
+
+// parseDumpStatusLine parses a dumped response status line
+func parseDumpStatusLine(line string) (string, string, bool) {
+	m := dumpStatusRe.FindStringSubmatch(line)
+	if m == nil {
+		return "", "", false
+	}
+
+	return m[1], m[2], true
+}
+
+// parseDumpMessage parses dumped headers and body
+func parseDumpMessage(s string) (http.Header, []byte, error) {
+	h := http.Header{}
+
+	for s != "" {
+		i := strings.Index(s, "\n")
+		if i < 0 {
+			i = len(s)
+		}
+		line := s[:i]
+		if i < len(s) {
+			s = s[i+1:]
+		} else {
+			s = ""
+		}
+
+		if line == "" {
+			break
+		}
+
+		j := strings.Index(line, ": ")
+		if j <= 0 {
+			return nil, nil, fmt.Errorf("invalid dump header line: %q", line)
+		}
+		h.Add(line[:j], line[j+2:])
+	}
+
+	if len(h) == 0 {
+		h = nil
+	}
+
+	if s == "EMPTY BODY" || s == "" {
+		return h, nil, nil
+	}
+
+	return h, []byte(s), nil
+}
+
+// parseDumpTiming parses dumped timing
+func parseDumpTiming(s string) (*Timing, error) {
+	t := &Timing{}
+	for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+		parts := strings.SplitN(line, ": ", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid dump timing line: %q", line)
+		}
+
+		var (
+			dst *time.Duration
+			err error
+		)
+		switch parts[0] {
+		case "DNS":
+			dst = &t.DNS
+		case "Connect":
+			dst = &t.Connect
+		case "TLS":
+			dst = &t.TLS
+		case "TTFB":
+			dst = &t.TTFB
+		case "Transfer":
+			dst = &t.Transfer
+		case "Total":
+			dst = &t.Total
+		case "Reused":
+			t.Reused, err = strconv.ParseBool(parts[1])
+		default:
+			return nil, fmt.Errorf("invalid dump timing line: %q", line)
+		}
+		if dst != nil {
+			*dst, err = time.ParseDuration(parts[1])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid dump timing line: %q", line)
+		}
+	}
+
+	return t, nil
+}
+
+// ReadDumpFile reads and parses a dump file, which may be gzipped
+func ReadDumpFile(fPath string) (*Dump, error) {
+	b, err := ioutil.ReadFile(fPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasSuffix(fPath, ".gz") {
+		gr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dump file %v: %v", fPath, err)
+		}
+		if b, err = ioutil.ReadAll(gr); err != nil {
+			return nil, fmt.Errorf("failed to read dump file %v: %v", fPath, err)
+		}
+	}
+
+	d, err := ParseDump(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dump file %v: %v", fPath, err)
+	}
+
+	return d, nil
+}
+
+// ReplayDump performs a dumped request again.
+//
+// Redacted headers are not sent.
+func (c *Cli) ReplayDump(ctx context.Context, d *Dump) (*http.Response, []byte, error) {
+	header := http.Header{}
+	for k, vs := range d.ReqHeader {
+		for _, v := range vs {
+			if v != Redacted {
+				header.Add(k, v)
+			}
+		}
+	}
+
+	return c.DoRequest(ctx, d.Method, d.URL, header, d.ReqBody)
+}
+
+// DumpIndexEntry is an entry of dump index file
+type DumpIndexEntry struct {
+	File       string    `json:"file"`
+	ReqNum     int32     `json:"req"`
+	TryNum     int       `json:"try"`
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	Status     string    `json:"status,omitempty"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Err        string    `json:"error,omitempty"`
+	Timing     *Timing   `json:"timing,omitempty"`
+	Curl       string    `json:"curl,omitempty"`
+}
+
+// DirSinkOptions are directory dump sink options
+type DirSinkOptions struct {
+	Gzip     bool          // compress dump files
+	MaxFiles int           // maximum number of dump files to keep, zero means no limit
+	MaxBytes int64         // maximum total size of dump files to keep, zero means no limit
+	MaxAge   time.Duration // maximum age of dump files to keep, zero means no limit
+}
+
+// dumpFile is a dump file written by a sink
+type dumpFile struct {
+	path string
+	size int64
+	time time.Time
+}
+
+// DirSink writes dumps into files in a directory.
+//
+// Besides the dump files, it maintains an index file listing every written dump.
+// Entries of files removed due to retention limits are kept in the index.
+type DirSink struct {
+	mux   sync.Mutex
+	dir   string
+	opts  DirSinkOptions
+	files []dumpFile
+	size  int64
+}
+
+// NewDirSink creates a directory dump sink
+func NewDirSink(dir string, opts DirSinkOptions) (*DirSink, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create dump directory: %v", err)
+	}
+
+	s := &DirSink{dir: dir, opts: opts}
+
+	// Take into account files created earlier
+	fInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range fInfos {
+		if fi.IsDir() || !isDumpFile(fi.Name()) {
+			continue
+		}
+		s.files = append(s.files, dumpFile{filepath.Join(dir, fi.Name()), fi.Size(), fi.ModTime()})
+		s.size += fi.Size()
+	}
+	sort.Slice(s.files, func(i, j int) bool {
+		return s.files[i].time.Before(s.files[j].time)
+	})
+
+	return s, nil
+}
+
+// Dir returns sink's directory
+func (s *DirSink) Dir() string {
+	return s.dir
+}
+
+// WriteDump writes a dump into a file
+func (s *DirSink) WriteDump(d *Dump) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	data := FormatDump(d)
+	ext := ".txt"
+	if s.opts.Gzip {
+		buf := bytes.NewBuffer(nil)
+		gw := gzip.NewWriter(buf)
+		if _, err := gw.Write(data); err != nil {
+			return err
+		}
+		if err := gw.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+		ext += ".gz"
+	}
+
+	// Never overwrite existing dumps
+	var (
+		f     *os.File
+		err   error
+		fPath string
+	)
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("%04d-%02d", d.ReqNum, d.TryNum)
+		if i > 0 {
+			name += fmt.Sprintf("-%d", i)
+		}
+		fPath = filepath.Join(s.dir, name+ext)
+
+		f, err = os.OpenFile(fPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if os.IsExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("error creating http dump file %v: %v", fPath, err)
+		}
+		break
+	}
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error writing http dump file %v: %v", fPath, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing http dump file %v: %v", fPath, err)
+	}
+
+	s.files = append(s.files, dumpFile{fPath, int64(len(data)), d.Time})
+	s.size += int64(len(data))
+
+	if err := s.writeIndex(filepath.Base(fPath), d); err != nil {
+		return err
+	}
+
+	s.cleanup()
+
+	return nil
+}
+
+// writeIndex appends an entry to the index file
+func (s *DirSink) writeIndex(fName string, d *Dump) error {
+	b, err := json.Marshal(DumpIndexEntry{
+		File:       fName,
+		ReqNum:     d.ReqNum,
+		TryNum:     d.TryNum,
+		Time:       d.Time,
+		Method:     d.Method,
+		URL:        d.URL,
+		Status:     d.Status,
+		StatusCode: d.StatusCode,
+		Err:        d.Err,
+		Timing:     d.Timing,
+		Curl:       d.Curl,
+	})
+	if err != nil {
+		return err
+	}
+
+	fPath := filepath.Join(s.dir, DumpIndexFile)
+	f, err := os.OpenFile(fPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening dump index file %v: %v", fPath, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("error writing dump index file %v: %v", fPath, err)
+	}
+
+	return nil
+}
+
+// cleanup removes dump files exceeding retention limits
+func (s *DirSink) cleanup() {
+	for len(s.files) > 0 {
+		f := s.files[0]
+
+		exceeded := (s.opts.MaxFiles > 0 && len(s.files) > s.opts.MaxFiles) ||
+			(s.opts.MaxBytes > 0 && s.size > s.opts.MaxBytes) ||
+			(s.opts.MaxAge > 0 && time.Since(f.time) > s.opts.MaxAge)
+		if !exceeded {
+			break
+		}
+
+		_ = os.Remove(f.path)
+		s.files = s.files[1:]
+		s.size -= f.size
+	}
+}
+
+// isDumpFile reports whether a file name is a dump file name
+func isDumpFile(name string) bool {
+	return strings.HasSuffix(name, ".txt") || strings.HasSuffix(name, ".txt.gz")
+}
+
+// RingSink keeps a limited number of most recent dumps in memory
+type RingSink struct {
+	mux   sync.Mutex
+	size  int
+	dumps []*Dump
+}
+
+// NewRingSink creates an in-memory dump sink keeping up to size most recent dumps
+func NewRingSink(size int) *RingSink {
+	if size < 1 {
+		size = 1
+	}
+
+	return &RingSink{size: size}
+}
+
+// WriteDump stores a dump
+func (s *RingSink) WriteDump(d *Dump) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.dumps = append(s.dumps, d)
+	if len(s.dumps) > s.size {
+		s.dumps = s.dumps[len(s.dumps)-s.size:]
+	}
+
+	return nil
+}
+
+// Dumps returns stored dumps, oldest first
+func (s *RingSink) Dumps() []*Dump {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return append([]*Dump(nil), s.dumps...)
+}
@@ -0,0 +1,140 @@
+package httpclient
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDumpRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *Dump
+	}{
+		{
+			name: "response",
+			d: &Dump{
+				Method:     "POST",
+				URL:        "https://example.com/a?b=c",
+				ReqHeader:  http.Header{"Content-Type": {"application/json"}, "X-Multi": {"1", "2"}},
+				ReqBody:    []byte("{\"a\":1}\n\n"),
+				Proto:      "HTTP/1.1",
+				Status:     "404 Not Found",
+				StatusCode: 404,
+				RspHeader:  http.Header{"Content-Type": {"text/html"}},
+				RspBody:    []byte("<html>\n\n</html>\n"),
+			},
+		},
+		{
+			name: "empty bodies",
+			d: &Dump{
+				Method:     "GET",
+				URL:        "https://example.com/",
+				Proto:      "HTTP/2.0",
+				Status:     "204 No Content",
+				StatusCode: 204,
+			},
+		},
+		{
+			name: "error",
+			d: &Dump{
+				Method: "GET",
+				URL:    "https://example.com/",
+				Err:    "dial tcp: connection refused",
+			},
+		},
+		{
+			name: "timing",
+			d: &Dump{
+				Method:     "GET",
+				URL:        "https://example.com/",
+				Proto:      "HTTP/1.1",
+				Status:     "200 OK",
+				StatusCode: 200,
+				RspBody:    []byte("ok"),
+				Timing:     &Timing{DNS: time.Millisecond, Connect: 2 * time.Millisecond, TTFB: time.Second, Total: 2 * time.Second, Reused: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := ParseDump(FormatDump(tt.d))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(d, tt.d) {
+				t.Errorf("expected %+v, got %+v", tt.d, d)
+			}
+		})
+	}
+}
+
+func TestParseDumpLegacy(t *testing.T) {
+	// Format of dumps written by older versions: no status line
+	data := "GET https://example.com/\n\n" +
+		"User-Agent: test\n\n" +
+		"EMPTY BODY\n" +
+		"\n---\n\n" +
+		"Content-Type: text/html\nServer: nginx\n\n" +
+		"<html></html>"
+
+	d, err := ParseDump([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &Dump{
+		Method:    "GET",
+		URL:       "https://example.com/",
+		ReqHeader: http.Header{"User-Agent": {"test"}},
+		RspHeader: http.Header{"Content-Type": {"text/html"}, "Server": {"nginx"}},
+		RspBody:   []byte("<html></html>"),
+	}
+	if !reflect.DeepEqual(d, exp) {
+		t.Errorf("expected %+v, got %+v", exp, d)
+	}
+	if d.Failed() {
+		t.Error("legacy dump without error is reported as failed")
+	}
+
+	// No response headers
+	d, err = ParseDump([]byte("GET https://example.com/\n\n\nEMPTY BODY\n\n---\n\n\nEMPTY BODY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.RspHeader != nil || d.RspBody != nil {
+		t.Errorf("unexpected response: %+v", d)
+	}
+}
+
+func TestParseDumpInvalid(t *testing.T) {
+	for _, s := range []string{"", "GET", "GET https://example.com/\n\nUser-Agent: test\n"} {
+		if _, err := ParseDump([]byte(s)); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestTransactionFailed(t *testing.T) {
+	tests := []struct {
+		status int
+		err    string
+		want   bool
+	}{
+		{200, "", false},
+		{204, "", false},
+		{302, "", true},
+		{404, "", true},
+		{200, "validation failed", true},
+		{0, "", false}, // legacy dump
+		{0, "connection refused", true},
+	}
+
+	for _, tt := range tests {
+		if got := TransactionFailed(tt.status, tt.err); got != tt.want {
+			t.Errorf("%d %q: got %v, want %v", tt.status, tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+// EventInfo is an information common for all request lifecycle events
+type EventInfo struct {
+	ReqNum   int32         // request number, the same for all attempts of a request
+	TryNum   int           // attempt number, starting from 1
+	Method   string        // request method
+	URL      string        // request URL
+	Status   int           // response status code, zero if no response received
+	Err      error         // attempt or request error
+	Duration time.Duration // attempt duration for attempt events, request duration for final ones
+}
+
+// Info returns the event information
+func (e EventInfo) Info() EventInfo {
+	return e
+}
+
+// Event is a request lifecycle event
+type Event interface {
+	Info() EventInfo
+}
+
+// RequestStartEvent is emitted when a request is started, before the first attempt
+type RequestStartEvent struct {
+	EventInfo
+}
+
+// AttemptEvent is emitted before each request attempt
+type AttemptEvent struct {
+	EventInfo
+}
+
+// ResponseEvent is emitted after each request attempt, either successful or not
+type ResponseEvent struct {
+	EventInfo
+}
+
+// RetryScheduledEvent is emitted when a failed attempt is going to be retried
+type RetryScheduledEvent struct {
+	EventInfo
+	Delay time.Duration
+}
+
+// GiveUpEvent is emitted when a request failed and won't be retried anymore
+type GiveUpEvent struct {
+	EventInfo
+}
+
+// SuccessEvent is emitted when a request succeeded
+type SuccessEvent struct {
+	EventInfo
+}
+
+// EventListener is a request lifecycle event listener
+type EventListener func(ev Event)
+
+// eventListener is a registered event listener
+type eventListener struct {
+	id int
+	fn EventListener
+}
+
+// eventHub delivers events to listeners and channels
+type eventHub struct {
+	mux       sync.RWMutex
+	lastID    int
+	listeners []eventListener
+	channels  []chan Event
+}
+
+// AddEventListener adds an event listener and returns a function removing it.
+//
+// Listeners are called synchronously from the goroutine performing the request, so they should not block.
+// A listener may add or remove listeners. A removed listener may still receive events being emitted concurrently.
+func (c *Cli) AddEventListener(fn EventListener) func() {
+	c.events.mux.Lock()
+	defer c.events.mux.Unlock()
+
+	c.events.lastID++
+	id := c.events.lastID
+	c.events.listeners = append(c.events.listeners, eventListener{id, fn})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.events.mux.Lock()
+			defer c.events.mux.Unlock()
+
+			for i, l := range c.events.listeners {
+				if l.id == id {
+					c.events.listeners = append(c.events.listeners[:i:i], c.events.listeners[i+1:]...)
+					break
+				}
+			}
+		})
+	}
+}
+
+// Events returns a buffered channel which receives events. The channel is closed by CloseEvents.
+//
+// If the channel is full, events are dropped to not block requests.
+func (c *Cli) Events(size int) <-chan Event {
+	c.events.mux.Lock()
+	defer c.events.mux.Unlock()
+
+	ch := make(chan Event, size)
+	c.events.channels = append(c.events.channels, ch)
+
+	return ch
+}
+
+// CloseEvents stops delivering events to a channel returned by Events and closes it
+func (c *Cli) CloseEvents(ch <-chan Event) {
+	c.events.mux.Lock()
+	defer c.events.mux.Unlock()
+
+	for i, ech := range c.events.channels {
+		if ech == ch {
+			c.events.channels = append(c.events.channels[:i:i], c.events.channels[i+1:]...)
+			close(ech)
+			return
+		}
+	}
+}
+
+// emit delivers an event.
+//
+// Listeners are called without holding the lock, so they may use the client's event methods.
+func (c *Cli) emit(ev Event) {
+	c.events.mux.RLock()
+	listeners := append([]eventListener(nil), c.events.listeners...)
+
+	// Sending is non-blocking, it's done under the lock so a channel cannot be closed meanwhile
+	for _, ch := range c.events.channels {
+		select {
+		case ch <- ev:
+		default:
+			c.l.Debug("event channel is full, event dropped: %T", ev)
+		}
+	}
+	c.events.mux.RUnlock()
+
+	for _, l := range listeners {
+		l.fn(ev)
+	}
+}
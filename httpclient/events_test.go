@@ -0,0 +1,105 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestEvents(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1)%2 == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetRecoveryHandler(func(ctx context.Context, c *Cli, f *Failure) Decision {
+		return DecideRetryNow()
+	})
+
+	var (
+		events []Event
+		once   int
+		remove func()
+	)
+	remove = c.AddEventListener(func(ev Event) {
+		events = append(events, ev)
+	})
+
+	// Listeners may use event methods of the client
+	var removeOnce func()
+	removeOnce = c.AddEventListener(func(ev Event) {
+		once++
+		removeOnce()
+	})
+
+	ch := c.Events(100)
+
+	if _, err := c.Get(context.Background(), srv.URL, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, ev := range events {
+		names = append(names, eventName(ev))
+		if ev.Info().ReqNum != events[0].Info().ReqNum {
+			t.Errorf("request number changes between attempts: %+v", ev.Info())
+		}
+	}
+	exp := []string{"start", "attempt", "response", "retry", "attempt", "response", "success"}
+	if len(names) != len(exp) {
+		t.Fatalf("got events %v, want %v", names, exp)
+	}
+	for i := range exp {
+		if names[i] != exp[i] {
+			t.Fatalf("got events %v, want %v", names, exp)
+		}
+	}
+	if once != 1 {
+		t.Errorf("removed listener is called %d times", once)
+	}
+
+	c.CloseEvents(ch)
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != len(exp) {
+		t.Errorf("got %d events from the channel, want %d", n, len(exp))
+	}
+
+	remove()
+	remove()
+	events = nil
+	if _, err := c.Get(context.Background(), srv.URL, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Errorf("removed listener got %d events", len(events))
+	}
+}
+
+// eventName returns a short name of an event
+func eventName(ev Event) string {
+	switch ev.(type) {
+	case RequestStartEvent:
+		return "start"
+	case AttemptEvent:
+		return "attempt"
+	case ResponseEvent:
+		return "response"
+	case RetryScheduledEvent:
+		return "retry"
+	case GiveUpEvent:
+		return "giveup"
+	case SuccessEvent:
+		return "success"
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,318 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// GraphQLRequest is a GraphQL operation
+type GraphQLRequest struct {
+	Query         string
+	Variables     map[string]interface{}
+	OperationName string
+
+	// Persisted makes the client send a persisted query hash first and the query itself
+	// only if the server doesn't know the hash yet (Apollo automatic persisted queries).
+	Persisted bool
+
+	// Hash is a SHA-256 hash of a persisted query. It's computed from Query if empty.
+	// If Query is empty, the hash alone is sent.
+	Hash string
+}
+
+// GraphQLLocation is a location in a GraphQL query
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLError is an error returned by a GraphQL server
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Locations  []GraphQLLocation      `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Error implements error
+func (e *GraphQLError) Error() string {
+	if p := e.PathString(); p != "" {
+		return p + ": " + e.Message
+	}
+
+	return e.Message
+}
+
+// PathString returns the error path as a string like "user.friends[1].name"
+func (e *GraphQLError) PathString() string {
+	var buf strings.Builder
+	for _, p := range e.Path {
+		switch v := p.(type) {
+		case string:
+			if buf.Len() > 0 {
+				buf.WriteString(".")
+			}
+			buf.WriteString(v)
+		default:
+			buf.WriteString(fmt.Sprintf("[%v]", v))
+		}
+	}
+
+	return buf.String()
+}
+
+// Code returns the "code" extension of the error
+func (e *GraphQLError) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+// GraphQLErrors are errors returned by a GraphQL server in a response
+type GraphQLErrors []*GraphQLError
+
+// Error implements error
+func (e GraphQLErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return "graphql: " + strings.Join(msgs, "; ")
+}
+
+// errPersistedQueryNotFound is an error message of servers which don't know a persisted query hash
+const errPersistedQueryNotFound = "PersistedQueryNotFound"
+
+// graphQLPayload is a GraphQL request body
+type graphQLPayload struct {
+	Query         string                 `json:"query,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// graphQLResponse is a GraphQL response body
+type graphQLResponse struct {
+	Data       json.RawMessage `json:"data"`
+	Errors     GraphQLErrors   `json:"errors"`
+	Extensions json.RawMessage `json:"extensions"`
+}
+
+// GraphQL performs a GraphQL operation and decodes its data into target.
+//
+// If the server returns errors, they are returned as GraphQLErrors, and partial data, if any, is still decoded.
+// Errors of responses having non-2xx status are wrapped into an error along with the status.
+//
+// Queries are retried like idempotent requests. Mutations, subscriptions and operations which type cannot be
+// determined, like ones sent as a persisted query hash only, are retried only if ctx is wrapped with AllowRetry.
+func (c *Cli) GraphQL(ctx context.Context, endpoint string, header http.Header, req GraphQLRequest, target interface{}) error {
+	if graphQLOperationType(req.Query, req.OperationName) == "query" {
+		ctx = AllowRetry(ctx)
+	}
+
+	header = fetchRequestHeader(header, "application/json")
+	header.Set("Content-Type", "application/json")
+
+	payload := graphQLPayload{
+		Query:         req.Query,
+		Variables:     req.Variables,
+		OperationName: req.OperationName,
+	}
+
+	persisted := req.Persisted || req.Hash != ""
+	if persisted {
+		hash := req.Hash
+		if hash == "" {
+			if req.Query == "" {
+				return errors.New("graphql: persisted query requires a query or a hash")
+			}
+			h := sha256.Sum256([]byte(req.Query))
+			hash = hex.EncodeToString(h[:])
+		}
+		payload.Query = ""
+		payload.Extensions = map[string]interface{}{
+			"persistedQuery": map[string]interface{}{"version": 1, "sha256Hash": hash},
+		}
+	}
+
+	rsp, err := c.postGraphQL(ctx, endpoint, header, payload)
+	if err != nil {
+		return err
+	}
+
+	// The server doesn't know the hash yet, so send the query to register it
+	if persisted && req.Query != "" && rsp.persistedQueryNotFound() {
+		payload.Query = req.Query
+		if rsp, err = c.postGraphQL(ctx, endpoint, header, payload); err != nil {
+			return err
+		}
+	}
+
+	if target != nil && len(rsp.Data) > 0 && string(rsp.Data) != "null" {
+		dec := json.NewDecoder(bytes.NewReader(rsp.Data))
+		if c.jsonOpts.DisallowUnknownFields {
+			dec.DisallowUnknownFields()
+		}
+		if err := dec.Decode(target); err != nil {
+			return fmt.Errorf("graphql: failed to decode data: %v", err)
+		}
+	}
+
+	if len(rsp.Errors) > 0 {
+		return rsp.Errors
+	}
+
+	return nil
+}
+
+// postGraphQL sends a GraphQL request
+func (c *Cli) postGraphQL(ctx context.Context, endpoint string, header http.Header, payload graphQLPayload) (*graphQLResponse, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var rsp graphQLResponse
+	err = c.doJSON(ctx, &rsp, func(ctx context.Context) (*http.Response, []byte, error) {
+		return c.DoRequest(ctx, http.MethodPost, endpoint, header, body)
+	})
+
+	// Servers may report errors, like invalid queries, with a non-2xx status
+	var sErr *StatusError
+	if errors.As(err, &sErr) {
+		var eRsp graphQLResponse
+		if json.Unmarshal(sErr.Body, &eRsp) == nil && len(eRsp.Errors) > 0 {
+			return nil, fmt.Errorf("%s: %w", sErr.Status, eRsp.Errors)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &rsp, nil
+}
+
+// persistedQueryNotFound reports whether the server doesn't know a persisted query
+func (r *graphQLResponse) persistedQueryNotFound() bool {
+	for _, e := range r.Errors {
+		if e.Message == errPersistedQueryNotFound || e.Code() == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// graphQLOperationType returns a type of an operation of a query: "query", "mutation" or "subscription".
+//
+// If the query contains several operations, the one named opName is chosen.
+// Empty string is returned if the type cannot be determined.
+func graphQLOperationType(query, opName string) string {
+	type operation struct {
+		typ  string
+		name string
+	}
+
+	var (
+		ops        []operation
+		braces     int
+		parens     int
+		expectDef  = true  // a definition may start
+		expectName = false // a name of the last operation may follow
+	)
+
+	for i := 0; i < len(query); {
+		ch := query[i]
+		switch {
+		case ch == '#':
+			for i < len(query) && query[i] != '\n' && query[i] != '\r' {
+				i++
+			}
+			continue
+		case strings.HasPrefix(query[i:], `"""`):
+			i += 3
+			for i < len(query) && !strings.HasPrefix(query[i:], `"""`) {
+				if strings.HasPrefix(query[i:], `\"""`) {
+					i += 4
+					continue
+				}
+				i++
+			}
+			i += 3
+			continue
+		case ch == '"':
+			for i++; i < len(query) && query[i] != '"' && query[i] != '\n'; i++ {
+				if query[i] == '\\' {
+					i++
+				}
+			}
+			i++
+			continue
+		case ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z'):
+			start := i
+			for i < len(query) && (query[i] == '_' || (query[i] >= 'a' && query[i] <= 'z') ||
+				(query[i] >= 'A' && query[i] <= 'Z') || (query[i] >= '0' && query[i] <= '9')) {
+				i++
+			}
+			if braces > 0 || parens > 0 {
+				continue
+			}
+
+			word := query[start:i]
+			switch {
+			case expectDef:
+				expectDef = false
+				if word == "query" || word == "mutation" || word == "subscription" {
+					ops = append(ops, operation{typ: word})
+					expectName = true
+				}
+			case expectName:
+				ops[len(ops)-1].name = word
+				expectName = false
+			}
+			continue
+		case ch == '{':
+			// Query shorthand
+			if braces == 0 && parens == 0 && expectDef {
+				ops = append(ops, operation{typ: "query"})
+				expectDef = false
+			}
+			braces++
+			expectName = false
+		case ch == '}':
+			if braces--; braces == 0 && parens == 0 {
+				expectDef = true
+			}
+		case ch == '(':
+			parens++
+			expectName = false
+		case ch == ')':
+			parens--
+		case ch == '@':
+			expectName = false
+		}
+		i++
+	}
+
+	if opName == "" {
+		if len(ops) == 1 {
+			return ops[0].typ
+		}
+		return ""
+	}
+
+	for _, op := range ops {
+		if op.name == opName {
+			return op.typ
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,122 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGraphQLOperationType(t *testing.T) {
+	tests := []struct {
+		query  string
+		opName string
+		want   string
+	}{
+		{"{ user { id } }", "", "query"},
+		{"query { user { id } }", "", "query"},
+		{"  # comment\n mutation Add { add }", "", "mutation"},
+		{"subscription OnEvent { event }", "", "subscription"},
+		{`query Q($s: String = "mutation {") { f(s: $s) }`, "", "query"},
+		{"fragment F on User { id }\nmutation M { add { ...F } }", "", "mutation"},
+		{"query Q @cached { f }", "", "query"},
+		{`query Q { f(s: """ } mutation """) }`, "", "query"},
+
+		// The operation is chosen by name
+		{"query Get { f }\nmutation Set { g }", "Set", "mutation"},
+		{"query Get { f }\nmutation Set { g }", "Get", "query"},
+		{"query Get { f }\nmutation Set { g }", "", ""},
+		{"query Get { f }\nmutation Set { g }", "Other", ""},
+
+		// Unknown type
+		{"", "", ""},
+		{"", "Get", ""},
+	}
+
+	for _, tt := range tests {
+		if got := graphQLOperationType(tt.query, tt.opName); got != tt.want {
+			t.Errorf("graphQLOperationType(%q, %q) = %q, want %q", tt.query, tt.opName, got, tt.want)
+		}
+	}
+}
+
+func TestGraphQLRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		req  GraphQLRequest
+		want int32
+	}{
+		{"query", GraphQLRequest{Query: "{ f }"}, 2},
+		{"mutation", GraphQLRequest{Query: "mutation { g }"}, 1},
+		{"named mutation", GraphQLRequest{Query: "query Get { f }\nmutation Set { g }", OperationName: "Set"}, 1},
+		{"named query", GraphQLRequest{Query: "mutation Set { g }\nquery Get { f }", OperationName: "Get"}, 2},
+		{"hash only", GraphQLRequest{Hash: "abc"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&hits, 1) == 1 {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"data":{"f":1}}`))
+			}))
+			defer srv.Close()
+
+			c := newTestCli(t)
+			c.SetRecoveryHandler(func(ctx context.Context, c *Cli, f *Failure) Decision {
+				// Explicit retry decisions are followed for any request, keep the default one for mutations
+				if !retryAllowed(ctx, f.Request.Method) {
+					return DecideRetry()
+				}
+				return DecideRetryNow()
+			})
+
+			_ = c.GraphQL(context.Background(), srv.URL, nil, tt.req, nil)
+			if n := atomic.LoadInt32(&hits); n != tt.want {
+				t.Errorf("got %d requests, want %d", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":[{"message":"unknown field","extensions":{"code":"GRAPHQL_VALIDATION_FAILED"}}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"f":1},"errors":[{"message":"denied","path":["g"]}],"extensions":{"cost":3}}`))
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetMaxRetries(1)
+	c.SetJSONOptions(JSONOptions{DisallowUnknownFields: true})
+
+	var data struct{ F int }
+	err := c.GraphQL(context.Background(), srv.URL, nil, GraphQLRequest{Query: "{ f g }"}, &data)
+	var gErrs GraphQLErrors
+	if !errors.As(err, &gErrs) || len(gErrs) != 1 || gErrs[0].PathString() != "g" {
+		t.Errorf("got error %v", err)
+	}
+	if data.F != 1 {
+		t.Errorf("partial data is not decoded: %+v", data)
+	}
+
+	// Errors of non-2xx responses are kept
+	err = c.GraphQL(context.Background(), srv.URL+"/bad", nil, GraphQLRequest{Query: "{ x }"}, &data)
+	if !errors.As(err, &gErrs) || len(gErrs) != 1 || gErrs[0].Code() != "GRAPHQL_VALIDATION_FAILED" {
+		t.Errorf("got error %v", err)
+	}
+	if err.Error() != "400 Bad Request: graphql: unknown field" {
+		t.Errorf("got error %q", err)
+	}
+}
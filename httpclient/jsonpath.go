@@ -0,0 +1,605 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ashep/aghpu/util"
+)
+
+// ErrStopStream may be returned by a JSONElementFunc to stop iteration without an error
+var ErrStopStream = errors.New("stop stream")
+
+// JSONElementFunc is called for each streamed JSON value with its index
+type JSONElementFunc func(i int, raw json.RawMessage) error
+
+// stepKind is a kind of JSON path step
+type stepKind int
+
+const (
+	stepNames stepKind = iota
+	stepIndexes
+	stepWildcard
+	stepSlice
+)
+
+// pathStep is a JSON path step
+type pathStep struct {
+	kind      stepKind
+	recursive bool
+	names     []string
+	indexes   []int
+	start     *int
+	end       *int
+}
+
+// JSONPath is a compiled JSONPath-like expression.
+//
+// Supported syntax: $ (root, may be omitted), .name, ['name'], [n] (negative n counts from the end), [*] and .*,
+// [start:end] slices, [a,b] unions of names or indexes and ..name recursive descent. Filters are not supported.
+type JSONPath struct {
+	expr  string
+	steps []pathStep
+}
+
+// CompileJSONPath compiles a JSONPath-like expression
+func CompileJSONPath(expr string) (*JSONPath, error) {
+	p := &JSONPath{expr: expr}
+
+	s := strings.TrimSpace(expr)
+	if strings.HasPrefix(s, "$") {
+		s = s[1:]
+	} else if s != "" && s[0] != '.' && s[0] != '[' {
+		s = "." + s
+	}
+
+	for s != "" {
+		var (
+			st  pathStep
+			err error
+		)
+
+		switch {
+		case strings.HasPrefix(s, ".."):
+			st.recursive = true
+			s = s[2:]
+			if strings.HasPrefix(s, "[") {
+				if st, s, err = parseBracketStep(s); err != nil {
+					return nil, fmt.Errorf("invalid JSON path %q: %v", expr, err)
+				}
+				st.recursive = true
+				break
+			}
+			st, s = parseDotStep(s)
+			st.recursive = true
+		case s[0] == '.':
+			st, s = parseDotStep(s[1:])
+		case s[0] == '[':
+			if st, s, err = parseBracketStep(s); err != nil {
+				return nil, fmt.Errorf("invalid JSON path %q: %v", expr, err)
+			}
+		default:
+			return nil, fmt.Errorf("invalid JSON path %q: unexpected %q", expr, s)
+		}
+
+		if st.kind == stepNames && (len(st.names) == 0 || st.names[0] == "") {
+			return nil, fmt.Errorf("invalid JSON path %q: empty name", expr)
+		}
+
+		p.steps = append(p.steps, st)
+	}
+
+	return p, nil
+}
+
+// MustCompileJSONPath is like CompileJSONPath but panics if the expression cannot be compiled
+func MustCompileJSONPath(expr string) *JSONPath {
+	p, err := CompileJSONPath(expr)
+	if err != nil {
+		panic(err)
+	}
+
+	return p
+}
+
+// parseDotStep parses a step following a dot
+func parseDotStep(s string) (pathStep, string) {
+	i := strings.IndexAny(s, ".[")
+	if i < 0 {
+		i = len(s)
+	}
+
+	name := s[:i]
+	if name == "*" {
+		return pathStep{kind: stepWildcard}, s[i:]
+	}
+
+	return pathStep{kind: stepNames, names: []string{name}}, s[i:]
+}
+
+// parseBracketStep parses a step in brackets
+func parseBracketStep(s string) (pathStep, string, error) {
+	var (
+		st    pathStep
+		parts []string
+		cur   strings.Builder
+		quote rune
+		i     int
+	)
+
+	// Split the content by commas taking quotes into account
+	quoted := false
+	for i = 1; i < len(s); i++ {
+		ch := rune(s[i])
+		if quote != 0 {
+			if ch == '\\' && i+1 < len(s) {
+				i++
+				cur.WriteByte(s[i])
+			} else if ch == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(ch)
+			}
+			continue
+		}
+
+		if ch == '\'' || ch == '"' {
+			quote = ch
+			quoted = true
+		} else if ch == ',' || ch == ']' {
+			parts = append(parts, strings.TrimSpace(cur.String()))
+			cur.Reset()
+			if ch == ']' {
+				break
+			}
+		} else {
+			cur.WriteRune(ch)
+		}
+	}
+	if i >= len(s) {
+		return st, "", errors.New("unterminated bracket")
+	}
+	rest := s[i+1:]
+
+	switch {
+	case quoted:
+		st.kind = stepNames
+		st.names = parts
+	case len(parts) == 1 && parts[0] == "*":
+		st.kind = stepWildcard
+	case len(parts) == 1 && strings.HasPrefix(parts[0], "?"):
+		return st, "", errors.New("filters are not supported")
+	case len(parts) == 1 && strings.Contains(parts[0], ":"):
+		st.kind = stepSlice
+		bounds := strings.SplitN(parts[0], ":", 2)
+		for j, b := range bounds {
+			if b = strings.TrimSpace(b); b == "" {
+				continue
+			}
+			n, err := strconv.Atoi(b)
+			if err != nil {
+				return st, "", fmt.Errorf("invalid slice: %q", parts[0])
+			}
+			if j == 0 {
+				st.start = &n
+			} else {
+				st.end = &n
+			}
+		}
+	default:
+		st.kind = stepIndexes
+		for _, p := range parts {
+			n, err := strconv.Atoi(p)
+			if err != nil {
+				return st, "", fmt.Errorf("invalid index: %q", p)
+			}
+			st.indexes = append(st.indexes, n)
+		}
+	}
+
+	return st, rest, nil
+}
+
+// String returns the source expression
+func (p *JSONPath) String() string {
+	return p.expr
+}
+
+// Definite reports whether the path may match one value at most
+func (p *JSONPath) Definite() bool {
+	for _, st := range p.steps {
+		if st.recursive || st.kind == stepWildcard || st.kind == stepSlice ||
+			len(st.names) > 1 || len(st.indexes) > 1 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Find returns values matching the path in a value decoded by encoding/json.
+//
+// Values of objects are visited in order of keys.
+func (p *JSONPath) Find(v interface{}) []interface{} {
+	nodes := []interface{}{v}
+
+	for _, st := range p.steps {
+		var next []interface{}
+		for _, n := range nodes {
+			if st.recursive {
+				for _, d := range descendants(n) {
+					next = append(next, st.apply(d)...)
+				}
+			} else {
+				next = append(next, st.apply(n)...)
+			}
+		}
+		nodes = next
+	}
+
+	return nodes
+}
+
+// FindJSON returns values matching the path in a JSON document
+func (p *JSONPath) FindJSON(data []byte) ([]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return p.Find(v), nil
+}
+
+// apply applies a step to a value
+func (st pathStep) apply(v interface{}) []interface{} {
+	var r []interface{}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		switch st.kind {
+		case stepNames:
+			for _, name := range st.names {
+				if x, ok := t[name]; ok {
+					r = append(r, x)
+				}
+			}
+		case stepWildcard:
+			for _, k := range sortedKeys(t) {
+				r = append(r, t[k])
+			}
+		}
+
+	case []interface{}:
+		switch st.kind {
+		case stepIndexes:
+			for _, i := range st.indexes {
+				if i < 0 {
+					i += len(t)
+				}
+				if i >= 0 && i < len(t) {
+					r = append(r, t[i])
+				}
+			}
+		case stepWildcard:
+			r = append(r, t...)
+		case stepSlice:
+			start, end := 0, len(t)
+			if st.start != nil {
+				start = clampIndex(*st.start, len(t))
+			}
+			if st.end != nil {
+				end = clampIndex(*st.end, len(t))
+			}
+			if start < end {
+				r = append(r, t[start:end]...)
+			}
+		}
+	}
+
+	return r
+}
+
+// clampIndex converts a possibly negative slice index into a valid one
+func clampIndex(i, n int) int {
+	if i < 0 {
+		i += n
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > n {
+		return n
+	}
+
+	return i
+}
+
+// descendants returns a value and all its descendants
+func descendants(v interface{}) []interface{} {
+	r := []interface{}{v}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(t) {
+			r = append(r, descendants(t[k])...)
+		}
+	case []interface{}:
+		for _, x := range t {
+			r = append(r, descendants(x)...)
+		}
+	}
+
+	return r
+}
+
+// sortedKeys returns keys of a map in order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// GetJSONPath performs a GET request and decodes values matching a JSONPath-like expression into target.
+//
+// If the path is definite, the only matching value is decoded, otherwise an array of all matching values is decoded.
+func (c *Cli) GetJSONPath(
+	ctx context.Context,
+	u string,
+	args url.Values,
+	header http.Header,
+	expr string,
+	target interface{},
+) error {
+	p, err := CompileJSONPath(expr)
+	if err != nil {
+		return err
+	}
+
+	var body json.RawMessage
+	if err := c.GetJSON(ctx, u, args, header, &body); err != nil {
+		return err
+	}
+
+	matches, err := p.FindJSON(body)
+	if err != nil {
+		return err
+	}
+
+	var b []byte
+	if p.Definite() {
+		if len(matches) == 0 {
+			return fmt.Errorf("no value at JSON path %q", expr)
+		}
+		b, err = json.Marshal(matches[0])
+	} else {
+		b, err = json.Marshal(matches)
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, target)
+}
+
+// StreamJSON performs a GET request and calls fn for each element of an array found at a JSON path,
+// without reading the whole response into memory.
+//
+// The path may contain names and indexes only and may end with [*]. Empty path means the top-level array.
+func (c *Cli) StreamJSON(
+	ctx context.Context,
+	u string,
+	args url.Values,
+	header http.Header,
+	expr string,
+	fn JSONElementFunc,
+) error {
+	if args != nil {
+		u = util.CombineURL(u, "", args)
+	}
+
+	header = jsonRequestHeader(header)
+
+	rsp, err := c.DoStream(ctx, http.MethodGet, u, header, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rsp.Body.Close()
+	}()
+
+	return DecodeJSONArray(rsp.Body, expr, fn)
+}
+
+// GetNDJSON performs a GET request and calls fn for each value of a newline delimited JSON response
+func (c *Cli) GetNDJSON(ctx context.Context, u string, args url.Values, header http.Header, fn JSONElementFunc) error {
+	if args != nil {
+		u = util.CombineURL(u, "", args)
+	}
+
+	header = jsonRequestHeader(fetchRequestHeader(header, "application/x-ndjson, application/jsonl, application/json"))
+
+	rsp, err := c.DoStream(ctx, http.MethodGet, u, header, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rsp.Body.Close()
+	}()
+
+	return DecodeNDJSON(rsp.Body, fn)
+}
+
+// jsonRequestHeader returns a copy of a header having headers of a JSON API request set
+func jsonRequestHeader(header http.Header) http.Header {
+	header = fetchRequestHeader(header, "application/json")
+	if header.Get("X-Requested-With") == "" {
+		header.Set("X-Requested-With", "XMLHttpRequest")
+	}
+
+	return header
+}
+
+// DecodeJSONArray calls fn for each element of an array found at a JSON path in a JSON stream.
+//
+// The path may contain names and indexes only and may end with [*]. Empty path means the top-level array.
+func DecodeJSONArray(r io.Reader, expr string, fn JSONElementFunc) error {
+	p, err := CompileJSONPath(expr)
+	if err != nil {
+		return err
+	}
+
+	steps := p.steps
+	if n := len(steps); n > 0 && steps[n-1].kind == stepWildcard && !steps[n-1].recursive {
+		steps = steps[:n-1]
+	}
+	for _, st := range steps {
+		if st.recursive || (st.kind != stepNames && st.kind != stepIndexes) || len(st.names) > 1 || len(st.indexes) > 1 {
+			return fmt.Errorf("JSON path %q cannot be streamed", expr)
+		}
+	}
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	// Find the array
+	for _, st := range steps {
+		if err := seekJSON(dec, st); err != nil {
+			return fmt.Errorf("JSON path %q: %v", expr, err)
+		}
+	}
+
+	if err := expectDelim(dec, '['); err != nil {
+		return fmt.Errorf("JSON path %q: %v", expr, err)
+	}
+
+	for i := 0; dec.More(); i++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+
+		if err := fn(i, raw); err != nil {
+			if errors.Is(err, ErrStopStream) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	return expectDelim(dec, ']')
+}
+
+// seekJSON moves a decoder to a value of an object member or an array element
+func seekJSON(dec *json.Decoder, st pathStep) error {
+	if st.kind == stepNames {
+		if err := expectDelim(dec, '{'); err != nil {
+			return err
+		}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if tok == st.names[0] {
+				return nil
+			}
+			if err := skipJSON(dec); err != nil {
+				return err
+			}
+		}
+		return fmt.Errorf("no member %q", st.names[0])
+	}
+
+	idx := st.indexes[0]
+	if idx < 0 {
+		return errors.New("negative indexes cannot be streamed")
+	}
+	if err := expectDelim(dec, '['); err != nil {
+		return err
+	}
+	for i := 0; dec.More(); i++ {
+		if i == idx {
+			return nil
+		}
+		if err := skipJSON(dec); err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("no element %d", idx)
+}
+
+// skipJSON skips the next value without keeping it in memory
+func skipJSON(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		if d, ok := tok.(json.Delim); ok {
+			if d == '{' || d == '[' {
+				depth++
+			} else {
+				depth--
+			}
+		}
+
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// expectDelim reads a delimiter token
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("expected %q, got %v", delim, tok)
+	}
+
+	return nil
+}
+
+// DecodeNDJSON calls fn for each value of a newline delimited JSON stream
+func DecodeNDJSON(r io.Reader, fn JSONElementFunc) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	for i := 0; ; i++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("invalid JSON value #%d: %v", i, err)
+		}
+
+		if err := fn(i, raw); err != nil {
+			if errors.Is(err, ErrStopStream) {
+				return nil
+			}
+			return err
+		}
+	}
+}
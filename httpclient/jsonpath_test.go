@@ -0,0 +1,220 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONPathFind(t *testing.T) {
+	doc := []byte(`{
+		"store": {
+			"book": [
+				{"title": "A", "price": 8, "tags": ["x"]},
+				{"title": "B", "price": 12},
+				{"title": "C", "price": 9}
+			],
+			"bicycle": {"color": "red", "price": 20}
+		},
+		"odd key": 1
+	}`)
+
+	tests := []struct {
+		expr     string
+		want     string
+		definite bool
+	}{
+		{"$", "", true},
+		{"$.store.bicycle.color", `["red"]`, true},
+		{"store.bicycle.color", `["red"]`, true},
+		{"$['odd key']", `[1]`, true},
+		{`$["store"]['bicycle']["color"]`, `["red"]`, true},
+		{"$.store.book[0].title", `["A"]`, true},
+		{"$.store.book[-1].title", `["C"]`, true},
+		{"$.store.book[5].title", `[]`, true},
+		{"$.store.book[*].title", `["A","B","C"]`, false},
+		{"$.store.book.*.price", `[8,12,9]`, false},
+		{"$.store.book[1:].title", `["B","C"]`, false},
+		{"$.store.book[:-1].title", `["A","B"]`, false},
+		{"$.store.book[0,2].title", `["A","C"]`, false},
+		{"$.store.bicycle['color','price']", `["red",20]`, false},
+		{"$..price", `[20,8,12,9]`, false},
+		{"$.store..title", `["A","B","C"]`, false},
+		{"$..book[0].title", `["A"]`, false},
+		{"$.store.*.color", `["red"]`, false},
+		{"$.missing.key", `[]`, true},
+	}
+
+	for _, tt := range tests {
+		p, err := CompileJSONPath(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if p.String() != tt.expr {
+			t.Errorf("%s: got string %q", tt.expr, p.String())
+		}
+		if p.Definite() != tt.definite {
+			t.Errorf("%s: got definite %v", tt.expr, p.Definite())
+		}
+		if tt.want == "" {
+			continue
+		}
+
+		r, err := p.FindJSON(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r == nil {
+			r = []interface{}{}
+		}
+		b, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.expr, b, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"$.a[", "$.a[x]", "$.a[?(@.b)]", "$.a[1:x]", "$.", "$.a..", "$['a'"} {
+		if _, err := CompileJSONPath(expr); err == nil {
+			t.Errorf("%s: no error", expr)
+		}
+	}
+}
+
+// collectJSON returns a JSONElementFunc appending raw values to a slice
+func collectJSON(r *[]string, limit int) JSONElementFunc {
+	return func(i int, raw json.RawMessage) error {
+		if i != len(*r) {
+			return errors.New("unexpected index")
+		}
+		*r = append(*r, string(raw))
+		if limit > 0 && len(*r) == limit {
+			return ErrStopStream
+		}
+		return nil
+	}
+}
+
+func TestDecodeJSONArray(t *testing.T) {
+	doc := `{"meta": {"items": [0]}, "data": [{"skip": [1, {"x": 2}]}, {"items": [{"a": 1}, [2], "3"]}]}`
+
+	tests := []struct {
+		expr  string
+		limit int
+		want  []string
+	}{
+		{"$.data[1].items", 0, []string{`{"a": 1}`, `[2]`, `"3"`}},
+		{"$.data[1].items[*]", 0, []string{`{"a": 1}`, `[2]`, `"3"`}},
+		{"data[1]['items']", 2, []string{`{"a": 1}`, `[2]`}},
+		{"$.meta.items", 0, []string{`0`}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		if err := DecodeJSONArray(strings.NewReader(doc), tt.expr, collectJSON(&got, tt.limit)); err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+
+	var got []string
+	if err := DecodeJSONArray(strings.NewReader(`[1, 2]`), "", collectJSON(&got, 0)); err != nil ||
+		!reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("top-level array: got %q, %v", got, err)
+	}
+
+	for _, expr := range []string{"$..items", "$.data[*].items", "$.data[-1]", "$.missing", "$.data[5]", "$.meta"} {
+		if err := DecodeJSONArray(strings.NewReader(doc), expr, collectJSON(&got, 0)); err == nil {
+			t.Errorf("%s: no error", expr)
+		}
+	}
+
+	fnErr := errors.New("fn failed")
+	err := DecodeJSONArray(strings.NewReader(`[1, 2]`), "", func(i int, raw json.RawMessage) error {
+		return fnErr
+	})
+	if !errors.Is(err, fnErr) {
+		t.Errorf("got error %v, want %v", err, fnErr)
+	}
+}
+
+func TestDecodeNDJSON(t *testing.T) {
+	var got []string
+	in := "{\"a\": 1}\n\n[2]\r\n  \"3\"\n4\n"
+	if err := DecodeNDJSON(strings.NewReader(in), collectJSON(&got, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`{"a": 1}`, `[2]`, `"3"`, `4`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = nil
+	if err := DecodeNDJSON(strings.NewReader(in), collectJSON(&got, 2)); err != nil || len(got) != 2 {
+		t.Errorf("got %q, %v", got, err)
+	}
+
+	got = nil
+	err := DecodeNDJSON(strings.NewReader("1\n{bad\n3\n"), collectJSON(&got, 0))
+	if err == nil || !strings.Contains(err.Error(), "#1") || len(got) != 1 {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
+
+func TestStreamJSONAndNDJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Requested-With") != "XMLHttpRequest" || r.Header.Get("Sec-Fetch-Mode") != "cors" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/json":
+			if r.Header.Get("Accept") != "application/json" || r.URL.Query().Get("page") != "2" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"items": [1, 2, 3]}`))
+		case "/ndjson":
+			if !strings.HasPrefix(r.Header.Get("Accept"), "application/x-ndjson") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte("1\n2\n3\n"))
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+
+	var got []string
+	err := c.StreamJSON(context.Background(), srv.URL+"/json", map[string][]string{"page": {"2"}}, nil, "$.items",
+		collectJSON(&got, 0))
+	if err != nil || !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+		t.Errorf("StreamJSON: got %q, %v", got, err)
+	}
+
+	got = nil
+	err = c.GetNDJSON(context.Background(), srv.URL+"/ndjson", nil, nil, collectJSON(&got, 2))
+	if err != nil || !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("GetNDJSON: got %q, %v", got, err)
+	}
+
+	// Caller headers are kept
+	got = nil
+	err = c.GetNDJSON(context.Background(), srv.URL+"/ndjson", nil, http.Header{"Accept": {"text/plain"}},
+		collectJSON(&got, 0))
+	if err == nil {
+		t.Errorf("GetNDJSON: Accept header is overwritten: %q", got)
+	}
+}
@@ -0,0 +1,377 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are default request latency histogram buckets, in seconds
+var DefaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// RequestCount is a number of request attempts having the same labels
+type RequestCount struct {
+	Host        string
+	Method      string
+	StatusClass string // "1xx" ... "5xx" or "error" if no response received
+	Attempt     int
+	Count       int64
+}
+
+// Latency is a request latency histogram of attempts having the same labels
+type Latency struct {
+	Host        string
+	Method      string
+	StatusClass string // "1xx" ... "5xx" or "error" if no response received
+	Attempt     int
+	Buckets     []float64 // upper bounds, in seconds
+	Counts      []int64   // cumulative counts per bucket
+	Count       int64
+	Sum         float64 // in seconds
+}
+
+// HostTraffic is a traffic and retries counters of a host
+type HostTraffic struct {
+	Host          string
+	BytesSent     int64
+	BytesReceived int64
+	Retries       int64
+}
+
+// MetricsSnapshot is a point-in-time copy of metrics
+type MetricsSnapshot struct {
+	Requests          []RequestCount
+	Latencies         []Latency
+	Hosts             []HostTraffic
+	InFlight          int64
+	ErrorHandlerCalls int64
+}
+
+type requestKey struct {
+	host    string
+	method  string
+	class   string
+	attempt int
+}
+
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+// Metrics collects HTTP client metrics
+type Metrics struct {
+	mux               sync.Mutex
+	buckets           []float64
+	requests          map[requestKey]int64
+	latencies         map[requestKey]*histogram
+	hosts             map[string]*HostTraffic
+	inFlight          int64
+	errorHandlerCalls int64
+}
+
+// NewMetrics creates a new metrics collector
+func NewMetrics() *Metrics {
+	m := &Metrics{buckets: DefaultLatencyBuckets}
+	m.Reset()
+
+	return m
+}
+
+// Metrics returns client's metrics collector
+func (c *Cli) Metrics() *Metrics {
+	c.metricsMux.RLock()
+	defer c.metricsMux.RUnlock()
+
+	return c.metrics
+}
+
+// SetMetrics sets client's metrics collector. It allows to share the same collector between several clients.
+func (c *Cli) SetMetrics(m *Metrics) {
+	if m == nil {
+		m = NewMetrics()
+	}
+
+	c.metricsMux.Lock()
+	c.metrics = m
+	c.metricsMux.Unlock()
+}
+
+// SetLatencyBuckets sets latency histogram buckets and resets collected latencies
+func (m *Metrics) SetLatencyBuckets(b []float64) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.buckets = append([]float64(nil), b...)
+	sort.Float64s(m.buckets)
+	m.latencies = make(map[requestKey]*histogram)
+}
+
+// Reset resets all the collected metrics except in-flight requests number
+func (m *Metrics) Reset() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.requests = make(map[requestKey]int64)
+	m.latencies = make(map[requestKey]*histogram)
+	m.hosts = make(map[string]*HostTraffic)
+	m.errorHandlerCalls = 0
+}
+
+// host returns traffic counters of a host
+func (m *Metrics) host(name string) *HostTraffic {
+	h, ok := m.hosts[name]
+	if !ok {
+		h = &HostTraffic{Host: name}
+		m.hosts[name] = h
+	}
+
+	return h
+}
+
+func (m *Metrics) incInFlight() {
+	m.mux.Lock()
+	m.inFlight++
+	m.mux.Unlock()
+}
+
+func (m *Metrics) decInFlight() {
+	m.mux.Lock()
+	m.inFlight--
+	m.mux.Unlock()
+}
+
+func (m *Metrics) addErrorHandlerCall() {
+	m.mux.Lock()
+	m.errorHandlerCalls++
+	m.mux.Unlock()
+}
+
+func (m *Metrics) addRetry(host string) {
+	m.mux.Lock()
+	m.host(host).Retries++
+	m.mux.Unlock()
+}
+
+// observe records a request attempt
+func (m *Metrics) observe(host, method string, rsp *http.Response, err error, attempt, sent, received int, d time.Duration) {
+	class := "error"
+	if rsp != nil {
+		class = fmt.Sprintf("%dxx", rsp.StatusCode/100)
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	key := requestKey{host, method, class, attempt}
+	m.requests[key]++
+
+	h := m.host(host)
+	h.BytesSent += int64(sent)
+	h.BytesReceived += int64(received)
+
+	hg, ok := m.latencies[key]
+	if !ok {
+		hg = &histogram{counts: make([]int64, len(m.buckets))}
+		m.latencies[key] = hg
+	}
+
+	sec := d.Seconds()
+	for i, b := range m.buckets {
+		if sec <= b {
+			hg.counts[i]++
+		}
+	}
+	hg.count++
+	hg.sum += sec
+}
+
+// Snapshot returns a copy of collected metrics
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	r := MetricsSnapshot{
+		InFlight:          m.inFlight,
+		ErrorHandlerCalls: m.errorHandlerCalls,
+	}
+
+	for k, v := range m.requests {
+		r.Requests = append(r.Requests, RequestCount{
+			Host:        k.host,
+			Method:      k.method,
+			StatusClass: k.class,
+			Attempt:     k.attempt,
+			Count:       v,
+		})
+	}
+	sort.Slice(r.Requests, func(i, j int) bool {
+		a, b := r.Requests[i], r.Requests[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Method != b.Method {
+			return a.Method < b.Method
+		}
+		if a.StatusClass != b.StatusClass {
+			return a.StatusClass < b.StatusClass
+		}
+		return a.Attempt < b.Attempt
+	})
+
+	for k, v := range m.latencies {
+		r.Latencies = append(r.Latencies, Latency{
+			Host:        k.host,
+			Method:      k.method,
+			StatusClass: k.class,
+			Attempt:     k.attempt,
+			Buckets:     append([]float64(nil), m.buckets...),
+			Counts:      append([]int64(nil), v.counts...),
+			Count:       v.count,
+			Sum:         v.sum,
+		})
+	}
+	sort.Slice(r.Latencies, func(i, j int) bool {
+		a, b := r.Latencies[i], r.Latencies[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Method != b.Method {
+			return a.Method < b.Method
+		}
+		if a.StatusClass != b.StatusClass {
+			return a.StatusClass < b.StatusClass
+		}
+		return a.Attempt < b.Attempt
+	})
+
+	for _, h := range m.hosts {
+		r.Hosts = append(r.Hosts, *h)
+	}
+	sort.Slice(r.Hosts, func(i, j int) bool {
+		return r.Hosts[i].Host < r.Hosts[j].Host
+	})
+
+	return r
+}
+
+// String returns human readable representation of the snapshot
+func (s MetricsSnapshot) String() string {
+	buf := bytes.NewBuffer(nil)
+
+	buf.WriteString("requests:\n")
+	for _, r := range s.Requests {
+		buf.WriteString(fmt.Sprintf("  %s %s %s attempt=%d: %d\n", r.Host, r.Method, r.StatusClass, r.Attempt, r.Count))
+	}
+
+	buf.WriteString("latencies:\n")
+	for _, l := range s.Latencies {
+		avg := 0.0
+		if l.Count > 0 {
+			avg = l.Sum / float64(l.Count)
+		}
+		buf.WriteString(fmt.Sprintf("  %s %s %s attempt=%d: count=%d avg=%.3fs\n",
+			l.Host, l.Method, l.StatusClass, l.Attempt, l.Count, avg))
+	}
+
+	buf.WriteString("hosts:\n")
+	for _, h := range s.Hosts {
+		buf.WriteString(fmt.Sprintf("  %s: sent=%d received=%d retries=%d\n",
+			h.Host, h.BytesSent, h.BytesReceived, h.Retries))
+	}
+
+	buf.WriteString(fmt.Sprintf("in flight: %d\n", s.InFlight))
+	buf.WriteString(fmt.Sprintf("error handler calls: %d\n", s.ErrorHandlerCalls))
+
+	return buf.String()
+}
+
+// WritePrometheus writes metrics in Prometheus text exposition format
+func (s MetricsSnapshot) WritePrometheus(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+
+	buf.WriteString("# HELP aghpu_http_requests_total Number of HTTP request attempts.\n")
+	buf.WriteString("# TYPE aghpu_http_requests_total counter\n")
+	for _, r := range s.Requests {
+		buf.WriteString(fmt.Sprintf("aghpu_http_requests_total{%s} %d\n", promLabels(
+			"host", r.Host,
+			"method", r.Method,
+			"status", r.StatusClass,
+			"attempt", strconv.Itoa(r.Attempt),
+		), r.Count))
+	}
+
+	buf.WriteString("# HELP aghpu_http_request_duration_seconds HTTP request attempt duration.\n")
+	buf.WriteString("# TYPE aghpu_http_request_duration_seconds histogram\n")
+	for _, l := range s.Latencies {
+		kv := []string{"host", l.Host, "method", l.Method, "status", l.StatusClass, "attempt", strconv.Itoa(l.Attempt)}
+		bucketLabels := func(le string) string {
+			return promLabels(append(kv[:len(kv):len(kv)], "le", le)...)
+		}
+
+		for i, b := range l.Buckets {
+			buf.WriteString(fmt.Sprintf("aghpu_http_request_duration_seconds_bucket{%s} %d\n",
+				bucketLabels(strconv.FormatFloat(b, 'g', -1, 64)), l.Counts[i]))
+		}
+		buf.WriteString(fmt.Sprintf("aghpu_http_request_duration_seconds_bucket{%s} %d\n", bucketLabels("+Inf"), l.Count))
+
+		lb := promLabels(kv...)
+		buf.WriteString(fmt.Sprintf("aghpu_http_request_duration_seconds_sum{%s} %g\n", lb, l.Sum))
+		buf.WriteString(fmt.Sprintf("aghpu_http_request_duration_seconds_count{%s} %d\n", lb, l.Count))
+	}
+
+	buf.WriteString("# HELP aghpu_http_request_bytes_total Number of HTTP request body bytes sent.\n")
+	buf.WriteString("# TYPE aghpu_http_request_bytes_total counter\n")
+	for _, h := range s.Hosts {
+		buf.WriteString(fmt.Sprintf("aghpu_http_request_bytes_total{%s} %d\n", promLabels("host", h.Host), h.BytesSent))
+	}
+
+	buf.WriteString("# HELP aghpu_http_response_bytes_total Number of HTTP response body bytes received.\n")
+	buf.WriteString("# TYPE aghpu_http_response_bytes_total counter\n")
+	for _, h := range s.Hosts {
+		buf.WriteString(fmt.Sprintf("aghpu_http_response_bytes_total{%s} %d\n", promLabels("host", h.Host), h.BytesReceived))
+	}
+
+	buf.WriteString("# HELP aghpu_http_retries_total Number of HTTP request retries.\n")
+	buf.WriteString("# TYPE aghpu_http_retries_total counter\n")
+	for _, h := range s.Hosts {
+		buf.WriteString(fmt.Sprintf("aghpu_http_retries_total{%s} %d\n", promLabels("host", h.Host), h.Retries))
+	}
+
+	buf.WriteString("# HELP aghpu_http_in_flight_requests Number of HTTP requests in flight.\n")
+	buf.WriteString("# TYPE aghpu_http_in_flight_requests gauge\n")
+	buf.WriteString(fmt.Sprintf("aghpu_http_in_flight_requests %d\n", s.InFlight))
+
+	buf.WriteString("# HELP aghpu_http_error_handler_calls_total Number of error handler invocations.\n")
+	buf.WriteString("# TYPE aghpu_http_error_handler_calls_total counter\n")
+	buf.WriteString(fmt.Sprintf("aghpu_http_error_handler_calls_total %d\n", s.ErrorHandlerCalls))
+
+	return buf.Flush()
+}
+
+// Handler returns an HTTP handler exposing metrics in Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = m.Snapshot().WritePrometheus(w)
+	})
+}
+
+// promLabels formats label pairs
+func promLabels(kv ...string) string {
+	r := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(kv[i+1])
+		r = append(r, fmt.Sprintf("%s=\"%s\"", kv[i], v))
+	}
+
+	return strings.Join(r, ",")
+}
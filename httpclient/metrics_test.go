@@ -0,0 +1,88 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetRecoveryHandler(func(ctx context.Context, c *Cli, f *Failure) Decision {
+		return DecideRetryNow()
+	})
+
+	m := NewMetrics()
+	c.SetMetrics(m)
+	if _, err := c.Get(context.Background(), srv.URL, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse(srv.URL)
+	s := m.Snapshot()
+	if len(s.Latencies) != 2 {
+		t.Fatalf("got latencies %+v", s.Latencies)
+	}
+	for i, want := range []struct {
+		class   string
+		attempt int
+	}{{"2xx", 2}, {"5xx", 1}} {
+		l := s.Latencies[i]
+		if l.Host != u.Host || l.Method != http.MethodGet || l.StatusClass != want.class || l.Attempt != want.attempt ||
+			l.Count != 1 {
+			t.Errorf("got latency %+v", l)
+		}
+	}
+	if len(s.Hosts) != 1 || s.Hosts[0].Retries != 1 || s.Hosts[0].BytesReceived != 2 || s.InFlight != 0 {
+		t.Errorf("got %+v", s)
+	}
+
+	var buf bytes.Buffer
+	if err := s.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `aghpu_http_request_duration_seconds_count{host="` + u.Host + `",method="GET",status="5xx",attempt="1"} 1`
+	if !strings.Contains(buf.String(), want+"\n") {
+		t.Errorf("no %s in:\n%s", want, buf.String())
+	}
+	want = `aghpu_http_request_duration_seconds_bucket{host="` + u.Host + `",method="GET",status="2xx",attempt="2",le="60"} 1`
+	if !strings.Contains(buf.String(), want+"\n") {
+		t.Errorf("no %s in:\n%s", want, buf.String())
+	}
+
+	// Every sample of a histogram has its own label set
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if !strings.HasPrefix(line, "aghpu_http_request_duration_seconds") {
+			continue
+		}
+		sample := line[:strings.LastIndex(line, " ")]
+		if seen[sample] {
+			t.Errorf("duplicate sample %s", sample)
+		}
+		seen[sample] = true
+	}
+	if n := len(seen); n != 2*(len(DefaultLatencyBuckets)+3) {
+		t.Errorf("got %d histogram samples", n)
+	}
+
+	c.SetMetrics(nil)
+	if c.Metrics() == m || c.Metrics() == nil {
+		t.Error("collector is not replaced")
+	}
+}
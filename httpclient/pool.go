@@ -0,0 +1,276 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// ErrPoolClosed is returned when a job is submitted to a closed pool
+var ErrPoolClosed = errors.New("pool is closed")
+
+// Job is a request to be performed by a pool
+type Job struct {
+	Method   string
+	URL      string
+	Header   http.Header
+	Body     []byte
+	Priority int         // jobs having higher priority are performed first
+	Tag      interface{} // arbitrary caller's data, passed back with the result
+
+	host string
+}
+
+// Result is a result of a job
+type Result struct {
+	Job      *Job
+	Response *http.Response
+	Body     []byte
+	Err      error
+}
+
+// ResultHandler is a pool job result handler
+type ResultHandler func(r *Result)
+
+// Pool performs jobs using a client with bounded concurrency.
+//
+// Jobs are performed in order of their priority, jobs having the same priority are performed in order of submission.
+// Retries and error handling are performed by the client.
+type Pool struct {
+	cli       *Cli
+	workers   int
+	hostLimit int
+	handler   ResultHandler
+
+	mux       sync.Mutex
+	cond      *sync.Cond
+	queue     []*Job
+	hostBusy  map[string]int
+	started   bool
+	closed    bool
+	cancelled bool
+
+	wg       sync.WaitGroup
+	finished chan struct{} // closed after all workers finish
+	results  chan *Result
+}
+
+// NewPool creates a new pool having specified number of workers
+func (c *Cli) NewPool(workers int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	p := &Pool{
+		cli:      c,
+		workers:  workers,
+		hostBusy: make(map[string]int),
+		finished: make(chan struct{}),
+		results:  make(chan *Result, workers),
+	}
+	p.cond = sync.NewCond(&p.mux)
+
+	return p
+}
+
+// SetHostLimit sets maximum number of concurrent requests per host. Zero means no limit.
+func (p *Pool) SetHostLimit(n int) {
+	p.mux.Lock()
+	p.hostLimit = n
+	p.mux.Unlock()
+	p.cond.Broadcast()
+}
+
+// SetResultHandler sets a result handler.
+//
+// If the handler is set, results are passed to it instead of the results channel.
+// The handler is called from worker goroutines, so it must be safe for concurrent use.
+func (p *Pool) SetResultHandler(fn ResultHandler) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.handler = fn
+}
+
+// Results returns results channel. It is closed after all workers finish.
+func (p *Pool) Results() <-chan *Result {
+	return p.results
+}
+
+// Start starts workers. Cancelling the context cancels all the queued jobs.
+func (p *Pool) Start(ctx context.Context) {
+	p.mux.Lock()
+	if p.started {
+		p.mux.Unlock()
+		return
+	}
+	p.started = true
+	p.mux.Unlock()
+
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.work(ctx)
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-p.finished:
+			return
+		}
+		p.mux.Lock()
+		p.cancelled = true
+		p.mux.Unlock()
+		p.cond.Broadcast()
+	}()
+
+	go func() {
+		p.wg.Wait()
+		close(p.finished)
+		close(p.results)
+	}()
+}
+
+// Submit adds a job to the queue
+func (p *Pool) Submit(job *Job) error {
+	u, err := url.Parse(job.URL)
+	if err != nil {
+		return err
+	}
+
+	if job.Method == "" {
+		job.Method = http.MethodGet
+	}
+
+	p.mux.Lock()
+	if p.closed || p.cancelled {
+		p.mux.Unlock()
+		return ErrPoolClosed
+	}
+
+	job.host = u.Host
+
+	// Keep the queue sorted by priority and submission order
+	i := sort.Search(len(p.queue), func(i int) bool {
+		return p.queue[i].Priority < job.Priority
+	})
+	p.queue = append(p.queue, nil)
+	copy(p.queue[i+1:], p.queue[i:])
+	p.queue[i] = job
+	p.mux.Unlock()
+
+	p.cond.Broadcast()
+
+	return nil
+}
+
+// Close closes the pool for new jobs. Workers exit after the queue is drained.
+func (p *Pool) Close() {
+	p.mux.Lock()
+	p.closed = true
+	p.mux.Unlock()
+	p.cond.Broadcast()
+}
+
+// Wait waits until all the workers finish
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+// Len returns number of queued jobs
+func (p *Pool) Len() int {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	return len(p.queue)
+}
+
+// next returns next job to perform, or nil if the worker should exit
+func (p *Pool) next() *Job {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	for {
+		if p.cancelled {
+			return nil
+		}
+
+		for i, job := range p.queue {
+			if p.hostLimit > 0 && p.hostBusy[job.host] >= p.hostLimit {
+				continue
+			}
+
+			p.queue = append(p.queue[:i], p.queue[i+1:]...)
+			p.hostBusy[job.host]++
+
+			return job
+		}
+
+		if p.closed && len(p.queue) == 0 {
+			return nil
+		}
+
+		p.cond.Wait()
+	}
+}
+
+// done marks a job as done
+func (p *Pool) done(job *Job) {
+	p.mux.Lock()
+	p.hostBusy[job.host]--
+	if p.hostBusy[job.host] <= 0 {
+		delete(p.hostBusy, job.host)
+	}
+	p.mux.Unlock()
+
+	p.cond.Broadcast()
+}
+
+// deliver passes a result to the handler or to the results channel
+func (p *Pool) deliver(r *Result) {
+	p.mux.Lock()
+	fn := p.handler
+	p.mux.Unlock()
+
+	if fn != nil {
+		fn(r)
+		return
+	}
+
+	p.results <- r
+}
+
+// work is a worker loop
+func (p *Pool) work(ctx context.Context) {
+	defer p.wg.Done()
+
+	for {
+		job := p.next()
+		if job == nil {
+			break
+		}
+
+		rsp, body, err := p.cli.DoRequest(ctx, job.Method, job.URL, job.Header, job.Body)
+		p.done(job)
+		p.deliver(&Result{Job: job, Response: rsp, Body: body, Err: err})
+	}
+
+	// Report cancelled jobs
+	if ctx.Err() != nil {
+		for {
+			p.mux.Lock()
+			if len(p.queue) == 0 {
+				p.mux.Unlock()
+				break
+			}
+			job := p.queue[0]
+			p.queue = p.queue[1:]
+			p.mux.Unlock()
+
+			p.deliver(&Result{Job: job, Err: ctx.Err()})
+		}
+	}
+}
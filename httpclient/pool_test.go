@@ -0,0 +1,194 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPoolPriority(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	p := newTestCli(t).NewPool(1)
+	jobs := []struct {
+		name     string
+		priority int
+	}{
+		{"a", 0}, {"b", 1}, {"c", -1}, {"d", 1}, {"e", 0}, {"f", 5},
+	}
+	for _, j := range jobs {
+		if err := p.Submit(&Job{URL: srv.URL + "/" + j.name, Priority: j.priority, Tag: j.name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := p.Len(); n != len(jobs) {
+		t.Errorf("got %d queued jobs, want %d", n, len(jobs))
+	}
+
+	var got []string
+	p.SetResultHandler(func(r *Result) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+		got = append(got, r.Job.Tag.(string))
+	})
+	p.Start(context.Background())
+	p.Close()
+	p.Wait()
+
+	if want := []string{"f", "b", "d", "a", "e", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got order %q, want %q", got, want)
+	}
+}
+
+func TestPoolHostLimit(t *testing.T) {
+	var (
+		mux      sync.Mutex
+		active   = make(map[string]int)
+		maxHost  int
+		total    int
+		maxTotal int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		active[r.Host]++
+		total++
+		if active[r.Host] > maxHost {
+			maxHost = active[r.Host]
+		}
+		if total > maxTotal {
+			maxTotal = total
+		}
+		mux.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mux.Lock()
+		active[r.Host]--
+		total--
+		mux.Unlock()
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := newTestCli(t).NewPool(4)
+	p.SetHostLimit(1)
+
+	// Jobs of a busy host don't block jobs of other hosts queued after them
+	for _, host := range []string{"127.0.0.1", "localhost"} {
+		for i := 0; i < 4; i++ {
+			if err := p.Submit(&Job{URL: "http://" + host + ":" + u.Port() + "/"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	p.Start(context.Background())
+	p.Close()
+	for r := range p.Results() {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+	}
+
+	if maxHost != 1 || maxTotal != 2 {
+		t.Errorf("got %d concurrent requests per host and %d in total, want 1 and 2", maxHost, maxTotal)
+	}
+}
+
+func TestPoolCancel(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := newTestCli(t).NewPool(1)
+	for i := 0; i < 5; i++ {
+		if err := p.Submit(&Job{URL: srv.URL, Tag: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Start(ctx)
+	<-started
+	cancel()
+
+	// Jobs still queued are reported as cancelled rather than dropped
+	tags := make(map[int]bool)
+	for r := range p.Results() {
+		// The job in progress fails with a wrapped error
+		if !errors.Is(r.Err, context.Canceled) || (r.Job.Tag != 0 && r.Err != context.Canceled) || r.Response != nil {
+			t.Errorf("job %v: got %v, %v, want context canceled", r.Job.Tag, r.Response, r.Err)
+		}
+		tags[r.Job.Tag.(int)] = true
+	}
+	if len(tags) != 5 {
+		t.Errorf("got results of %d jobs, want 5", len(tags))
+	}
+	if n := p.Len(); n != 0 {
+		t.Errorf("got %d queued jobs", n)
+	}
+	if err := p.Submit(&Job{URL: srv.URL}); err != ErrPoolClosed {
+		t.Errorf("got error %v, want ErrPoolClosed", err)
+	}
+}
+
+func TestPoolGoroutines(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	before := runtime.NumGoroutine()
+
+	p := c.NewPool(3)
+	p.Start(context.Background())
+	for _, path := range []string{"/a", "/b", "/c", "/d"} {
+		if err := p.Submit(&Job{URL: srv.URL + path}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Close()
+
+	n := 0
+	for r := range p.Results() {
+		if r.Err != nil || string(r.Body) != r.Job.URL[len(srv.URL):] {
+			t.Errorf("got %q, %v", r.Body, r.Err)
+		}
+		n++
+	}
+	if n != 4 {
+		t.Errorf("got %d results, want 4", n)
+	}
+	if err := p.Submit(&Job{URL: srv.URL}); err != ErrPoolClosed {
+		t.Errorf("got error %v, want ErrPoolClosed", err)
+	}
+
+	// Pool goroutines exit even though the context is never cancelled
+	c.Client().CloseIdleConnections()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d goroutines, want %d at most", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,380 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// HeaderField is a header name and value pair
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// Profile is a browser identity: a consistent set of headers sent by a particular browser.
+//
+// Headers are listed in the order the browser sends them. Accept-Language is taken from a Locale.
+// Note that net/http writes headers in its own order, so the order is honoured only by tools which can do it,
+// such as curl export.
+// Only encodings the client is able to decode (gzip and deflate) should be listed in Accept-Encoding.
+type Profile struct {
+	Name    string
+	Headers []HeaderField
+}
+
+// Get returns a value of profile's header
+func (p Profile) Get(name string) string {
+	for _, h := range p.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+
+	return ""
+}
+
+// UserAgent returns profile's user agent
+func (p Profile) UserAgent() string {
+	return p.Get("User-Agent")
+}
+
+// HeaderOrder returns names of profile's headers in order
+func (p Profile) HeaderOrder() []string {
+	r := make([]string, 0, len(p.Headers))
+	for _, h := range p.Headers {
+		r = append(r, h.Name)
+	}
+
+	return r
+}
+
+// Locale defines language preferences of a target market
+type Locale struct {
+	Name           string
+	AcceptLanguage string
+}
+
+const htmlAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"
+
+// Predefined browser profiles
+var (
+	ProfileChrome = Profile{
+		Name: "chrome",
+		Headers: []HeaderField{
+			{"Cache-Control", "max-age=0"},
+			{"Sec-Ch-Ua", `"Google Chrome";v="141", "Not?A_Brand";v="8", "Chromium";v="141"`},
+			{"Sec-Ch-Ua-Mobile", "?0"},
+			{"Sec-Ch-Ua-Platform", `"Windows"`},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 " +
+				"(KHTML, like Gecko) Chrome/141.0.0.0 Safari/537.36"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-User", "?1"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Accept-Encoding", "gzip, deflate"},
+			{"Accept-Language", ""},
+		},
+	}
+
+	ProfileChromeAndroid = Profile{
+		Name: "chrome-android",
+		Headers: []HeaderField{
+			{"Cache-Control", "max-age=0"},
+			{"Sec-Ch-Ua", `"Google Chrome";v="141", "Not?A_Brand";v="8", "Chromium";v="141"`},
+			{"Sec-Ch-Ua-Mobile", "?1"},
+			{"Sec-Ch-Ua-Platform", `"Android"`},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"User-Agent", "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 " +
+				"(KHTML, like Gecko) Chrome/141.0.0.0 Mobile Safari/537.36"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-User", "?1"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Accept-Encoding", "gzip, deflate"},
+			{"Accept-Language", ""},
+		},
+	}
+
+	ProfileFirefox = Profile{
+		Name: "firefox",
+		Headers: []HeaderField{
+			{"User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:144.0) Gecko/20100101 Firefox/144.0"},
+			{"Accept", htmlAccept},
+			{"Accept-Language", ""},
+			{"Accept-Encoding", "gzip, deflate"},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-User", "?1"},
+		},
+	}
+
+	ProfileFirefoxAndroid = Profile{
+		Name: "firefox-android",
+		Headers: []HeaderField{
+			{"User-Agent", "Mozilla/5.0 (Android 14; Mobile; rv:144.0) Gecko/144.0 Firefox/144.0"},
+			{"Accept", htmlAccept},
+			{"Accept-Language", ""},
+			{"Accept-Encoding", "gzip, deflate"},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-User", "?1"},
+		},
+	}
+
+	ProfileSafari = Profile{
+		Name: "safari",
+		Headers: []HeaderField{
+			{"Sec-Fetch-Dest", "document"},
+			{"User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 " +
+				"(KHTML, like Gecko) Version/26.0 Safari/605.1.15"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Accept-Language", ""},
+			{"Accept-Encoding", "gzip, deflate"},
+		},
+	}
+
+	ProfileSafariIOS = Profile{
+		Name: "safari-ios",
+		Headers: []HeaderField{
+			{"Sec-Fetch-Dest", "document"},
+			{"User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 18_6 like Mac OS X) AppleWebKit/605.1.15 " +
+				"(KHTML, like Gecko) Version/26.0 Mobile/15E148 Safari/604.1"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Accept-Language", ""},
+			{"Accept-Encoding", "gzip, deflate"},
+		},
+	}
+)
+
+// Profiles are all the predefined browser profiles
+var Profiles = []Profile{
+	ProfileChrome,
+	ProfileChromeAndroid,
+	ProfileFirefox,
+	ProfileFirefoxAndroid,
+	ProfileSafari,
+	ProfileSafariIOS,
+}
+
+// ProfileByName returns a predefined browser profile by its name
+func ProfileByName(name string) (Profile, bool) {
+	for _, p := range Profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+
+	return Profile{}, false
+}
+
+// Predefined locales
+var (
+	LocaleEnUS = Locale{"en-US", "en-US,en;q=0.9"}
+	LocaleEnGB = Locale{"en-GB", "en-GB,en;q=0.9"}
+	LocaleDeDE = Locale{"de-DE", "de-DE,de;q=0.9,en;q=0.8"}
+	LocaleFrFR = Locale{"fr-FR", "fr-FR,fr;q=0.9,en;q=0.8"}
+	LocalePlPL = Locale{"pl-PL", "pl-PL,pl;q=0.9,en;q=0.8"}
+	LocaleUkUA = Locale{"uk-UA", "uk-UA,uk;q=0.9,en;q=0.8"}
+	LocaleRuRU = Locale{"ru-RU", "ru-RU,ru;q=0.9,en;q=0.8"}
+)
+
+// browser is client's current browser identity
+type browser struct {
+	mux      sync.RWMutex
+	profile  Profile
+	locale   Locale
+	rotation []Profile
+}
+
+// SetProfile sets browser profile and disables profile rotation
+func (c *Cli) SetProfile(p Profile) {
+	c.browser.mux.Lock()
+	defer c.browser.mux.Unlock()
+
+	c.browser.profile = p
+	c.browser.rotation = nil
+}
+
+// SetProfiles sets browser profiles to rotate. A random one of them is chosen now and after each Reset.
+func (c *Cli) SetProfiles(ps ...Profile) {
+	c.browser.mux.Lock()
+	defer c.browser.mux.Unlock()
+
+	c.browser.rotation = append([]Profile(nil), ps...)
+	c.browser.rotate()
+}
+
+// SetLocale sets locale which defines Accept-Language header
+func (c *Cli) SetLocale(l Locale) {
+	c.browser.mux.Lock()
+	defer c.browser.mux.Unlock()
+
+	c.browser.locale = l
+}
+
+// Profile returns current browser profile
+func (c *Cli) Profile() Profile {
+	c.browser.mux.RLock()
+	defer c.browser.mux.RUnlock()
+
+	return c.browser.profile
+}
+
+// Locale returns current locale
+func (c *Cli) Locale() Locale {
+	c.browser.mux.RLock()
+	defer c.browser.mux.RUnlock()
+
+	return c.browser.locale
+}
+
+// rotate chooses a random profile from the rotation
+func (b *browser) rotate() {
+	if len(b.rotation) > 0 {
+		b.profile = b.rotation[rand.Intn(len(b.rotation))]
+	}
+}
+
+// fetchHeaders are values of profile headers for requests made by scripts rather than by navigating to a page
+var fetchHeaders = map[string]string{
+	"Sec-Fetch-Site": "same-origin",
+	"Sec-Fetch-Dest": "empty",
+}
+
+// navigationHeaders are profile headers sent only when navigating to a page
+var navigationHeaders = map[string]bool{
+	"Cache-Control":             true,
+	"Upgrade-Insecure-Requests": true,
+	"Sec-Fetch-User":            true,
+}
+
+// fetchRequestHeader returns a copy of a header of a request made by a script, like fetch() or XMLHttpRequest.
+// Accept is set if it's not set yet.
+func fetchRequestHeader(header http.Header, accept string) http.Header {
+	if header == nil {
+		header = http.Header{}
+	} else {
+		header = header.Clone()
+	}
+
+	if header.Get("Accept") == "" {
+		header.Set("Accept", accept)
+	}
+	if header.Get("Sec-Fetch-Mode") == "" {
+		header.Set("Sec-Fetch-Mode", "cors")
+	}
+
+	return header
+}
+
+// setProfileHeaders sets headers of current profile which are not set yet.
+//
+// If Sec-Fetch-Mode is set to other mode than "navigate", headers are set like for a request made by a script.
+func (c *Cli) setProfileHeaders(header http.Header) {
+	c.browser.mux.RLock()
+	defer c.browser.mux.RUnlock()
+
+	fetch := header.Get("Sec-Fetch-Mode") != "" && header.Get("Sec-Fetch-Mode") != "navigate"
+
+	for _, h := range c.browser.profile.Headers {
+		name := http.CanonicalHeaderKey(h.Name)
+		if fetch && navigationHeaders[name] {
+			continue
+		}
+
+		v := h.Value
+		if fv, ok := fetchHeaders[name]; ok && fetch {
+			v = fv
+		}
+		if name == "Accept-Language" {
+			v = c.browser.locale.AcceptLanguage
+		}
+		if name == "User-Agent" && c.userAgent != "" {
+			v = c.userAgent
+		}
+
+		if v != "" && header.Get(h.Name) == "" {
+			header.Set(h.Name, v)
+		}
+	}
+}
+
+// decodeBody decodes a response body according to its Content-Encoding
+func decodeBody(rsp *http.Response, body []byte) ([]byte, error) {
+	enc := strings.ToLower(strings.TrimSpace(rsp.Header.Get("Content-Encoding")))
+	if enc == "" || enc == "identity" || len(body) == 0 {
+		return body, nil
+	}
+
+	rd, err := decodeReader(enc, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rd.Close()
+	}()
+
+	r, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s response body: %v", enc, err)
+	}
+
+	rsp.Header.Del("Content-Encoding")
+	rsp.Header.Set("Content-Length", strconv.Itoa(len(r)))
+	rsp.ContentLength = int64(len(r))
+	rsp.Uncompressed = true
+
+	return r, nil
+}
+
+// decodeReader returns a reader decoding data encoded with enc
+func decodeReader(enc string, r io.Reader) (io.ReadCloser, error) {
+	var (
+		rd  io.ReadCloser
+		err error
+	)
+	switch enc {
+	case "", "identity":
+		return ioutil.NopCloser(r), nil
+	case "gzip", "x-gzip":
+		rd, err = gzip.NewReader(r)
+	case "deflate":
+		// Most servers send zlib wrapped data, but some send raw deflate one
+		br := bufio.NewReader(r)
+		if b, pErr := br.Peek(2); pErr == nil && b[0]&0x0f == 8 && (uint(b[0])<<8|uint(b[1]))%31 == 0 {
+			rd, err = zlib.NewReader(br)
+		} else {
+			rd = flate.NewReader(br)
+		}
+	default:
+		// Retrying doesn't help, the server would send the same encoding again
+		return nil, &permanentError{err: fmt.Errorf("unsupported content encoding: %s", enc)}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s response body: %v", enc, err)
+	}
+
+	return rd, nil
+}
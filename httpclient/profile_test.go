@@ -0,0 +1,105 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestJSONRequestHeaders(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetProfile(ProfileChrome)
+
+	checkFetch := func(name string) {
+		t.Helper()
+		if v := got.Get("Accept"); v != "application/json" {
+			t.Errorf("%s: got Accept %q", name, v)
+		}
+		if v := got.Get("Sec-Fetch-Mode"); v != "cors" {
+			t.Errorf("%s: got Sec-Fetch-Mode %q", name, v)
+		}
+		if v := got.Get("Sec-Fetch-Dest"); v != "empty" {
+			t.Errorf("%s: got Sec-Fetch-Dest %q", name, v)
+		}
+		for _, h := range []string{"Sec-Fetch-User", "Upgrade-Insecure-Requests"} {
+			if v := got.Get(h); v != "" {
+				t.Errorf("%s: got navigation header %s: %q", name, h, v)
+			}
+		}
+		if v := got.Get("User-Agent"); v != ProfileChrome.UserAgent() {
+			t.Errorf("%s: got User-Agent %q", name, v)
+		}
+	}
+
+	header := http.Header{"X-Custom": {"1"}}
+	var v map[string]interface{}
+	if err := c.GetJSON(context.Background(), srv.URL, nil, header, &v); err != nil {
+		t.Fatal(err)
+	}
+	checkFetch("GetJSON")
+	if len(header) != 1 {
+		t.Errorf("caller's header is modified: %v", header)
+	}
+
+	if _, err := c.PostJSON(context.Background(), srv.URL, nil, v); err != nil {
+		t.Fatal(err)
+	}
+	checkFetch("PostJSON")
+	if ct := got.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("PostJSON: got Content-Type %q", ct)
+	}
+
+	if err := c.GetJSONPath(context.Background(), srv.URL, nil, nil, "$", &v); err != nil {
+		t.Fatal(err)
+	}
+	checkFetch("GetJSONPath")
+
+	// Pages are requested like a browser navigates to them
+	if _, err := c.Get(context.Background(), srv.URL, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if v := got.Get("Accept"); !strings.HasPrefix(v, "text/html") {
+		t.Errorf("Get: got Accept %q", v)
+	}
+	if v := got.Get("Sec-Fetch-Mode"); v != "navigate" {
+		t.Errorf("Get: got Sec-Fetch-Mode %q", v)
+	}
+}
+
+func TestUnsupportedEncodingNotRetried(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Encoding", "br")
+		_, _ = w.Write([]byte("\x1b\x00"))
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetMaxRetries(3)
+
+	_, err := c.Get(context.Background(), srv.URL, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "unsupported content encoding: br") {
+		t.Errorf("got error %v", err)
+	}
+
+	_, err = c.DoStream(context.Background(), http.MethodGet, srv.URL, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "unsupported content encoding: br") {
+		t.Errorf("stream: got error %v", err)
+	}
+
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+}
@@ -0,0 +1,157 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrSkipped is returned when a recovery handler decides to skip a request
+var ErrSkipped = errors.New("request skipped")
+
+// FailureKind is a kind of request attempt failure
+type FailureKind string
+
+const (
+	FailureTransport FailureKind = "transport" // no response received
+	FailureStatus    FailureKind = "status"    // response status is not 2xx
+	FailureDetected  FailureKind = "detected"  // response is classified by a detection rule
+	FailureBody      FailureKind = "body"      // response body cannot be read or is invalid
+	FailureTLS       FailureKind = "tls"       // server certificate doesn't match pins
+)
+
+// Failure describes a failed request attempt
+type Failure struct {
+	ReqNum   int32 // request number, the same for all attempts of a request
+	Attempt  int
+	Kind     FailureKind
+	Class    Class // set if Kind is FailureDetected
+	Err      error
+	Request  *http.Request
+	Response *http.Response // nil if no response received
+	Body     []byte         // response body
+}
+
+// Action is an action to take after a failed attempt
+type Action int
+
+const (
+	Retry          Action = iota // retry after the default backoff delay
+	RetryNow                     // retry immediately
+	RetryAfter                   // retry after Decision.Delay
+	RetryWithProxy               // retry immediately through Decision.Proxy, other requests keep the client's proxy
+	Skip                         // stop and return an error wrapping ErrSkipped
+	Abort                        // stop and return Decision.Err
+)
+
+// Decision is a recovery handler's decision about a failed attempt.
+//
+// Retries are still limited by the maximum number of retries. The handler is called for requests of any method,
+// but the default Retry decision stops non-idempotent requests unless retrying is allowed by AllowRetry.
+// Other retry decisions are followed for any method.
+type Decision struct {
+	Action Action
+	Delay  time.Duration // for RetryAfter
+	Proxy  string        // for RetryWithProxy, empty string means direct connection
+	Err    error         // for Abort
+}
+
+// RecoveryHandler decides what to do after a failed request attempt
+type RecoveryHandler func(ctx context.Context, c *Cli, f *Failure) Decision
+
+// DecideRetry returns a decision to retry after the default backoff delay
+func DecideRetry() Decision {
+	return Decision{Action: Retry}
+}
+
+// DecideRetryNow returns a decision to retry immediately
+func DecideRetryNow() Decision {
+	return Decision{Action: RetryNow}
+}
+
+// DecideRetryAfter returns a decision to retry after a delay
+func DecideRetryAfter(d time.Duration) Decision {
+	return Decision{Action: RetryAfter, Delay: d}
+}
+
+// DecideRetryWithProxy returns a decision to retry the request through a proxy
+func DecideRetryWithProxy(proxyURL string) Decision {
+	return Decision{Action: RetryWithProxy, Proxy: proxyURL}
+}
+
+// DecideSkip returns a decision to skip the request
+func DecideSkip() Decision {
+	return Decision{Action: Skip}
+}
+
+// DecideAbort returns a decision to abort the request with an error
+func DecideAbort(err error) Decision {
+	return Decision{Action: Abort, Err: err}
+}
+
+// AdaptErrorHandler converts an ErrorHandler into a RecoveryHandler.
+//
+// Nil error returned by the handler means retry as usual, non-nil one means abort.
+func AdaptErrorHandler(fn ErrorHandler) RecoveryHandler {
+	if fn == nil {
+		return nil
+	}
+
+	return func(ctx context.Context, c *Cli, f *Failure) Decision {
+		if err := fn(ctx, c, f.Request, f.Response, f.Err, f.Attempt); err != nil {
+			return DecideAbort(err)
+		}
+
+		return DecideRetry()
+	}
+}
+
+// SetRecoveryHandler sets a handler which decides what to do after failed request attempts
+func (c *Cli) SetRecoveryHandler(fn RecoveryHandler) {
+	c.recoveryHandler = fn
+}
+
+// handlerContext returns a context for a recovery handler.
+//
+// Requests made by the handler are allowed while the client is handling an error,
+// and don't inherit streaming and response checks of the failed request.
+func handlerContext(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, "errorHandler", true)
+	ctx = context.WithValue(ctx, streamCtxKey{}, false)
+	ctx = context.WithValue(ctx, responseCheckCtxKey{}, ResponseCheck(nil))
+
+	return context.WithValue(ctx, validateFuncCtxKey{}, ValidateFunc(nil))
+}
+
+// newFailure builds a failure description
+func newFailure(reqNum int32, attempt int, req *http.Request, rsp *http.Response, body []byte, err error) *Failure {
+	f := &Failure{
+		ReqNum:   reqNum,
+		Attempt:  attempt,
+		Err:      err,
+		Request:  req,
+		Response: rsp,
+		Body:     body,
+	}
+
+	var (
+		dErr   *DetectedError
+		pinErr *PinError
+	)
+	switch {
+	case errors.As(err, &dErr):
+		f.Kind = FailureDetected
+		f.Class = dErr.Class
+	case errors.As(err, &pinErr):
+		f.Kind = FailureTLS
+	case rsp == nil:
+		f.Kind = FailureTransport
+	case rsp.StatusCode < 200 || rsp.StatusCode > 299:
+		f.Kind = FailureStatus
+	default:
+		f.Kind = FailureBody
+	}
+
+	return f
+}
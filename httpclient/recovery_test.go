@@ -0,0 +1,129 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryWithProxyPerRequest(t *testing.T) {
+	var direct, proxied int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&direct, 1)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	// Plain HTTP proxies receive requests with absolute URLs
+	prx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		if !r.URL.IsAbs() {
+			t.Errorf("proxy got non-absolute URL %s", r.URL)
+		}
+		_, _ = w.Write([]byte("via proxy"))
+	}))
+	defer prx.Close()
+
+	c := newTestCli(t)
+	c.SetRecoveryHandler(func(ctx context.Context, c *Cli, f *Failure) Decision {
+		return DecideRetryWithProxy(prx.URL)
+	})
+
+	body, err := c.Get(context.Background(), srv.URL+"/fail", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "via proxy" {
+		t.Errorf("got body %q", body)
+	}
+	if c.Proxy() != "" {
+		t.Errorf("client proxy changed to %q", c.Proxy())
+	}
+
+	// Other requests don't go through the proxy
+	if _, err := c.Get(context.Background(), srv.URL+"/ok", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if d, p := atomic.LoadInt32(&direct), atomic.LoadInt32(&proxied); d != 2 || p != 1 {
+		t.Errorf("got %d direct and %d proxied requests, want 2 and 1", d, p)
+	}
+}
+
+func TestRecoveryHandlerNonIdempotent(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	var calls int32
+	decision := DecideRetry()
+	c := newTestCli(t)
+	c.SetRecoveryHandler(func(ctx context.Context, c *Cli, f *Failure) Decision {
+		atomic.AddInt32(&calls, 1)
+		return decision
+	})
+
+	// The handler is called, but the default decision doesn't retry
+	if _, err := c.Post(context.Background(), srv.URL, nil, nil); err == nil {
+		t.Fatal("no error")
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("handler called %d times, want 1", n)
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+
+	// Allowed retries are retried by default
+	atomic.StoreInt32(&calls, 0)
+	atomic.StoreInt32(&hits, 0)
+	decision = DecideRetryNow()
+	if _, err := c.Post(AllowRetry(context.Background()), srv.URL, nil, nil); err == nil {
+		t.Fatal("no error")
+	}
+	if c, h := atomic.LoadInt32(&calls), atomic.LoadInt32(&hits); c != 2 || h != 2 {
+		t.Errorf("got %d handler calls and %d requests, want 2 and 2", c, h)
+	}
+
+	// Explicit retry decisions are followed
+	atomic.StoreInt32(&calls, 0)
+	atomic.StoreInt32(&hits, 0)
+	if _, err := c.Post(context.Background(), srv.URL, nil, nil); err == nil {
+		t.Fatal("no error")
+	}
+	if c, h := atomic.LoadInt32(&calls), atomic.LoadInt32(&hits); c != 2 || h != 2 {
+		t.Errorf("got %d handler calls and %d requests, want 2 and 2", c, h)
+	}
+}
+
+func TestRetryDelayCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetRecoveryHandler(func(ctx context.Context, c *Cli, f *Failure) Decision {
+		return DecideRetryAfter(time.Hour)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.Get(ctx, srv.URL, nil, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want deadline exceeded", err)
+	}
+	if el := time.Since(start); el > 5*time.Second {
+		t.Errorf("retry delay is not interrupted, took %s", el)
+	}
+}
@@ -0,0 +1,254 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IPPreference defines which IP addresses are used to connect to a host
+type IPPreference int
+
+const (
+	PreferAny  IPPreference = iota // use addresses in order returned by the resolver
+	PreferIPv4                     // try IPv4 addresses first
+	PreferIPv6                     // try IPv6 addresses first
+	OnlyIPv4                       // use IPv4 addresses only
+	OnlyIPv6                       // use IPv6 addresses only
+)
+
+// dnsEntry is a DNS cache entry
+type dnsEntry struct {
+	ips     []net.IP
+	err     error
+	expires time.Time
+}
+
+// Resolver resolves host names for a client.
+//
+// It supports static host mappings like curl's --resolve, custom DNS server and caching of lookup results.
+type Resolver struct {
+	mux    sync.Mutex
+	hosts  map[string][]net.IP
+	ttl    time.Duration
+	negTTL time.Duration
+	pref   IPPreference
+	r      *net.Resolver
+	cache  map[string]*dnsEntry
+	now    func() time.Time
+}
+
+// NewResolver creates a new resolver using system DNS settings
+func NewResolver() *Resolver {
+	return &Resolver{
+		hosts:  make(map[string][]net.IP),
+		ttl:    5 * time.Minute,
+		negTTL: 30 * time.Second,
+		r:      net.DefaultResolver,
+		cache:  make(map[string]*dnsEntry),
+		now:    time.Now,
+	}
+}
+
+// AddHost adds a static mapping of a host to IP addresses.
+//
+// Host may contain a port, in such case the mapping is used only for connections to that port.
+func (r *Resolver) AddHost(host string, ips ...string) error {
+	parsed := make([]net.IP, 0, len(ips))
+	for _, s := range ips {
+		ip := net.ParseIP(strings.Trim(s, "[]"))
+		if ip == nil {
+			return fmt.Errorf("invalid IP address: %q", s)
+		}
+		parsed = append(parsed, ip)
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.hosts[strings.ToLower(host)] = parsed
+
+	return nil
+}
+
+// RemoveHost removes a static mapping
+func (r *Resolver) RemoveHost(host string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	delete(r.hosts, strings.ToLower(host))
+}
+
+// SetServer sets DNS server address, e.g. "1.1.1.1:53". Empty address restores system settings.
+func (r *Resolver) SetServer(addr string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if addr == "" {
+		r.r = net.DefaultResolver
+	} else {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "53")
+		}
+
+		r.r = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				d := net.Dialer{Timeout: 10 * time.Second}
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+	}
+
+	r.cache = make(map[string]*dnsEntry)
+}
+
+// SetTTL sets how long successful and failed lookup results are cached. Zero disables caching.
+func (r *Resolver) SetTTL(positive, negative time.Duration) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.ttl = positive
+	r.negTTL = negative
+}
+
+// SetPreference sets IP address family preference
+func (r *Resolver) SetPreference(p IPPreference) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.pref = p
+}
+
+// Flush clears the cache
+func (r *Resolver) Flush() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.cache = make(map[string]*dnsEntry)
+}
+
+// Lookup returns IP addresses to connect to a host and a port, ordered according to the preference
+func (r *Resolver) Lookup(ctx context.Context, host, port string) ([]net.IP, error) {
+	host = strings.ToLower(host)
+
+	if ip := net.ParseIP(host); ip != nil {
+		return r.order([]net.IP{ip}), nil
+	}
+
+	r.mux.Lock()
+	if ips, ok := r.hosts[net.JoinHostPort(host, port)]; ok {
+		r.mux.Unlock()
+		return r.order(ips), nil
+	}
+	if ips, ok := r.hosts[host]; ok {
+		r.mux.Unlock()
+		return r.order(ips), nil
+	}
+	if e, ok := r.cache[host]; ok && r.now().Before(e.expires) {
+		r.mux.Unlock()
+		if e.err != nil {
+			return nil, e.err
+		}
+		return r.order(e.ips), nil
+	}
+	res := r.r
+	r.mux.Unlock()
+
+	addrs, err := res.LookupIPAddr(ctx, host)
+
+	var ips []net.IP
+	for _, a := range addrs {
+		ips = append(ips, a.IP)
+	}
+
+	r.mux.Lock()
+	if err != nil && r.negTTL > 0 && ctx.Err() == nil {
+		r.cache[host] = &dnsEntry{err: err, expires: r.now().Add(r.negTTL)}
+	} else if err == nil && r.ttl > 0 {
+		r.cache[host] = &dnsEntry{ips: ips, expires: r.now().Add(r.ttl)}
+	}
+	r.mux.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.order(ips), nil
+}
+
+// order filters and orders addresses according to the preference
+func (r *Resolver) order(ips []net.IP) []net.IP {
+	r.mux.Lock()
+	pref := r.pref
+	r.mux.Unlock()
+
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+
+	switch pref {
+	case PreferIPv4:
+		return append(v4, v6...)
+	case PreferIPv6:
+		return append(v6, v4...)
+	case OnlyIPv4:
+		return v4
+	case OnlyIPv6:
+		return v6
+	}
+
+	return ips
+}
+
+// dialFunc is a function establishing network connections
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dialContext returns a dial function which resolves addresses using the resolver
+func (r *Resolver) dialContext(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		ips, err := r.Lookup(ctx, host, port)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("no suitable addresses found for host %s", host)
+		}
+
+		var conn net.Conn
+		for _, ip := range ips {
+			conn, err = dial(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+
+		return nil, err
+	}
+}
+
+// SetResolver sets a resolver used to connect to hosts. Nil restores the system one.
+func (c *Cli) SetResolver(r *Resolver) {
+	dial := dialFunc(c.dialer.DialContext)
+	if r != nil {
+		dial = r.dialContext(c.dialer.DialContext)
+	}
+
+	c.updateTransport(func(tr *http.Transport) {
+		tr.DialContext = dial
+	})
+}
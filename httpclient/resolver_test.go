@@ -0,0 +1,349 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeDNS is a DNS server answering A and AAAA queries for ok.test and NXDOMAIN for other names
+type fakeDNS struct {
+	conn    net.PacketConn
+	queries map[string]int
+	mux     sync.Mutex
+}
+
+// newFakeDNS starts a fake DNS server
+func newFakeDNS(t *testing.T) *fakeDNS {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeDNS{conn: conn, queries: make(map[string]int)}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	go s.serve()
+
+	return s
+}
+
+// serve answers queries until the connection is closed
+func (s *fakeDNS) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		var p dnsmessage.Parser
+		h, err := p.Start(buf[:n])
+		if err != nil {
+			continue
+		}
+		q, err := p.Question()
+		if err != nil {
+			continue
+		}
+
+		s.mux.Lock()
+		s.queries[q.Name.String()]++
+		s.mux.Unlock()
+
+		rh := dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true, RecursionAvailable: true}
+		if q.Name.String() != "ok.test." {
+			rh.RCode = dnsmessage.RCodeNameError
+		}
+		b := dnsmessage.NewBuilder(nil, rh)
+		b.EnableCompression()
+		_ = b.StartQuestions()
+		_ = b.Question(q)
+		_ = b.StartAnswers()
+		if rh.RCode == dnsmessage.RCodeSuccess {
+			rrh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+			switch q.Type {
+			case dnsmessage.TypeA:
+				_ = b.AResource(rrh, dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}})
+			case dnsmessage.TypeAAAA:
+				_ = b.AAAAResource(rrh, dnsmessage.AAAAResource{
+					AAAA: [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1},
+				})
+			}
+		}
+		msg, err := b.Finish()
+		if err != nil {
+			continue
+		}
+		_, _ = s.conn.WriteTo(msg, addr)
+	}
+}
+
+// count returns a number of queries of a name
+func (s *fakeDNS) count(name string) int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.queries[name]
+}
+
+// ipStrings converts addresses to strings
+func ipStrings(ips []net.IP) []string {
+	r := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		r = append(r, ip.String())
+	}
+
+	return r
+}
+
+func TestResolverHosts(t *testing.T) {
+	r := NewResolver()
+	if err := r.AddHost("Example.com", "192.0.2.1", "[2001:db8::1]"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddHost("example.com:8443", "192.0.2.2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddHost("bad.com", "192.0.2"); err == nil {
+		t.Error("no error for invalid address")
+	}
+
+	tests := []struct {
+		host string
+		port string
+		want []string
+	}{
+		{"example.com", "443", []string{"192.0.2.1", "2001:db8::1"}},
+		{"EXAMPLE.COM", "80", []string{"192.0.2.1", "2001:db8::1"}},
+		{"example.com", "8443", []string{"192.0.2.2"}},
+		{"192.0.2.9", "80", []string{"192.0.2.9"}},
+		{"::1", "80", []string{"::1"}},
+	}
+
+	for _, tt := range tests {
+		ips, err := r.Lookup(context.Background(), tt.host, tt.port)
+		if err != nil {
+			t.Errorf("%s:%s: %v", tt.host, tt.port, err)
+			continue
+		}
+		if got := ipStrings(ips); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:%s: got %q, want %q", tt.host, tt.port, got, tt.want)
+		}
+	}
+
+	r.RemoveHost("example.com:8443")
+	ips, err := r.Lookup(context.Background(), "example.com", "8443")
+	if err != nil || ipStrings(ips)[0] != "192.0.2.1" {
+		t.Errorf("got %v, %v after removing the port mapping", ips, err)
+	}
+}
+
+func TestResolverPreference(t *testing.T) {
+	r := NewResolver()
+	if err := r.AddHost("example.com", "2001:db8::1", "192.0.2.1", "2001:db8::2", "192.0.2.2"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		pref IPPreference
+		want []string
+	}{
+		{PreferAny, []string{"2001:db8::1", "192.0.2.1", "2001:db8::2", "192.0.2.2"}},
+		{PreferIPv4, []string{"192.0.2.1", "192.0.2.2", "2001:db8::1", "2001:db8::2"}},
+		{PreferIPv6, []string{"2001:db8::1", "2001:db8::2", "192.0.2.1", "192.0.2.2"}},
+		{OnlyIPv4, []string{"192.0.2.1", "192.0.2.2"}},
+		{OnlyIPv6, []string{"2001:db8::1", "2001:db8::2"}},
+	}
+
+	for _, tt := range tests {
+		r.SetPreference(tt.pref)
+		ips, err := r.Lookup(context.Background(), "example.com", "443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ipStrings(ips); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("preference %d: got %q, want %q", tt.pref, got, tt.want)
+		}
+	}
+}
+
+func TestResolverServerAndCache(t *testing.T) {
+	dns := newFakeDNS(t)
+
+	now := time.Unix(1600000000, 0)
+	r := NewResolver()
+	r.now = func() time.Time { return now }
+	r.SetServer(dns.conn.LocalAddr().String())
+	r.SetTTL(time.Minute, 10*time.Second)
+	r.SetPreference(PreferIPv4)
+
+	ips, err := r.Lookup(context.Background(), "ok.test", "80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ipStrings(ips), []string{"192.0.2.1", "2001:db8::1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	okQueries := dns.count("ok.test.")
+	if okQueries == 0 {
+		t.Fatal("custom DNS server is not queried")
+	}
+
+	_, err = r.Lookup(context.Background(), "missing.test", "80")
+	if err == nil {
+		t.Fatal("no error for a missing host")
+	}
+	missQueries := dns.count("missing.test.")
+
+	tests := []struct {
+		advance time.Duration
+		okNew   bool // ok.test is queried again
+		missNew bool // missing.test is queried again
+	}{
+		{5 * time.Second, false, false},
+		{10 * time.Second, false, true}, // the failure has expired
+		{time.Minute, true, true},       // both have expired
+	}
+
+	for i, tt := range tests {
+		now = now.Add(tt.advance)
+		if _, err := r.Lookup(context.Background(), "ok.test", "80"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Lookup(context.Background(), "missing.test", "80"); err == nil {
+			t.Fatal("no error for a missing host")
+		}
+
+		okN, missN := dns.count("ok.test."), dns.count("missing.test.")
+		if (okN > okQueries) != tt.okNew || (missN > missQueries) != tt.missNew {
+			t.Errorf("step %d: got queries %d -> %d and %d -> %d", i, okQueries, okN, missQueries, missN)
+		}
+		okQueries, missQueries = okN, missN
+	}
+
+	// Flush drops cached results
+	r.Flush()
+	if _, err := r.Lookup(context.Background(), "ok.test", "80"); err != nil {
+		t.Fatal(err)
+	}
+	if dns.count("ok.test.") == okQueries {
+		t.Error("cache is not flushed")
+	}
+
+	// Zero TTL disables caching
+	r.SetTTL(0, 0)
+	r.Flush()
+	okQueries = dns.count("ok.test.")
+	for i := 0; i < 2; i++ {
+		if _, err := r.Lookup(context.Background(), "ok.test", "80"); err != nil {
+			t.Fatal(err)
+		}
+		if n := dns.count("ok.test."); n == okQueries {
+			t.Errorf("lookup %d is cached", i)
+		} else {
+			okQueries = n
+		}
+	}
+}
+
+func TestResolverDial(t *testing.T) {
+	r := NewResolver()
+	if err := r.AddHost("example.com", "192.0.2.1", "192.0.2.2"); err != nil {
+		t.Fatal(err)
+	}
+
+	var dialed []string
+	stub := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		if strings.HasPrefix(addr, "192.0.2.1:") {
+			return nil, errors.New("unreachable")
+		}
+		c, _ := net.Pipe()
+		return c, nil
+	}
+
+	conn, err := r.dialContext(stub)(context.Background(), "tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+	if want := []string{"192.0.2.1:443", "192.0.2.2:443"}; !reflect.DeepEqual(dialed, want) {
+		t.Errorf("dialed %q, want %q", dialed, want)
+	}
+
+	r.SetPreference(OnlyIPv6)
+	if _, err := r.dialContext(stub)(context.Background(), "tcp", "example.com:443"); err == nil {
+		t.Error("no error without suitable addresses")
+	}
+}
+
+func TestSetResolver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewResolver()
+	if err := r.AddHost("app.test", u.Hostname()); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestCli(t)
+	c.SetMaxRetries(1)
+	target := "http://app.test:" + u.Port() + "/"
+
+	// Requests in progress don't race with changes of the resolver
+	var (
+		wg sync.WaitGroup
+		ok int32
+	)
+	c.SetResolver(r)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if _, err := c.Get(context.Background(), target, nil, nil); err == nil {
+					atomic.AddInt32(&ok, 1)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		c.SetResolver(r)
+	}
+	wg.Wait()
+	if atomic.LoadInt32(&ok) == 0 {
+		t.Error("no request succeeded")
+	}
+
+	body, err := c.Get(context.Background(), target, nil, nil)
+	if err != nil || string(body) != "app.test:"+u.Port() {
+		t.Errorf("got %q, %v", body, err)
+	}
+
+	c.SetResolver(nil)
+	if _, err := c.Get(context.Background(), target, nil, nil); err == nil {
+		t.Error("no error after restoring the system resolver")
+	}
+}
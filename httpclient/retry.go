@@ -0,0 +1,63 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// IdempotencyKeyHeader is a header carrying an idempotency key
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+type allowRetryCtxKey struct{}
+
+// AllowRetry returns a context which allows retries of a non-idempotent request performed with it.
+//
+// Without it, such a request fails after the first attempt unless the recovery handler decides otherwise.
+func AllowRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowRetryCtxKey{}, true)
+}
+
+// IsIdempotent reports whether an HTTP method is idempotent
+func IsIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+// SetIdempotencyKeys enables or disables automatic generation of idempotency keys.
+//
+// If enabled, each non-idempotent request which doesn't have an Idempotency-Key header gets a random one.
+// The key stays the same for all attempts of the request.
+func (c *Cli) SetIdempotencyKeys(enabled bool) {
+	c.idempotencyKeys = enabled
+}
+
+// retryAllowed reports whether a failed request may be retried
+func retryAllowed(ctx context.Context, method string) bool {
+	if IsIdempotent(method) {
+		return true
+	}
+
+	allowed, _ := ctx.Value(allowRetryCtxKey{}).(bool)
+
+	return allowed
+}
+
+// NewIdempotencyKey generates a random idempotency key
+func NewIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	// Make it a version 4 UUID
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
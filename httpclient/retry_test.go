@@ -0,0 +1,88 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	var (
+		mux  sync.Mutex
+		keys []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+		n := len(keys)
+		mux.Unlock()
+		if n%2 == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetRecoveryHandler(func(ctx context.Context, c *Cli, f *Failure) Decision {
+		return DecideRetryNow()
+	})
+	ctx := AllowRetry(context.Background())
+
+	// Disabled by default
+	if _, err := c.Post(ctx, srv.URL, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if keys[0] != "" || keys[1] != "" {
+		t.Errorf("got keys %q", keys)
+	}
+
+	c.SetIdempotencyKeys(true)
+	keys = nil
+	for i := 0; i < 2; i++ {
+		if _, err := c.Post(ctx, srv.URL, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	uuidRe := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if len(keys) != 4 || !uuidRe.MatchString(keys[0]) {
+		t.Fatalf("got keys %q", keys)
+	}
+	if keys[0] != keys[1] || keys[2] != keys[3] {
+		t.Errorf("key changes between attempts: %q", keys)
+	}
+	if keys[0] == keys[2] {
+		t.Errorf("requests share a key: %q", keys)
+	}
+
+	// Keys of callers are kept, idempotent requests get no key
+	keys = nil
+	if _, err := c.Post(ctx, srv.URL, http.Header{IdempotencyKeyHeader: {"mine"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, srv.URL, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if keys[0] != "mine" || keys[1] != "mine" || keys[2] != "" || keys[3] != "" {
+		t.Errorf("got keys %q", keys)
+	}
+}
+
+func TestRetryAllowed(t *testing.T) {
+	for _, m := range []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete} {
+		if !retryAllowed(context.Background(), m) {
+			t.Errorf("%s is not retried", m)
+		}
+	}
+	for _, m := range []string{http.MethodPost, http.MethodPatch, "CUSTOM"} {
+		if retryAllowed(context.Background(), m) {
+			t.Errorf("%s is retried", m)
+		}
+		if !retryAllowed(AllowRetry(context.Background()), m) {
+			t.Errorf("%s is not retried with AllowRetry", m)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RegisterScheme registers a transport handling requests to URLs having specified scheme.
+//
+// Requests to such URLs are performed by DoRequest and all the helpers the same way as HTTP ones,
+// including retries, logging and dumping.
+func (c *Cli) RegisterScheme(scheme string, rt http.RoundTripper) error {
+	scheme = strings.ToLower(scheme)
+	if scheme == "http" || scheme == "https" {
+		return fmt.Errorf("scheme %q cannot be overridden", scheme)
+	}
+
+	c.trMux.Lock()
+	defer c.trMux.Unlock()
+
+	if c.schemes == nil {
+		c.schemes = make(map[string]http.RoundTripper)
+	}
+	if _, ok := c.schemes[scheme]; ok {
+		return fmt.Errorf("scheme %q is already registered", scheme)
+	}
+
+	c.tr.RegisterProtocol(scheme, rt)
+	c.schemes[scheme] = rt
+
+	return nil
+}
+
+// UnixTransport performs HTTP requests over Unix domain sockets.
+//
+// URLs look like unix:///run/app.sock:/api/path?query, where /run/app.sock is a socket path
+// and /api/path is a path of HTTP request. If request path is omitted, "/" is used.
+type UnixTransport struct {
+	mux sync.Mutex
+	trs map[string]*http.Transport
+}
+
+// NewUnixTransport creates a new Unix domain socket transport
+func NewUnixTransport() *UnixTransport {
+	return &UnixTransport{trs: make(map[string]*http.Transport)}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *UnixTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	sockPath, reqPath := req.URL.Path, "/"
+	if i := strings.Index(sockPath, ":"); i >= 0 {
+		sockPath, reqPath = sockPath[:i], sockPath[i+1:]
+	}
+	if sockPath == "" {
+		return nil, fmt.Errorf("no socket path in URL: %v", req.URL)
+	}
+
+	t.mux.Lock()
+	tr, ok := t.trs[sockPath]
+	if !ok {
+		tr = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				d := net.Dialer{Timeout: 30 * time.Second}
+				return d.DialContext(ctx, "unix", sockPath)
+			},
+			MaxIdleConns:    10,
+			IdleConnTimeout: 90 * time.Second,
+		}
+		t.trs[sockPath] = tr
+	}
+	t.mux.Unlock()
+
+	r := req.Clone(req.Context())
+	r.URL = &url.URL{
+		Scheme:   "http",
+		Host:     "localhost",
+		Path:     reqPath,
+		RawQuery: req.URL.RawQuery,
+	}
+	r.Host = "localhost"
+
+	rsp, err := tr.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	rsp.Request = req
+
+	return rsp, nil
+}
+
+// NewFileTransport creates a transport serving file:// URLs from a directory
+func NewFileTransport(root string) http.RoundTripper {
+	return http.NewFileTransport(http.Dir(root))
+}
+
+// DataTransport serves data: URLs as defined by RFC 2397
+type DataTransport struct{}
+
+// NewDataTransport creates a new data: URL transport
+func NewDataTransport() *DataTransport {
+	return &DataTransport{}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *DataTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s := req.URL.Opaque
+	if s == "" {
+		s = strings.TrimPrefix(req.URL.String(), req.URL.Scheme+":")
+	}
+
+	i := strings.Index(s, ",")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid data URL: %v", req.URL)
+	}
+	meta, data := s[:i], s[i+1:]
+
+	isBase64 := false
+	if strings.HasSuffix(meta, ";base64") {
+		isBase64 = true
+		meta = strings.TrimSuffix(meta, ";base64")
+	}
+	if meta == "" {
+		meta = "text/plain;charset=US-ASCII"
+	}
+
+	body, err := url.PathUnescape(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data URL: %v", err)
+	}
+
+	b := []byte(body)
+	if isBase64 {
+		if b, err = base64.StdEncoding.DecodeString(body); err != nil {
+			if b, err = base64.RawStdEncoding.DecodeString(body); err != nil {
+				return nil, fmt.Errorf("invalid data URL: %v", err)
+			}
+		}
+	}
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		Header: http.Header{
+			"Content-Type":   {meta},
+			"Content-Length": {strconv.Itoa(len(b))},
+		},
+		Body:          ioutil.NopCloser(bytes.NewReader(b)),
+		ContentLength: int64(len(b)),
+		Request:       req,
+	}, nil
+}
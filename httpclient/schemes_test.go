@@ -0,0 +1,164 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegisterScheme(t *testing.T) {
+	c := newTestCli(t)
+
+	for _, scheme := range []string{"http", "HTTPS"} {
+		if err := c.RegisterScheme(scheme, NewDataTransport()); err == nil {
+			t.Errorf("%s: no error", scheme)
+		}
+	}
+	if err := c.RegisterScheme("Data", NewDataTransport()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RegisterScheme("data", NewDataTransport()); err == nil {
+		t.Error("no error for a registered scheme")
+	}
+
+	// Registered schemes survive changes of transport settings
+	c.SetResolver(NewResolver())
+	body, err := c.Get(context.Background(), "data:,hello", nil, nil)
+	if err != nil || string(body) != "hello" {
+		t.Errorf("got %q, %v", body, err)
+	}
+}
+
+func TestUnixTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aghpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	sock := filepath.Join(dir, "s.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets are not supported: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host + " " + r.URL.RequestURI()))
+	}))
+	srv.Listener = ln
+	srv.Start()
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetMaxRetries(1)
+	if err := c.RegisterScheme("unix", NewUnixTransport()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"unix://" + sock + ":/api/items?x=1", "localhost /api/items?x=1"},
+		{"unix://" + sock, "localhost /"},
+	}
+
+	for _, tt := range tests {
+		rsp, body, err := c.DoRequest(context.Background(), http.MethodGet, tt.url, nil, nil)
+		if err != nil {
+			t.Errorf("%s: %v", tt.url, err)
+			continue
+		}
+		if string(body) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.url, body, tt.want)
+		}
+		if rsp.Request.URL.String() != tt.url {
+			t.Errorf("%s: got request URL %v", tt.url, rsp.Request.URL)
+		}
+	}
+
+	for _, u := range []string{"unix:", "unix://" + filepath.Join(dir, "missing.sock") + ":/"} {
+		if _, err := c.Get(context.Background(), u, nil, nil); err == nil {
+			t.Errorf("%s: no error", u)
+		}
+	}
+}
+
+func TestDataTransport(t *testing.T) {
+	tests := []struct {
+		url   string
+		ctype string
+		body  string
+	}{
+		{"data:,Hello%2C%20World", "text/plain;charset=US-ASCII", "Hello, World"},
+		{"data:text/html,<p>a</p>", "text/html", "<p>a</p>"},
+		{"data:text/plain;base64,SGVsbG8=", "text/plain", "Hello"},
+		{"data:;base64,SGVsbG8", "text/plain;charset=US-ASCII", "Hello"},
+		{"data:application/json,", "application/json", ""},
+	}
+
+	tr := NewDataTransport()
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Errorf("%s: %v", tt.url, err)
+			continue
+		}
+		b, _ := ioutil.ReadAll(rsp.Body)
+		if rsp.StatusCode != http.StatusOK || rsp.Header.Get("Content-Type") != tt.ctype || string(b) != tt.body {
+			t.Errorf("%s: got %d %q %q", tt.url, rsp.StatusCode, rsp.Header.Get("Content-Type"), b)
+		}
+		if rsp.ContentLength != int64(len(tt.body)) {
+			t.Errorf("%s: got content length %d", tt.url, rsp.ContentLength)
+		}
+	}
+
+	for _, opaque := range []string{"text/plain", ";base64,%%%", ";base64,not*base64", ",%zz"} {
+		req := &http.Request{Method: http.MethodGet, URL: &url.URL{Scheme: "data", Opaque: opaque}}
+		if _, err := tr.RoundTrip(req); err == nil {
+			t.Errorf("data:%s: no error", opaque)
+		}
+	}
+}
+
+func TestFileTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aghpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestCli(t)
+	c.SetMaxRetries(1)
+	if err := c.RegisterScheme("file", NewFileTransport(dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := c.Get(context.Background(), "file:///a.txt", nil, nil)
+	if err != nil || string(body) != "content" {
+		t.Errorf("got %q, %v", body, err)
+	}
+
+	var sErr *StatusError
+	if _, err := c.Get(context.Background(), "file:///missing.txt", nil, nil); !errors.As(err, &sErr) ||
+		sErr.StatusCode != http.StatusNotFound {
+		t.Errorf("got error %v, want 404", err)
+	}
+}
@@ -0,0 +1,399 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoIdentities is returned when a pool has no usable identities
+	ErrNoIdentities = errors.New("no usable identities")
+
+	// ErrIdentityBurned is returned by requests of an identity which has been burned
+	ErrIdentityBurned = errors.New("identity is burned")
+)
+
+// ClientFactory creates a client for an identity
+type ClientFactory func(name string) (*Cli, error)
+
+// IdentityConfig is an identity configuration
+type IdentityConfig struct {
+	Name    string
+	Proxy   string
+	Profile Profile
+	Locale  Locale
+}
+
+// Identity is a pool's identity: a client having its own cookies, browser profile and proxy
+type Identity struct {
+	name       string
+	cli        *Cli
+	burned     bool
+	burnReason string
+	burnedAt   time.Time
+	active     int
+	lastUsed   time.Time
+}
+
+// Name returns identity's name
+func (id *Identity) Name() string {
+	return id.name
+}
+
+// Cli returns identity's client
+func (id *Identity) Cli() *Cli {
+	return id.cli
+}
+
+// savedIdentity is a persisted identity state
+type savedIdentity struct {
+	Name       string    `json:"name"`
+	Proxy      string    `json:"proxy,omitempty"`
+	Profile    string    `json:"profile,omitempty"`
+	Locale     Locale    `json:"locale"`
+	Burned     bool      `json:"burned,omitempty"`
+	BurnReason string    `json:"burn_reason,omitempty"`
+	BurnedAt   time.Time `json:"burned_at,omitempty"`
+	Cookies    CookieSet `json:"cookies,omitempty"`
+}
+
+// SessionPool manages a set of identities and leases them to workers.
+//
+// An identity is leased to no more than a configured number of workers at once,
+// and is not leased again until a cool-down period passes after its release.
+// An identity is burned, i.e. never leased again, when its request is detected as banned.
+type SessionPool struct {
+	mux         sync.Mutex
+	factory     ClientFactory
+	ids         []*Identity
+	concurrency int
+	cooldown    time.Duration
+	handler     RecoveryHandler
+	changed     chan struct{}
+}
+
+// Lease is an identity leased to a worker
+type Lease struct {
+	pool     *SessionPool
+	id       *Identity
+	released bool
+}
+
+// NewSessionPool creates a new session pool which uses factory to create identities' clients
+func NewSessionPool(factory ClientFactory) *SessionPool {
+	return &SessionPool{
+		factory:     factory,
+		concurrency: 1,
+		changed:     make(chan struct{}),
+	}
+}
+
+// SetConcurrency sets maximum number of concurrent leases of an identity
+func (p *SessionPool) SetConcurrency(n int) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if n < 1 {
+		n = 1
+	}
+	p.concurrency = n
+	p.notify()
+}
+
+// SetCooldown sets a period an identity is not leased after its release
+func (p *SessionPool) SetCooldown(d time.Duration) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.cooldown = d
+	p.notify()
+}
+
+// SetRecoveryHandler sets a recovery handler used by identities' clients for failures not causing a burn
+func (p *SessionPool) SetRecoveryHandler(fn RecoveryHandler) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.handler = fn
+}
+
+// Add adds an identity
+func (p *SessionPool) Add(cfg IdentityConfig) (*Identity, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	for _, id := range p.ids {
+		if id.name == cfg.Name {
+			return nil, fmt.Errorf("identity %q already exists", cfg.Name)
+		}
+	}
+
+	cli, err := p.factory(cfg.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for identity %q: %v", cfg.Name, err)
+	}
+
+	if err := cfg.apply(cli); err != nil {
+		return nil, err
+	}
+
+	id := &Identity{name: cfg.Name, cli: cli}
+	cli.SetRecoveryHandler(p.recoveryHandler(id))
+	p.ids = append(p.ids, id)
+	p.notify()
+
+	return id, nil
+}
+
+// apply applies the configuration to a client. Empty profile and locale are left as is.
+func (cfg IdentityConfig) apply(cli *Cli) error {
+	if err := cli.SetProxy(cfg.Proxy); err != nil {
+		return err
+	}
+	if cfg.Profile.Name != "" {
+		cli.SetProfile(cfg.Profile)
+	}
+	if cfg.Locale.AcceptLanguage != "" {
+		cli.SetLocale(cfg.Locale)
+	}
+
+	return nil
+}
+
+// Identities returns all the identities
+func (p *SessionPool) Identities() []*Identity {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	return append([]*Identity(nil), p.ids...)
+}
+
+// Lease waits for an available identity and leases it
+func (p *SessionPool) Lease(ctx context.Context) (*Lease, error) {
+	for {
+		p.mux.Lock()
+		id, wait, usable := p.pick()
+		if id != nil {
+			id.active++
+			id.lastUsed = time.Now()
+			p.mux.Unlock()
+			return &Lease{pool: p, id: id}, nil
+		}
+		if !usable {
+			p.mux.Unlock()
+			return nil, ErrNoIdentities
+		}
+		changed := p.changed
+		p.mux.Unlock()
+
+		var timer <-chan time.Time
+		if wait > 0 {
+			timer = time.After(wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		case <-timer:
+		}
+	}
+}
+
+// pick chooses an identity to lease.
+//
+// If no identity is available, it returns the time to wait for a cool-down end
+// and whether there are usable identities at all.
+func (p *SessionPool) pick() (*Identity, time.Duration, bool) {
+	var (
+		best    *Identity
+		wait    time.Duration
+		usable  bool
+		now     = time.Now()
+		waitSet bool
+	)
+
+	for _, id := range p.ids {
+		if id.burned {
+			continue
+		}
+		usable = true
+
+		if id.active >= p.concurrency {
+			continue
+		}
+
+		if id.active == 0 && !id.lastUsed.IsZero() {
+			if left := id.lastUsed.Add(p.cooldown).Sub(now); left > 0 {
+				if !waitSet || left < wait {
+					wait, waitSet = left, true
+				}
+				continue
+			}
+		}
+
+		if best == nil || id.active < best.active || (id.active == best.active && id.lastUsed.Before(best.lastUsed)) {
+			best = id
+		}
+	}
+
+	return best, wait, usable
+}
+
+// notify wakes up goroutines waiting for a lease. Must be called with the mutex locked.
+func (p *SessionPool) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// burn marks an identity as burned
+func (p *SessionPool) burn(id *Identity, reason string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if !id.burned {
+		id.burned = true
+		id.burnReason = reason
+		id.burnedAt = time.Now()
+		id.cli.l.Warn("identity %q burned: %s", id.name, reason)
+	}
+	p.notify()
+}
+
+// recoveryHandler returns a recovery handler which burns an identity on ban detection
+func (p *SessionPool) recoveryHandler(id *Identity) RecoveryHandler {
+	return func(ctx context.Context, c *Cli, f *Failure) Decision {
+		if f.Kind == FailureDetected && f.Class == ClassBan {
+			p.burn(id, f.Err.Error())
+			return DecideAbort(ErrIdentityBurned)
+		}
+
+		p.mux.Lock()
+		fn := p.handler
+		p.mux.Unlock()
+
+		if fn != nil {
+			return fn(ctx, c, f)
+		}
+
+		return DecideRetry()
+	}
+}
+
+// Save saves identities' state into a file
+func (p *SessionPool) Save(fPath string) error {
+	p.mux.Lock()
+	saved := make([]savedIdentity, 0, len(p.ids))
+	for _, id := range p.ids {
+		saved = append(saved, savedIdentity{
+			Name:       id.name,
+			Proxy:      id.cli.Proxy(),
+			Profile:    id.cli.Profile().Name,
+			Locale:     id.cli.Locale(),
+			Burned:     id.burned,
+			BurnReason: id.burnReason,
+			BurnedAt:   id.burnedAt,
+			Cookies:    id.cli.ExportCookies(),
+		})
+	}
+	p.mux.Unlock()
+
+	b, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(fPath, b, 0600); err != nil {
+		return fmt.Errorf("failed to save session pool to %v: %v", fPath, err)
+	}
+
+	return nil
+}
+
+// Load loads identities' state from a file.
+//
+// Identities which are not in the pool yet are added, existing ones get the saved proxy, profile, locale,
+// cookies and burn state.
+func (p *SessionPool) Load(fPath string) error {
+	b, err := ioutil.ReadFile(fPath)
+	if err != nil {
+		return fmt.Errorf("failed to load session pool from %v: %v", fPath, err)
+	}
+
+	var saved []savedIdentity
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return fmt.Errorf("failed to parse session pool file %v: %v", fPath, err)
+	}
+
+	for _, s := range saved {
+		var id *Identity
+		for _, existing := range p.Identities() {
+			if existing.name == s.Name {
+				id = existing
+				break
+			}
+		}
+
+		cfg := IdentityConfig{Name: s.Name, Proxy: s.Proxy, Locale: s.Locale}
+		if prof, ok := ProfileByName(s.Profile); ok {
+			cfg.Profile = prof
+		}
+
+		if id == nil {
+			if id, err = p.Add(cfg); err != nil {
+				return err
+			}
+		} else if err := cfg.apply(id.cli); err != nil {
+			return err
+		}
+
+		if err := id.cli.ImportCookies(s.Cookies); err != nil {
+			return fmt.Errorf("failed to import cookies of identity %q: %v", s.Name, err)
+		}
+
+		p.mux.Lock()
+		id.burned = s.Burned
+		id.burnReason = s.BurnReason
+		id.burnedAt = s.BurnedAt
+		p.notify()
+		p.mux.Unlock()
+	}
+
+	return nil
+}
+
+// Identity returns leased identity
+func (l *Lease) Identity() *Identity {
+	return l.id
+}
+
+// Cli returns leased identity's client
+func (l *Lease) Cli() *Cli {
+	return l.id.cli
+}
+
+// Release returns the identity to the pool
+func (l *Lease) Release() {
+	l.pool.mux.Lock()
+	defer l.pool.mux.Unlock()
+
+	if l.released {
+		return
+	}
+	l.released = true
+
+	l.id.active--
+	l.id.lastUsed = time.Now()
+	l.pool.notify()
+}
+
+// Burn marks the identity as burned and releases it
+func (l *Lease) Burn(reason string) {
+	l.pool.burn(l.id, reason)
+	l.Release()
+}
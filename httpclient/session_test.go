@@ -0,0 +1,283 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ashep/aghpu/logger"
+)
+
+// newTestSessionPool creates a session pool having identities with specified names
+func newTestSessionPool(t *testing.T, names ...string) *SessionPool {
+	t.Helper()
+
+	l, err := logger.New("test", logger.LvDisabled, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewSessionPool(func(name string) (*Cli, error) {
+		c, err := New(name, "", "", "", false, l)
+		if err != nil {
+			return nil, err
+		}
+		c.SetMaxRetries(2)
+		c.SetDetectRules(DefaultDetectRules...)
+		return c, nil
+	})
+	for _, name := range names {
+		if _, err := p.Add(IdentityConfig{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return p
+}
+
+func TestSessionPoolLease(t *testing.T) {
+	p := newTestSessionPool(t, "a", "b")
+	if _, err := p.Add(IdentityConfig{Name: "a"}); err == nil {
+		t.Error("no error for a duplicate identity")
+	}
+
+	l1, err := p.Lease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := p.Lease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l1.Identity() == l2.Identity() {
+		t.Fatal("identity is leased twice")
+	}
+
+	// All identities are busy
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.Lease(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want deadline exceeded", err)
+	}
+
+	// Releasing wakes up waiters
+	got := make(chan *Lease)
+	go func() {
+		l, err := p.Lease(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		got <- l
+	}()
+	time.Sleep(20 * time.Millisecond)
+	l1.Release()
+	l1.Release()
+	if l := <-got; l.Identity() != l1.Identity() {
+		t.Errorf("got identity %q, want %q", l.Identity().Name(), l1.Identity().Name())
+	}
+
+	p.SetConcurrency(2)
+	if l, err := p.Lease(context.Background()); err != nil || l.Identity() != l2.Identity() {
+		t.Errorf("got %v, %v, want the least busy identity", l, err)
+	}
+}
+
+func TestSessionPoolConcurrency(t *testing.T) {
+	p := newTestSessionPool(t, "a", "b", "c")
+	p.SetConcurrency(2)
+
+	var (
+		mux    sync.Mutex
+		active = make(map[string]int)
+		max    int32
+		wg     sync.WaitGroup
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				l, err := p.Lease(context.Background())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				name := l.Identity().Name()
+
+				mux.Lock()
+				active[name]++
+				if n := int32(active[name]); n > atomic.LoadInt32(&max) {
+					atomic.StoreInt32(&max, n)
+				}
+				mux.Unlock()
+
+				time.Sleep(time.Millisecond)
+
+				mux.Lock()
+				active[name]--
+				mux.Unlock()
+				l.Release()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&max); n != 2 {
+		t.Errorf("got %d concurrent leases of an identity, want 2", n)
+	}
+}
+
+func TestSessionPoolCooldown(t *testing.T) {
+	p := newTestSessionPool(t, "a")
+	p.SetCooldown(200 * time.Millisecond)
+
+	l, err := p.Lease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Release()
+
+	start := time.Now()
+	if l, err = p.Lease(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("identity is leased again after %v", d)
+	}
+
+	// Shortening the cool-down wakes up waiters
+	l.Release()
+	p.SetCooldown(time.Hour)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		p.SetCooldown(0)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := p.Lease(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSessionPoolBurn(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("<h1>Access Denied</h1>"))
+	}))
+	defer srv.Close()
+
+	p := newTestSessionPool(t, "a", "b")
+	var handled int32
+	p.SetRecoveryHandler(func(ctx context.Context, c *Cli, f *Failure) Decision {
+		atomic.AddInt32(&handled, 1)
+		return DecideRetry()
+	})
+
+	// Bans of both idempotent and non-idempotent requests burn identities
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		l, err := p.Lease(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = l.Cli().DoRequest(context.Background(), method, srv.URL, nil, nil)
+		if !errors.Is(err, ErrIdentityBurned) {
+			t.Errorf("%s: got error %v, want ErrIdentityBurned", method, err)
+		}
+		l.Release()
+	}
+
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+	if n := atomic.LoadInt32(&handled); n != 0 {
+		t.Errorf("pool's handler is called %d times", n)
+	}
+	if _, err := p.Lease(context.Background()); err != ErrNoIdentities {
+		t.Errorf("got error %v, want ErrNoIdentities", err)
+	}
+
+	id, err := p.Add(IdentityConfig{Name: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := p.Lease(context.Background())
+	if err != nil || l.Identity() != id {
+		t.Fatalf("got %v, %v", l, err)
+	}
+	l.Burn("manual")
+	if _, err := p.Lease(context.Background()); err != ErrNoIdentities {
+		t.Errorf("got error %v, want ErrNoIdentities", err)
+	}
+}
+
+func TestSessionPoolSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aghpu-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	fPath := filepath.Join(dir, "pool.json")
+
+	p := newTestSessionPool(t)
+	a, err := p.Add(IdentityConfig{
+		Name:    "a",
+		Proxy:   "http://127.0.0.1:3128",
+		Profile: ProfileFirefox,
+		Locale:  LocaleDeDE,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://example.com/")
+	err = a.Cli().ImportCookies(CookieSet{u.String(): {{Name: "sid", Value: "1", Path: "/"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := p.Add(IdentityConfig{Name: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.burn(b, "banned")
+
+	if err := p.Save(fPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Existing identities get all the saved settings, missing ones are added
+	p2 := newTestSessionPool(t, "a")
+	if err := p2.Load(fPath); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := p2.Identities()
+	if len(ids) != 2 || ids[0].Name() != "a" || ids[1].Name() != "b" {
+		t.Fatalf("got %d identities", len(ids))
+	}
+	c := ids[0].Cli()
+	if c.Proxy() != "http://127.0.0.1:3128" || c.Profile().Name != ProfileFirefox.Name || c.Locale() != LocaleDeDE {
+		t.Errorf("got proxy %q, profile %q, locale %v", c.Proxy(), c.Profile().Name, c.Locale())
+	}
+	if cks := c.Client().Jar.Cookies(u); len(cks) != 1 || cks[0].Value != "1" {
+		t.Errorf("got cookies %v", cks)
+	}
+	if !ids[1].burned || ids[1].burnReason != "banned" || ids[0].burned {
+		t.Errorf("burn state is not restored")
+	}
+
+	if err := p2.Load(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("no error for a missing file")
+	}
+}
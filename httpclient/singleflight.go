@@ -0,0 +1,162 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// DedupKeyFunc builds a deduplication key for a request.
+//
+// Requests having equal keys are performed only once while one of them is in flight.
+// Empty key disables deduplication for the request.
+type DedupKeyFunc func(method, u string, header http.Header) string
+
+// dedupHeaders are headers which make otherwise identical requests different
+var dedupHeaders = []string{
+	"Accept",
+	"Accept-Encoding",
+	"Accept-Language",
+	"Authorization",
+	"Cookie",
+	"Range",
+	"User-Agent",
+	"X-Requested-With",
+}
+
+// dedupCall is an in-flight deduplicated request
+type dedupCall struct {
+	ctx  context.Context // context of the request performing the call
+	done chan struct{}
+	rsp  *http.Response
+	body []byte
+	err  error
+}
+
+// DefaultDedupKey builds a deduplication key from method, URL and significant headers
+func DefaultDedupKey(method, u string, header http.Header) string {
+	if method != http.MethodGet {
+		return ""
+	}
+
+	b := strings.Builder{}
+	b.WriteString(method)
+	b.WriteString(" ")
+	b.WriteString(u)
+
+	for _, k := range dedupHeaders {
+		if v := header.Values(k); len(v) > 0 {
+			b.WriteString("\n")
+			b.WriteString(k)
+			b.WriteString(": ")
+			b.WriteString(strings.Join(v, ", "))
+		}
+	}
+
+	return b.String()
+}
+
+// SetDedup enables or disables deduplication of concurrent identical requests
+func (c *Cli) SetDedup(enabled bool) {
+	c.dedupMux.Lock()
+	defer c.dedupMux.Unlock()
+
+	c.dedup = enabled
+	if c.dedupCalls == nil {
+		c.dedupCalls = make(map[string]*dedupCall)
+	}
+}
+
+// SetDedupKeyFunc sets deduplication key function. Nil restores the default one.
+func (c *Cli) SetDedupKeyFunc(fn DedupKeyFunc) {
+	c.dedupMux.Lock()
+	defer c.dedupMux.Unlock()
+
+	c.dedupKeyFunc = fn
+}
+
+// doDedup performs a request sharing its result with concurrent identical requests.
+//
+// Requests having a response check are never shared, because a response accepted by one caller's check
+// may be rejected by another's. Non-idempotent requests allowed to be retried share results only with each other.
+func (c *Cli) doDedup(
+	ctx context.Context,
+	method,
+	u string,
+	header http.Header,
+	body []byte,
+) (*http.Response, []byte, error) {
+	c.dedupMux.Lock()
+	if !c.dedup || responseCheck(ctx) != nil {
+		c.dedupMux.Unlock()
+		return c.doRequest(ctx, method, u, header, body)
+	}
+
+	keyFn := c.dedupKeyFunc
+	if keyFn == nil {
+		keyFn = DefaultDedupKey
+	}
+
+	key := keyFn(method, u, header)
+	if key == "" {
+		c.dedupMux.Unlock()
+		return c.doRequest(ctx, method, u, header, body)
+	}
+	if !IsIdempotent(method) && retryAllowed(ctx, method) {
+		key += "\nAllowRetry"
+	}
+
+	// Join the request which is already in flight
+	if call, ok := c.dedupCalls[key]; ok {
+		c.dedupMux.Unlock()
+		c.l.Debug("waiting for in-flight request: %v %v", method, u)
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-call.done:
+			// The performing request has been cancelled by its caller, so perform it again on our own context
+			if call.err != nil && call.ctx.Err() != nil && ctx.Err() == nil {
+				return c.doDedup(ctx, method, u, header, body)
+			}
+			return copyResponse(call.rsp), copyBytes(call.body), call.err
+		}
+	}
+
+	call := &dedupCall{ctx: ctx, done: make(chan struct{})}
+	c.dedupCalls[key] = call
+	c.dedupMux.Unlock()
+
+	call.rsp, call.body, call.err = c.doRequest(ctx, method, u, header, body)
+
+	c.dedupMux.Lock()
+	delete(c.dedupCalls, key)
+	c.dedupMux.Unlock()
+	close(call.done)
+
+	return copyResponse(call.rsp), copyBytes(call.body), call.err
+}
+
+// copyResponse returns a shallow copy of a response having its own header
+func copyResponse(rsp *http.Response) *http.Response {
+	if rsp == nil {
+		return nil
+	}
+
+	r := *rsp
+	r.Header = rsp.Header.Clone()
+
+	return &r
+}
+
+// copyBytes returns a copy of a byte slice
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+
+	r := make([]byte, len(b))
+	copy(r, b)
+
+	return r
+}
@@ -0,0 +1,208 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDedupSharesRequest(t *testing.T) {
+	var hits int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetDedup(true)
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 5)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			b, err := c.Get(context.Background(), srv.URL, nil, nil)
+			if err != nil {
+				t.Error(err)
+			}
+			bodies[i] = string(b)
+		}(i)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+	for i, b := range bodies {
+		if b != "ok" {
+			t.Errorf("request %d: unexpected body %q", i, b)
+		}
+	}
+}
+
+func TestDedupSkipsNonGet(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetDedup(true)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Post(context.Background(), srv.URL, nil, []byte("x")); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&hits); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestDedupLeaderCancelled(t *testing.T) {
+	var hits int32
+	started := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			started <- struct{}{}
+			<-r.Context().Done()
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetDedup(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := c.Get(ctx, srv.URL, nil, nil)
+		leaderErr <- err
+	}()
+	<-started
+
+	type result struct {
+		body []byte
+		err  error
+	}
+	follower := make(chan result, 1)
+	go func() {
+		b, err := c.Get(context.Background(), srv.URL, nil, nil)
+		follower <- result{b, err}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader: expected context.Canceled, got %v", err)
+	}
+
+	r := <-follower
+	if r.err != nil || string(r.body) != "ok" {
+		t.Errorf("follower: expected ok, got %q, %v", r.body, r.err)
+	}
+}
+
+func TestDedupSkipsCheckedRequests(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"a"}`))
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetMaxRetries(1)
+	c.SetDedup(true)
+
+	// Callers having different validators must not share a response
+	names := []string{"a", "b", "a"}
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			ctx := WithJSONValidator(context.Background(), func(target interface{}) error {
+				if target.(*testPayload).Name != name {
+					return errors.New("unexpected name")
+				}
+				return nil
+			})
+			var p testPayload
+			errs[i] = c.GetJSON(ctx, srv.URL, nil, nil, &p)
+		}(i, name)
+	}
+	wg.Wait()
+
+	if errs[0] != nil || errs[2] != nil || !errors.As(errs[1], new(*ValidationError)) {
+		t.Errorf("got errors %v", errs)
+	}
+	if n := atomic.LoadInt32(&hits); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestDedupAllowRetry(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	c.SetDedup(true)
+	c.SetDedupKeyFunc(func(method, u string, header http.Header) string {
+		return method + " " + u
+	})
+
+	// Requests allowed to be retried share results only with each other
+	ctxs := []context.Context{
+		context.Background(),
+		AllowRetry(context.Background()),
+		context.Background(),
+		AllowRetry(context.Background()),
+	}
+	var wg sync.WaitGroup
+	for _, ctx := range ctxs {
+		wg.Add(1)
+		go func(ctx context.Context) {
+			defer wg.Done()
+			if _, err := c.Post(ctx, srv.URL, nil, []byte("x")); err != nil {
+				t.Error(err)
+			}
+		}(ctx)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
@@ -0,0 +1,383 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSEEvent is a server-sent event
+type SSEEvent struct {
+	ID    string        // last event ID
+	Event string        // event type, "message" by default
+	Data  string        // event data, lines joined with "\n"
+	Retry time.Duration // reconnection time set by the server, zero if not set
+}
+
+// maxSSELine is a maximum length of an event stream line
+const maxSSELine = 1024 * 1024
+
+// sseParser parses an event stream keeping its state between connections
+type sseParser struct {
+	lastID string
+	retry  time.Duration
+}
+
+// ParseSSE parses a text/event-stream and calls fn for each event
+func ParseSSE(r io.Reader, fn func(ev SSEEvent) error) error {
+	return (&sseParser{}).parse(r, fn)
+}
+
+// parse parses an event stream and calls fn for each event until the stream ends or fn returns an error
+func (p *sseParser) parse(r io.Reader, fn func(ev SSEEvent) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 4096), maxSSELine)
+	sc.Split(scanSSELines)
+
+	var (
+		evType string
+		data   bytes.Buffer
+		idBuf  = p.lastID
+		first  = true
+	)
+
+	for sc.Scan() {
+		line := sc.Text()
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+
+		// Empty line dispatches the event
+		if line == "" {
+			p.lastID = idBuf
+			if data.Len() == 0 {
+				evType = ""
+				continue
+			}
+
+			ev := SSEEvent{
+				ID:    p.lastID,
+				Event: evType,
+				Data:  strings.TrimSuffix(data.String(), "\n"),
+				Retry: p.retry,
+			}
+			if ev.Event == "" {
+				ev.Event = "message"
+			}
+			evType = ""
+			data.Reset()
+
+			if err := fn(ev); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Comment
+		if line[0] == ':' {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			evType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				idBuf = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				p.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+
+	return sc.Err()
+}
+
+// scanSSELines is a bufio.SplitFunc splitting lines terminated by CRLF, LF or CR
+func scanSSELines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// CR, possibly followed by LF which may be not received yet
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+// SSEStream is a server-sent events subscription
+type SSEStream struct {
+	events chan SSEEvent
+	mux    sync.Mutex
+	lastID string
+	err    error
+}
+
+// Events returns a channel of received events. It's closed when the stream stops.
+func (s *SSEStream) Events() <-chan SSEEvent {
+	return s.events
+}
+
+// Err returns an error which stopped the stream, it's the context error if the context has been cancelled.
+// It should be called after the events channel is closed.
+func (s *SSEStream) Err() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.err
+}
+
+// LastEventID returns ID of the last event delivered on the events channel
+func (s *SSEStream) LastEventID() string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.lastID
+}
+
+// setLastEventID sets ID of the last delivered event
+func (s *SSEStream) setLastEventID(id string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.lastID = id
+}
+
+// setErr sets an error which stopped the stream
+func (s *SSEStream) setErr(err error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.err = err
+}
+
+// SSE subscribes to a server-sent events stream and delivers events on a channel until ctx is cancelled.
+//
+// When the connection is lost, the client reconnects sending Last-Event-ID after the delay set by the server
+// or the client's backoff delay. The stream stops if the server responds with 204 No Content, with a content type
+// other than text/event-stream, if connection attempts fail, or if the number of consecutive reconnects without
+// receiving any event exceeds the client's maximum number of retries.
+func (c *Cli) SSE(ctx context.Context, u string, header http.Header, lastEventID string) *SSEStream {
+	s := &SSEStream{
+		events: make(chan SSEEvent),
+		lastID: lastEventID,
+	}
+
+	go c.runSSE(ctx, s, u, header, lastEventID)
+
+	return s
+}
+
+// runSSE receives events of a stream reconnecting when needed.
+// The parser state is owned by the goroutine, the last event ID is published to the stream.
+func (c *Cli) runSSE(ctx context.Context, s *SSEStream, u string, header http.Header, lastEventID string) {
+	defer close(s.events)
+
+	parser := sseParser{lastID: lastEventID}
+
+	for fails := 0; ; {
+		h := fetchRequestHeader(header, "text/event-stream")
+		h.Set("Accept", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		if id := parser.lastID; id != "" {
+			h.Set("Last-Event-ID", id)
+		}
+
+		rsp, err := c.DoStream(ctx, http.MethodGet, u, h, nil)
+		if err != nil {
+			s.setErr(err)
+			return
+		}
+
+		if rsp.StatusCode == http.StatusNoContent {
+			_ = rsp.Body.Close()
+			return
+		}
+
+		if mt, _, _ := mime.ParseMediaType(rsp.Header.Get("Content-Type")); mt != "text/event-stream" {
+			_ = rsp.Body.Close()
+			s.setErr(fmt.Errorf("unexpected content type of event stream %s: %q", u, rsp.Header.Get("Content-Type")))
+			return
+		}
+
+		received := 0
+		err = parser.parse(rsp.Body, func(ev SSEEvent) error {
+			received++
+			select {
+			case s.events <- ev:
+				// The ID is published once the event is delivered, so resuming with it doesn't skip events
+				s.setLastEventID(ev.ID)
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		_ = rsp.Body.Close()
+
+		if ctx.Err() != nil {
+			s.setErr(ctx.Err())
+			return
+		}
+		s.setLastEventID(parser.lastID)
+
+		if received > 0 {
+			fails = 0
+		}
+		fails++
+		if fails > c.maxRetries {
+			if err == nil {
+				err = io.EOF
+			}
+			s.setErr(fmt.Errorf("event stream %s is lost after %d reconnects: %v", u, fails-1, err))
+			return
+		}
+
+		delay := parser.retry
+		if delay == 0 {
+			delay = c.backoff(fails)
+		}
+		c.l.Debug("event stream %s is lost: %v; reconnecting in %v", u, err, delay)
+
+		select {
+		case <-ctx.Done():
+			s.setErr(ctx.Err())
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// LongPollOptions are options of a long-poll loop
+type LongPollOptions struct {
+	Timeout  time.Duration // maximum duration of a single poll, zero means no limit
+	Interval time.Duration // delay between polls
+}
+
+// LongPollHandler handles a poll response and returns URL of the next poll, empty string means the same URL.
+// Returning ErrStopStream stops the loop without an error.
+type LongPollHandler func(rsp *http.Response, body []byte) (string, error)
+
+// LongPoll performs long-poll GET requests in a loop until ctx is cancelled or fn returns an error.
+//
+// Failed polls are retried like any other request. A poll which exceeds its timeout is considered empty
+// and the next poll is started.
+func (c *Cli) LongPoll(ctx context.Context, u string, header http.Header, opts LongPollOptions, fn LongPollHandler) error {
+	for fails := 0; ; {
+		pctx, cancel := ctx, context.CancelFunc(func() {})
+		if opts.Timeout > 0 {
+			pctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		}
+
+		rsp, body, err := c.poll(pctx, u, header)
+		cancel()
+
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil && pctx.Err() == context.DeadlineExceeded:
+			// Poll timed out without data
+			continue
+		case rsp == nil && err != nil:
+			return err
+		case err != nil:
+			// The response was received but couldn't be read
+			if fails++; fails > c.maxRetries {
+				return err
+			}
+			c.l.Debug("long-poll %s failed: %v", u, err)
+			if err := sleepCtx(ctx, c.backoff(fails)); err != nil {
+				return err
+			}
+			continue
+		}
+		fails = 0
+
+		next, err := fn(rsp, body)
+		if errors.Is(err, ErrStopStream) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if next != "" {
+			u = next
+		}
+
+		if err := sleepCtx(ctx, opts.Interval); err != nil {
+			return err
+		}
+	}
+}
+
+// poll performs a single long-poll request which is not limited by the client's timeout
+func (c *Cli) poll(ctx context.Context, u string, header http.Header) (*http.Response, []byte, error) {
+	rsp, err := c.DoStream(ctx, http.MethodGet, u, header, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = rsp.Body.Close()
+	}()
+
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return rsp, nil, fmt.Errorf("error while reading response body: %v", err)
+	}
+
+	return rsp, body, nil
+}
+
+// sleepCtx sleeps for a duration or until ctx is cancelled
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
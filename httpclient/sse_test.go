@@ -0,0 +1,234 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseSSE(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		evs  []SSEEvent
+	}{
+		{
+			name: "basic",
+			in:   "data: hello\n\n",
+			evs:  []SSEEvent{{Event: "message", Data: "hello"}},
+		},
+		{
+			name: "fields",
+			in:   "\ufeff: comment\nid: 1\nevent: update\ndata: a\ndata:b\nretry: 250\n\n",
+			evs:  []SSEEvent{{ID: "1", Event: "update", Data: "a\nb", Retry: 250 * time.Millisecond}},
+		},
+		{
+			name: "line endings",
+			in:   "data: a\r\n\r\ndata: b\r\rdata: c\n\n",
+			evs:  []SSEEvent{{Event: "message", Data: "a"}, {Event: "message", Data: "b"}, {Event: "message", Data: "c"}},
+		},
+		{
+			name: "id persists",
+			in:   "id: 7\ndata: a\n\ndata: b\n\nid\ndata: c\n\n",
+			evs:  []SSEEvent{{ID: "7", Event: "message", Data: "a"}, {ID: "7", Event: "message", Data: "b"}, {Event: "message", Data: "c"}},
+		},
+		{
+			name: "no data",
+			in:   "event: x\n\nid: 1\n\ndata\n\n",
+			evs:  []SSEEvent{{ID: "1", Event: "message", Data: ""}},
+		},
+		{
+			name: "unterminated",
+			in:   "data: a\n\ndata: b",
+			evs:  []SSEEvent{{Event: "message", Data: "a"}},
+		},
+		{
+			name: "invalid retry",
+			in:   "retry: 1s\ndata: a\n\n",
+			evs:  []SSEEvent{{Event: "message", Data: "a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var evs []SSEEvent
+			err := ParseSSE(strings.NewReader(tt.in), func(ev SSEEvent) error {
+				evs = append(evs, ev)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(evs, tt.evs) {
+				t.Errorf("expected %+v, got %+v", tt.evs, evs)
+			}
+		})
+	}
+}
+
+func TestSSEReconnect(t *testing.T) {
+	var conns int32
+	lastIDs := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&conns, 1)
+		lastIDs <- r.Header.Get("Last-Event-ID")
+		if n == 3 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 2; i++ {
+			_, _ = fmt.Fprintf(w, "retry: 10\nid: %d-%d\ndata: hello\n\n", n, i)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+	s := c.SSE(context.Background(), srv.URL, nil, "start")
+
+	// Read the last event ID concurrently with the stream updating it
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				_ = s.LastEventID()
+			}
+		}
+	}()
+
+	var ids []string
+	for ev := range s.Events() {
+		ids = append(ids, ev.ID)
+	}
+	close(done)
+
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"1-0", "1-1", "2-0", "2-1"}; !reflect.DeepEqual(ids, exp) {
+		t.Errorf("expected events %v, got %v", exp, ids)
+	}
+	if id := s.LastEventID(); id != "2-1" {
+		t.Errorf("unexpected last event ID %q", id)
+	}
+
+	close(lastIDs)
+	var sent []string
+	for id := range lastIDs {
+		sent = append(sent, id)
+	}
+	if exp := []string{"start", "1-1", "2-1"}; !reflect.DeepEqual(sent, exp) {
+		t.Errorf("expected Last-Event-ID headers %v, got %v", exp, sent)
+	}
+}
+
+func TestSSEContentType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("data: x\n\n"))
+	}))
+	defer srv.Close()
+
+	s := newTestCli(t).SSE(context.Background(), srv.URL, nil, "")
+	for range s.Events() {
+		t.Error("unexpected event")
+	}
+	if s.Err() == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestSSECancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: x\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newTestCli(t).SSE(ctx, srv.URL, nil, "")
+	<-s.Events()
+	cancel()
+	for range s.Events() {
+	}
+	if s.Err() != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", s.Err())
+	}
+}
+
+func TestSSELastEventIDOnCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("id: 1\ndata: a\n\nid: 2\ndata: b\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newTestCli(t).SSE(ctx, srv.URL, nil, "0")
+	if s.LastEventID() != "0" {
+		t.Errorf("expected initial last event ID 0, got %q", s.LastEventID())
+	}
+
+	<-s.Events()
+	// The second event is pending when the context is cancelled
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	for ev := range s.Events() {
+		t.Errorf("unexpected event %+v", ev)
+	}
+
+	if id := s.LastEventID(); id != "1" {
+		t.Errorf("expected last event ID 1, got %q", id)
+	}
+}
+
+func TestLongPoll(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first poll exceeds its timeout
+		if atomic.AddInt32(&hits, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		_, _ = w.Write([]byte("cursor=" + r.URL.Query().Get("cursor")))
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t)
+
+	var bodies []string
+	err := c.LongPoll(context.Background(), srv.URL, nil, LongPollOptions{Timeout: 100 * time.Millisecond},
+		func(rsp *http.Response, body []byte) (string, error) {
+			bodies = append(bodies, string(body))
+			if len(bodies) == 3 {
+				return "", ErrStopStream
+			}
+			return fmt.Sprintf("%s?cursor=%d", srv.URL, len(bodies)), nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := []string{"cursor=", "cursor=1", "cursor=2"}; !reflect.DeepEqual(bodies, exp) {
+		t.Errorf("expected %v, got %v", exp, bodies)
+	}
+}
@@ -0,0 +1,95 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// streamCtxKey is a context key marking streamed requests
+type streamCtxKey struct{}
+
+// isStream reports whether a request's response body must be left open
+func isStream(ctx context.Context) bool {
+	v, _ := ctx.Value(streamCtxKey{}).(bool)
+	return v
+}
+
+// DoStream performs an HTTP request and returns the response having its body not read.
+//
+// Failures are retried until a successful response is received, errors while reading the body are not retried.
+// Detection rules matching response bodies don't apply to successful responses, and such responses are not dumped.
+// Requests are never deduplicated and are not limited by the client's timeout. The caller must close the response body.
+func (c *Cli) DoStream(
+	ctx context.Context,
+	method,
+	u string,
+	header http.Header,
+	body []byte,
+) (*http.Response, error) {
+	rsp, _, err := c.doRequest(context.WithValue(ctx, streamCtxKey{}, true), method, u, header, body)
+	return rsp, err
+}
+
+// streamBody is a streamed response body which finishes the request attempt when closed
+type streamBody struct {
+	rd   io.ReadCloser
+	raw  io.Closer
+	n    int
+	err  error
+	once sync.Once
+	done func(n int, err error)
+}
+
+// Read implements io.Reader
+func (b *streamBody) Read(p []byte) (int, error) {
+	n, err := b.rd.Read(p)
+	b.n += n
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+
+	return n, err
+}
+
+// Close implements io.Closer
+func (b *streamBody) Close() error {
+	var err error
+	b.once.Do(func() {
+		_ = b.rd.Close()
+		err = b.raw.Close()
+		b.done(b.n, b.err)
+	})
+
+	return err
+}
+
+// streamBody replaces response body with a streamBody decoding the content and limiting bandwidth
+func (c *Cli) streamBody(m *Metrics, req *http.Request, rsp *http.Response, reqLen, tryNum int, start time.Time) error {
+	enc := strings.ToLower(strings.TrimSpace(rsp.Header.Get("Content-Encoding")))
+	rd, err := decodeReader(enc, c.limitReader(req.Context(), Download, req.URL.Hostname(), rsp.Body))
+	if err != nil {
+		_ = rsp.Body.Close()
+		return err
+	}
+
+	if enc != "" && enc != "identity" {
+		rsp.Header.Del("Content-Encoding")
+		rsp.Header.Del("Content-Length")
+		rsp.ContentLength = -1
+		rsp.Uncompressed = true
+	}
+
+	rsp.Body = &streamBody{
+		rd:  rd,
+		raw: rsp.Body,
+		done: func(n int, err error) {
+			c.finishAttempt(m, req, rsp, err, tryNum, reqLen, n, start)
+		},
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Direction is a traffic direction
+type Direction int
+
+const (
+	Download Direction = iota // response reading
+	Upload                    // request body sending
+)
+
+// RateLimiter is a token bucket limiter of bytes per second
+type RateLimiter struct {
+	mux    sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter allowing bps bytes per second with bursts up to burst bytes.
+//
+// If burst is not positive, it equals to bps. Not positive bps means no limit.
+func NewRateLimiter(bps, burst int) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetLimit(bps, burst)
+	l.tokens = l.burst
+
+	return l
+}
+
+// SetLimit changes the limit. It takes effect immediately, including transfers in progress.
+func (l *RateLimiter) SetLimit(bps, burst int) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if burst <= 0 {
+		burst = bps
+	}
+
+	l.rate = float64(bps)
+	l.burst = float64(burst)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = time.Now()
+}
+
+// Burst returns maximum burst size, or zero if the limiter doesn't limit anything
+func (l *RateLimiter) Burst() int {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.rate <= 0 {
+		return 0
+	}
+
+	return int(l.burst)
+}
+
+// WaitN blocks until n bytes may be transferred
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	for {
+		l.mux.Lock()
+		if l.rate <= 0 {
+			l.mux.Unlock()
+			return nil
+		}
+
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+
+		// Requests larger than the burst are allowed to take the whole bucket
+		need := float64(n)
+		if need > l.burst {
+			need = l.burst
+		}
+
+		if l.tokens >= need {
+			l.tokens -= float64(n)
+			l.mux.Unlock()
+			return nil
+		}
+
+		wait := time.Duration((need - l.tokens) / l.rate * float64(time.Second))
+		l.mux.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// bandwidth holds client's rate limiters
+type bandwidth struct {
+	mux    sync.Mutex
+	global [2]*RateLimiter
+	hosts  [2]map[string]*RateLimiter
+}
+
+// SetBandwidthLimit sets a bandwidth limit in bytes per second with bursts up to burst bytes.
+//
+// Empty host sets the global limit shared by all requests, otherwise the limit applies to the host only.
+// Not positive bps removes the limit. Limits may be changed at any time.
+func (c *Cli) SetBandwidthLimit(dir Direction, host string, bps, burst int) {
+	bw := &c.bandwidth
+
+	bw.mux.Lock()
+	defer bw.mux.Unlock()
+
+	if host == "" {
+		if bw.global[dir] != nil {
+			bw.global[dir].SetLimit(bps, burst)
+		} else if bps > 0 {
+			bw.global[dir] = NewRateLimiter(bps, burst)
+		}
+		return
+	}
+
+	host = strings.ToLower(host)
+	if bw.hosts[dir] == nil {
+		bw.hosts[dir] = make(map[string]*RateLimiter)
+	}
+
+	if l, ok := bw.hosts[dir][host]; ok {
+		l.SetLimit(bps, burst)
+		if bps <= 0 {
+			delete(bw.hosts[dir], host)
+		}
+	} else if bps > 0 {
+		bw.hosts[dir][host] = NewRateLimiter(bps, burst)
+	}
+}
+
+// limiters returns limiters applicable to a host
+func (c *Cli) limiters(dir Direction, host string) []*RateLimiter {
+	bw := &c.bandwidth
+
+	bw.mux.Lock()
+	defer bw.mux.Unlock()
+
+	var r []*RateLimiter
+	if bw.global[dir] != nil {
+		r = append(r, bw.global[dir])
+	}
+	if l, ok := bw.hosts[dir][strings.ToLower(host)]; ok {
+		r = append(r, l)
+	}
+
+	return r
+}
+
+// limitedReader is a reader which obeys rate limiters
+type limitedReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*RateLimiter
+}
+
+// Read implements io.Reader
+func (r *limitedReader) Read(p []byte) (int, error) {
+	// Don't read more than any of the limiters allows at once
+	for _, l := range r.limiters {
+		if b := l.Burst(); b > 0 && len(p) > b {
+			p = p[:b]
+		}
+	}
+
+	n, err := r.r.Read(p)
+	for _, l := range r.limiters {
+		if wErr := l.WaitN(r.ctx, n); wErr != nil {
+			return n, wErr
+		}
+	}
+
+	return n, err
+}
+
+// limitReader wraps a reader with host's rate limiters, if there are any
+func (c *Cli) limitReader(ctx context.Context, dir Direction, host string, r io.Reader) io.Reader {
+	limiters := c.limiters(dir, host)
+	if len(limiters) == 0 {
+		return r
+	}
+
+	return &limitedReader{ctx: ctx, r: r, limiters: limiters}
+}
+
+// limitedBody returns a request body reader obeying upload limits
+func (c *Cli) limitedBody(ctx context.Context, host string, body []byte) io.ReadCloser {
+	return ioutil.NopCloser(c.limitReader(ctx, Upload, host, bytes.NewReader(body)))
+}
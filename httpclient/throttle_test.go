@@ -0,0 +1,157 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(10000, 1000)
+	if b := l.Burst(); b != 1000 {
+		t.Errorf("got burst %d, want 1000", b)
+	}
+
+	// The bucket is full initially, the rest is limited by the rate
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := l.WaitN(context.Background(), 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 400*time.Millisecond || d > 1500*time.Millisecond {
+		t.Errorf("5000 bytes over the burst at 10000 B/s took %v", d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.WaitN(ctx, 1000); err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want deadline exceeded", err)
+	}
+
+	// Removing the limit releases waiters immediately
+	l.SetLimit(0, 0)
+	if b := l.Burst(); b != 0 {
+		t.Errorf("got burst %d, want 0", b)
+	}
+	start = time.Now()
+	if err := l.WaitN(context.Background(), 1<<20); err != nil || time.Since(start) > 50*time.Millisecond {
+		t.Errorf("unlimited wait took %v, %v", time.Since(start), err)
+	}
+
+	if b := NewRateLimiter(500, 0).Burst(); b != 500 {
+		t.Errorf("got default burst %d, want 500", b)
+	}
+}
+
+func TestBandwidthLimiters(t *testing.T) {
+	c := newTestCli(t)
+
+	if l := c.limiters(Download, "example.com"); len(l) != 0 {
+		t.Fatalf("got %d limiters without limits", len(l))
+	}
+
+	c.SetBandwidthLimit(Download, "", 1000, 0)
+	c.SetBandwidthLimit(Download, "Example.com", 500, 0)
+	c.SetBandwidthLimit(Upload, "example.com", 100, 0)
+
+	tests := []struct {
+		dir   Direction
+		host  string
+		burst []int
+	}{
+		{Download, "example.com", []int{1000, 500}}, // both global and host limits apply
+		{Download, "EXAMPLE.COM", []int{1000, 500}},
+		{Download, "other.com", []int{1000}},
+		{Upload, "example.com", []int{100}},
+		{Upload, "other.com", nil},
+	}
+	for _, tt := range tests {
+		var got []int
+		for _, l := range c.limiters(tt.dir, tt.host) {
+			got = append(got, l.Burst())
+		}
+		if len(got) != len(tt.burst) {
+			t.Errorf("%d %s: got bursts %v, want %v", tt.dir, tt.host, got, tt.burst)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.burst[i] {
+				t.Errorf("%d %s: got bursts %v, want %v", tt.dir, tt.host, got, tt.burst)
+			}
+		}
+	}
+
+	// Removing limits
+	c.SetBandwidthLimit(Download, "example.com", 0, 0)
+	if l := c.limiters(Download, "example.com"); len(l) != 1 {
+		t.Errorf("got %d limiters after removing the host limit", len(l))
+	}
+	c.SetBandwidthLimit(Download, "", -1, 0)
+	for _, l := range c.limiters(Download, "example.com") {
+		if l.Burst() != 0 {
+			t.Errorf("global limit is not removed")
+		}
+	}
+}
+
+func TestBandwidthThroughput(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 10000)
+	var uploaded int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		uploaded = len(b)
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := u.Hostname()
+
+	c := newTestCli(t)
+	measure := func() time.Duration {
+		start := time.Now()
+		body, err := c.Get(context.Background(), srv.URL, nil, nil)
+		if err != nil || len(body) != len(data) {
+			t.Fatalf("got %d bytes, %v", len(body), err)
+		}
+		return time.Since(start)
+	}
+
+	if d := measure(); d > 300*time.Millisecond {
+		t.Fatalf("unlimited download took %v", d)
+	}
+
+	// 8000 bytes over the burst at 20000 B/s take 0.4s, the stricter of global and host limits applies
+	c.SetBandwidthLimit(Download, "", 20000, 2000)
+	if d := measure(); d < 350*time.Millisecond || d > 2*time.Second {
+		t.Errorf("download with a global limit took %v", d)
+	}
+	c.SetBandwidthLimit(Download, "", 1000000, 0)
+	c.SetBandwidthLimit(Download, host, 20000, 2000)
+	if d := measure(); d < 350*time.Millisecond || d > 2*time.Second {
+		t.Errorf("download with a host limit took %v", d)
+	}
+	c.SetBandwidthLimit(Download, "other.com", 1, 0)
+	c.SetBandwidthLimit(Download, host, 0, 0)
+	if d := measure(); d > 300*time.Millisecond {
+		t.Errorf("download after removing the host limit took %v", d)
+	}
+
+	c.SetBandwidthLimit(Upload, host, 20000, 2000)
+	start := time.Now()
+	if _, err := c.Post(AllowRetry(context.Background()), srv.URL, nil, data); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 350*time.Millisecond || d > 2*time.Second || uploaded != len(data) {
+		t.Errorf("upload of %d bytes took %v", uploaded, d)
+	}
+}
@@ -0,0 +1,235 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TLSOptions are client TLS options
+type TLSOptions struct {
+	CAFiles     []string // PEM encoded CA bundles to trust
+	NoSystemCAs bool     // trust only CA bundles from CAFiles, not system ones
+	CertFile    string   // PEM encoded client certificate
+	KeyFile     string   // PEM encoded client certificate key
+	MinVersion  uint16   // minimum TLS version, tls.VersionTLS12 by default
+	Insecure    bool     // skip server certificate verification, for local testing only
+	ServerName  string   // server name to verify instead of request's host
+
+	// Pins are base64 encoded SHA-256 hashes of certificates' SubjectPublicKeyInfo per host.
+	// A connection to a host having pins succeeds only if at least one certificate of the chain matches a pin.
+	// Certificates are verified during the TLS handshake, before a request is sent. Connections made through a proxy
+	// to hosts given as IP addresses or having ServerName set are verified only after the response is received.
+	Pins map[string][]string
+}
+
+// PinError is returned when no server certificate matches host's pins
+type PinError struct {
+	Host   string
+	Hashes []string // SPKI hashes of presented certificates
+}
+
+// Error implements error interface
+func (e *PinError) Error() string {
+	return fmt.Sprintf("certificate pin mismatch for host %s, presented SPKI hashes: %s", e.Host, strings.Join(e.Hashes, ", "))
+}
+
+// SPKIHash returns base64 encoded SHA-256 hash of certificate's SubjectPublicKeyInfo
+func SPKIHash(cert *x509.Certificate) string {
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// SetTLS sets client TLS options
+func (c *Cli) SetTLS(opts TLSOptions) error {
+	cfg, err := newTLSConfig(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.Insecure {
+		c.l.Warn("!!! TLS CERTIFICATE VERIFICATION IS DISABLED, NEVER USE IT IN PRODUCTION !!!")
+	}
+
+	pins := normalizePins(opts.Pins)
+	c.updateTransport(func(tr *http.Transport) {
+		c.tlsPins = pins
+		tr.TLSClientConfig = cfg
+		tr.DialTLSContext = nil
+		if len(pins) > 0 {
+			tr.DialTLSContext = c.dialTLS
+		}
+	})
+
+	return nil
+}
+
+// newTLSConfig builds a TLS config
+func newTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         opts.MinVersion,
+		InsecureSkipVerify: opts.Insecure,
+		ServerName:         opts.ServerName,
+	}
+
+	if cfg.MinVersion == 0 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+
+	if len(opts.CAFiles) > 0 {
+		pool := x509.NewCertPool()
+		if !opts.NoSystemCAs {
+			sysPool, err := x509.SystemCertPool()
+			if err != nil {
+				return nil, fmt.Errorf("failed to load system CA bundle: %v", err)
+			}
+			pool = sysPool
+		}
+
+		for _, fPath := range opts.CAFiles {
+			b, err := ioutil.ReadFile(fPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA bundle %v: %v", fPath, err)
+			}
+			if !pool.AppendCertsFromPEM(b) {
+				return nil, fmt.Errorf("no certificates found in CA bundle %v", fPath)
+			}
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	// Connections through a proxy are established by the transport, the server name is the only clue of the host
+	if len(opts.Pins) > 0 && opts.ServerName == "" {
+		pins := normalizePins(opts.Pins)
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if cs.ServerName == "" {
+				return nil
+			}
+			return verifyPins(pins, cs.ServerName, cs)
+		}
+	}
+
+	return cfg, nil
+}
+
+// dialTLS establishes a TLS connection verifying server certificates against pins of the dialed host
+func (c *Cli) dialTLS(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.trMux.RLock()
+	tr, pins := c.tr, c.tlsPins
+	c.trMux.RUnlock()
+
+	dial := tr.DialContext
+	if dial == nil {
+		dial = c.dialer.DialContext
+	}
+	conn, err := dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{}
+	if tr.TLSClientConfig != nil {
+		cfg = tr.TLSClientConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		return verifyPins(pins, host, cs)
+	}
+
+	if t := tr.TLSHandshakeTimeout; t > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t)
+		defer cancel()
+	}
+
+	tc := tls.Client(conn, cfg)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- tc.Handshake()
+	}()
+
+	select {
+	case <-ctx.Done():
+		_ = conn.Close()
+		<-errC
+		return nil, ctx.Err()
+	case err := <-errC:
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	return tc, nil
+}
+
+// checkPins verifies response's connection certificates against client's pins.
+// It catches connections made through a proxy which cannot be verified during the handshake.
+func (c *Cli) checkPins(rsp *http.Response) error {
+	c.trMux.RLock()
+	pins := c.tlsPins
+	c.trMux.RUnlock()
+
+	if len(pins) == 0 || rsp == nil || rsp.TLS == nil || rsp.Request == nil {
+		return nil
+	}
+
+	return verifyPins(pins, rsp.Request.URL.Hostname(), *rsp.TLS)
+}
+
+// normalizePins converts pins into a lookup table
+func normalizePins(p map[string][]string) map[string]map[string]bool {
+	r := make(map[string]map[string]bool)
+	for host, hashes := range p {
+		host = strings.ToLower(host)
+		r[host] = make(map[string]bool)
+		for _, h := range hashes {
+			r[host][h] = true
+		}
+	}
+
+	return r
+}
+
+// verifyPins checks whether at least one of connection's certificates matches host's pins
+func verifyPins(pins map[string]map[string]bool, host string, cs tls.ConnectionState) error {
+	host = strings.ToLower(host)
+	hostPins, ok := pins[host]
+	if !ok {
+		return nil
+	}
+
+	hashes := make([]string, 0, len(cs.PeerCertificates))
+	for _, cert := range cs.PeerCertificates {
+		h := SPKIHash(cert)
+		if hostPins[h] {
+			return nil
+		}
+		hashes = append(hashes, h)
+	}
+
+	return &PinError{Host: host, Hashes: hashes}
+}
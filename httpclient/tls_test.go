@@ -0,0 +1,144 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTLSPins(t *testing.T) {
+	var hits int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "aghpu-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := u.Hostname()
+	pin := SPKIHash(srv.Certificate())
+
+	tests := []struct {
+		name       string
+		serverName string
+		pins       []string
+		wantErr    bool
+	}{
+		{"match", "", []string{"other", pin}, false},
+		{"mismatch", "", []string{"other"}, true},
+		{"server name match", "example.com", []string{pin}, false},
+		{"server name mismatch", "example.com", []string{"other"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&hits, 0)
+
+			c := newTestCli(t)
+			err := c.SetTLS(TLSOptions{
+				CAFiles:     []string{caFile},
+				NoSystemCAs: true,
+				ServerName:  tt.serverName,
+				Pins:        map[string][]string{host: tt.pins},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = c.Get(context.Background(), srv.URL, nil, nil)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			var pinErr *PinError
+			if !errors.As(err, &pinErr) {
+				t.Fatalf("got error %v, want PinError", err)
+			}
+			if pinErr.Host != host || len(pinErr.Hashes) != 1 || pinErr.Hashes[0] != pin {
+				t.Errorf("got %+v", pinErr)
+			}
+			if n := atomic.LoadInt32(&hits); n != 0 {
+				t.Errorf("request is sent to a server failing pin verification %d times", n)
+			}
+		})
+	}
+}
+
+func TestSetTLSConcurrent(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestCli(t)
+	c.SetMaxRetries(1)
+	if err := c.SetTLS(TLSOptions{Insecure: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(context.Background(), srv.URL, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests in progress don't race with changes of settings
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				_, _ = c.Get(context.Background(), srv.URL, nil, nil)
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		if err := c.SetTLS(TLSOptions{Insecure: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	// Idle connections made with old settings are not reused
+	err = c.SetTLS(TLSOptions{Insecure: true, Pins: map[string][]string{u.Hostname(): {"other"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pinErr *PinError
+	if _, err := c.Get(context.Background(), srv.URL, nil, nil); !errors.As(err, &pinErr) {
+		t.Errorf("got error %v, want PinError", err)
+	}
+}
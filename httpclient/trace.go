@@ -0,0 +1,149 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+type tracerCtxKey struct{}
+
+// Timing is a request timing breakdown
+type Timing struct {
+	DNS      time.Duration `json:"dns"`      // DNS lookup
+	Connect  time.Duration `json:"connect"`  // TCP connection establishing
+	TLS      time.Duration `json:"tls"`      // TLS handshake
+	TTFB     time.Duration `json:"ttfb"`     // from the request is written until the first response byte is received
+	Transfer time.Duration `json:"transfer"` // from the first response byte until the response body is read
+	Total    time.Duration `json:"total"`    // from the request start until the response body is read
+	Reused   bool          `json:"reused"`   // whether a connection has been reused
+}
+
+// String returns human readable representation of the timing
+func (t Timing) String() string {
+	return fmt.Sprintf("dns=%v connect=%v tls=%v ttfb=%v transfer=%v total=%v reused=%v",
+		t.DNS, t.Connect, t.TLS, t.TTFB, t.Transfer, t.Total, t.Reused)
+}
+
+// tracer collects timing of a request
+type tracer struct {
+	mux sync.Mutex
+	t   Timing
+
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wrote        time.Time
+	firstByte    time.Time
+}
+
+// SetTrace enables or disables request timing tracing
+func (c *Cli) SetTrace(enabled bool) {
+	c.trace = enabled
+}
+
+// TimingFromRequest returns timing of a traced request
+func TimingFromRequest(req *http.Request) (Timing, bool) {
+	if req == nil {
+		return Timing{}, false
+	}
+
+	tr, ok := req.Context().Value(tracerCtxKey{}).(*tracer)
+	if !ok {
+		return Timing{}, false
+	}
+
+	return tr.timing(), true
+}
+
+// TimingFromResponse returns timing of a traced request which the response belongs to
+func TimingFromResponse(rsp *http.Response) (Timing, bool) {
+	if rsp == nil {
+		return Timing{}, false
+	}
+
+	return TimingFromRequest(rsp.Request)
+}
+
+// withTracer returns a context which traces requests
+func withTracer(ctx context.Context) context.Context {
+	tr := &tracer{start: time.Now()}
+
+	ctx = context.WithValue(ctx, tracerCtxKey{}, tr)
+
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			tr.mux.Lock()
+			tr.dnsStart = time.Now()
+			tr.mux.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			tr.mux.Lock()
+			tr.t.DNS = time.Since(tr.dnsStart)
+			tr.mux.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			tr.mux.Lock()
+			tr.connectStart = time.Now()
+			tr.mux.Unlock()
+		},
+		ConnectDone: func(string, string, error) {
+			tr.mux.Lock()
+			tr.t.Connect = time.Since(tr.connectStart)
+			tr.mux.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			tr.mux.Lock()
+			tr.tlsStart = time.Now()
+			tr.mux.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			tr.mux.Lock()
+			tr.t.TLS = time.Since(tr.tlsStart)
+			tr.mux.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			tr.mux.Lock()
+			tr.t.Reused = info.Reused
+			tr.mux.Unlock()
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			tr.mux.Lock()
+			tr.wrote = time.Now()
+			tr.mux.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			tr.mux.Lock()
+			tr.firstByte = time.Now()
+			if !tr.wrote.IsZero() {
+				tr.t.TTFB = tr.firstByte.Sub(tr.wrote)
+			}
+			tr.mux.Unlock()
+		},
+	})
+}
+
+// finish marks the response body as read
+func (tr *tracer) finish() {
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+
+	now := time.Now()
+	if !tr.firstByte.IsZero() {
+		tr.t.Transfer = now.Sub(tr.firstByte)
+	}
+	tr.t.Total = now.Sub(tr.start)
+}
+
+// timing returns a copy of collected timing
+func (tr *tracer) timing() Timing {
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+
+	return tr.t
+}
@@ -0,0 +1,86 @@
+package httpclient
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTiming(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.(http.Flusher).Flush()
+		time.Sleep(20 * time.Millisecond)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A host name makes the client resolve it
+	target := "https://localhost:" + u.Port() + "/"
+
+	c := newTestCli(t)
+	c.SetMaxRetries(1)
+	if err := c.SetTLS(TLSOptions{Insecure: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	rsp, _, err := c.DoRequest(context.Background(), http.MethodGet, target, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := TimingFromResponse(rsp); ok {
+		t.Error("got timing of an untraced request")
+	}
+
+	// A fresh connection
+	c.Client().CloseIdleConnections()
+	c.SetTrace(true)
+	rsp, _, err = c.DoRequest(context.Background(), http.MethodGet, target, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm, ok := TimingFromResponse(rsp)
+	if !ok {
+		t.Fatal("no timing")
+	}
+	if tm.DNS <= 0 || tm.Connect <= 0 || tm.TLS <= 0 || tm.TTFB < 20*time.Millisecond || tm.Transfer < 20*time.Millisecond {
+		t.Errorf("got timing %v", tm)
+	}
+	if tm.Reused {
+		t.Errorf("new connection is reported as reused: %v", tm)
+	}
+	if sum := tm.DNS + tm.Connect + tm.TLS + tm.TTFB + tm.Transfer; tm.Total < sum {
+		t.Errorf("total %v is less than the sum of phases %v: %v", tm.Total, sum, tm)
+	}
+	if rt, ok := TimingFromRequest(rsp.Request); !ok || rt != tm {
+		t.Errorf("got request timing %v, %v", rt, ok)
+	}
+
+	// The same connection is used for the next request
+	rsp, _, err = c.DoRequest(context.Background(), http.MethodGet, target, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm, ok = TimingFromResponse(rsp)
+	if !ok || !tm.Reused || tm.DNS != 0 || tm.Connect != 0 || tm.TLS != 0 || tm.TTFB <= 0 || tm.Total < tm.TTFB+tm.Transfer {
+		t.Errorf("got timing of a reused connection %v, %v", tm, ok)
+	}
+
+	if _, ok := TimingFromResponse(nil); ok {
+		t.Error("got timing of a nil response")
+	}
+	if _, ok := TimingFromRequest(nil); ok {
+		t.Error("got timing of a nil request")
+	}
+}
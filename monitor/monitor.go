@@ -0,0 +1,342 @@
+// Package monitor watches regions of web pages and notifies about their changes.
+package monitor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashep/aghpu/httpclient"
+	"github.com/ashep/aghpu/logger"
+	"github.com/ashep/aghpu/util"
+)
+
+// DefaultInterval is a default check interval
+const DefaultInterval = time.Hour
+
+// Target is a watched page region
+type Target struct {
+	Name     string        // unique name used for the snapshot file, URL if empty
+	URL      string        // page URL
+	Selector string        // CSS selector of the region, whole page body if empty
+	Ignore   string        // CSS selector of elements excluded from the region, like timestamps or ads
+	Header   http.Header   // additional request headers
+	Interval time.Duration // check interval, the monitor's interval if zero
+}
+
+// name returns target name
+func (t Target) name() string {
+	if t.Name != "" {
+		return t.Name
+	}
+
+	return t.URL
+}
+
+// Snapshot is a stored state of a target
+type Snapshot struct {
+	Name        string    `json:"name"`
+	URL         string    `json:"url"`
+	Selector    string    `json:"selector,omitempty"`
+	Time        time.Time `json:"time"`
+	Fingerprint string    `json:"fingerprint"`
+	Content     string    `json:"content"`
+}
+
+// Change is a detected change of a target
+type Change struct {
+	Target Target
+	Prev   *Snapshot
+	Cur    *Snapshot
+	Diff   []util.DiffLine
+}
+
+// Text returns a readable description of the change
+func (c *Change) Text() string {
+	var buf strings.Builder
+
+	buf.WriteString(fmt.Sprintf("%s has changed\n", c.Target.name()))
+	buf.WriteString(fmt.Sprintf("URL: %s\n", c.Cur.URL))
+	if c.Cur.Selector != "" {
+		buf.WriteString(fmt.Sprintf("Selector: %s\n", c.Cur.Selector))
+	}
+	buf.WriteString(fmt.Sprintf("Previous check: %s\n", c.Prev.Time.Format(time.RFC3339)))
+	buf.WriteString(fmt.Sprintf("Current check: %s\n", c.Cur.Time.Format(time.RFC3339)))
+	buf.WriteString("\n")
+	buf.WriteString(util.FormatDiff(c.Diff, 3))
+
+	return buf.String()
+}
+
+// Monitor periodically checks targets and notifies about their changes
+type Monitor struct {
+	cli       *httpclient.Cli
+	dir       string
+	l         *logger.Logger
+	interval  time.Duration
+	targets   []Target
+	notifiers []Notifier
+	mux       sync.Mutex
+}
+
+// New creates a new monitor keeping snapshots in dir
+func New(cli *httpclient.Cli, dir string, l *logger.Logger) (*Monitor, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshots directory: %v", err)
+	}
+
+	return &Monitor{
+		cli:      cli,
+		dir:      dir,
+		l:        l,
+		interval: DefaultInterval,
+	}, nil
+}
+
+// SetInterval sets a default check interval
+func (m *Monitor) SetInterval(d time.Duration) {
+	m.interval = d
+}
+
+// AddTarget adds a target to watch
+func (m *Monitor) AddTarget(t Target) error {
+	if t.URL == "" {
+		return errors.New("target URL is empty")
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	for _, et := range m.targets {
+		if et.name() == t.name() {
+			return fmt.Errorf("target %s already exists", t.name())
+		}
+	}
+	m.targets = append(m.targets, t)
+
+	return nil
+}
+
+// AddNotifier adds a notifier of changes. Notifiers may be called concurrently.
+func (m *Monitor) AddNotifier(n Notifier) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.notifiers = append(m.notifiers, n)
+}
+
+// Run checks all targets at their intervals until ctx is cancelled.
+// Every target is checked immediately after start. Check errors are logged.
+func (m *Monitor) Run(ctx context.Context) error {
+	m.mux.Lock()
+	targets := append([]Target(nil), m.targets...)
+	m.mux.Unlock()
+
+	if len(targets) == 0 {
+		return errors.New("no targets to watch")
+	}
+
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t Target) {
+			defer wg.Done()
+			m.watch(ctx, t)
+		}(t)
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// watch checks a target at its interval until ctx is cancelled
+func (m *Monitor) watch(ctx context.Context, t Target) {
+	interval := t.Interval
+	if interval <= 0 {
+		interval = m.interval
+	}
+
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+
+	for {
+		if _, err := m.Check(ctx, t); err != nil && ctx.Err() == nil {
+			m.l.Err("failed to check %s: %v", t.name(), err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+		}
+	}
+}
+
+// Check fetches a target, compares it with the stored snapshot and notifies about a change.
+//
+// It returns nil change if the target hasn't changed or it's checked for the first time.
+// If a notifier fails, the change is returned along with an error and the previous snapshot is kept,
+// so the change is notified again on the next check.
+func (m *Monitor) Check(ctx context.Context, t Target) (*Change, error) {
+	cur, err := m.fetch(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	prev, err := m.Snapshot(t.name())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if prev == nil {
+		if err := m.save(cur); err != nil {
+			return nil, err
+		}
+		m.l.Info("%s: initial snapshot %s saved", cur.Name, cur.Fingerprint[:12])
+		return nil, nil
+	}
+
+	if prev.Fingerprint == cur.Fingerprint {
+		m.l.Debug("%s: not changed", cur.Name)
+		return nil, m.save(cur)
+	}
+
+	ch := &Change{
+		Target: t,
+		Prev:   prev,
+		Cur:    cur,
+		Diff:   util.Diff(prev.Content, cur.Content),
+	}
+	if err := m.notify(ctx, ch); err != nil {
+		return ch, err
+	}
+
+	return ch, m.save(cur)
+}
+
+// fetch fetches a target and makes its snapshot
+func (m *Monitor) fetch(ctx context.Context, t Target) (*Snapshot, error) {
+	doc, err := m.cli.GetQueryDoc(ctx, t.URL, nil, t.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	sel := doc.Find("body")
+	if t.Selector != "" {
+		sel = doc.Find(t.Selector)
+	}
+	if sel.Length() == 0 {
+		return nil, fmt.Errorf("selector %q matches nothing at %s", t.Selector, t.URL)
+	}
+
+	if t.Ignore != "" {
+		sel.Find(t.Ignore).Remove()
+	}
+
+	content := RegionText(sel)
+
+	return &Snapshot{
+		Name:        t.name(),
+		URL:         t.URL,
+		Selector:    t.Selector,
+		Time:        time.Now(),
+		Fingerprint: Fingerprint(content),
+		Content:     content,
+	}, nil
+}
+
+// notify calls notifiers. All the notifiers are called even if some of them fail.
+func (m *Monitor) notify(ctx context.Context, ch *Change) error {
+	m.mux.Lock()
+	notifiers := append([]Notifier(nil), m.notifiers...)
+	m.mux.Unlock()
+
+	var errs []string
+	for _, n := range notifiers {
+		if err := n.Notify(ctx, ch); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("notification failed: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// Fingerprint returns a fingerprint of a normalized content
+func Fingerprint(content string) string {
+	h := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(h[:])
+}
+
+// snapshotPrefixLen is a maximum length of a readable prefix of snapshot file names
+const snapshotPrefixLen = 48
+
+// snapshotPath returns path of a target's snapshot file.
+//
+// File names are made of a readable prefix of the target name and a hash of the whole name,
+// so names which differ only by special characters or after the prefix don't collide.
+func (m *Monitor) snapshotPath(name string) string {
+	var prefix strings.Builder
+	for _, r := range name {
+		if prefix.Len() >= snapshotPrefixLen {
+			break
+		}
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			prefix.WriteRune(r)
+		default:
+			prefix.WriteRune('_')
+		}
+	}
+
+	h := sha256.Sum256([]byte(name))
+
+	return filepath.Join(m.dir, prefix.String()+"-"+hex.EncodeToString(h[:8])+".json")
+}
+
+// Snapshot loads the last snapshot of a target
+func (m *Monitor) Snapshot(name string) (*Snapshot, error) {
+	b, err := ioutil.ReadFile(m.snapshotPath(name))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot of %s: %v", name, err)
+	}
+
+	return s, nil
+}
+
+// save writes a snapshot to disk
+func (m *Monitor) save(s *Snapshot) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write a temporary file first, so an interrupted write doesn't corrupt the previous snapshot
+	fPath := m.snapshotPath(s.Name)
+	if err := ioutil.WriteFile(fPath+".tmp", b, 0644); err != nil {
+		return fmt.Errorf("failed to write snapshot of %s: %v", s.Name, err)
+	}
+	if err := os.Rename(fPath+".tmp", fPath); err != nil {
+		return fmt.Errorf("failed to write snapshot of %s: %v", s.Name, err)
+	}
+
+	return nil
+}
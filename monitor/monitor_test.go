@@ -0,0 +1,148 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/ashep/aghpu/httpclient"
+	"github.com/ashep/aghpu/logger"
+)
+
+// newTestMonitor creates a monitor keeping snapshots in a temporary directory
+func newTestMonitor(t *testing.T) *Monitor {
+	t.Helper()
+
+	l, err := logger.New("test", logger.LvDisabled, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli, err := httpclient.New("test", "", "", "", false, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.SetMaxRetries(1)
+
+	dir, err := ioutil.TempDir("", "aghpu-monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	m, err := New(cli, dir, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func TestCheckNotifyFailure(t *testing.T) {
+	var content atomic.Value
+	content.Store("one")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<html><body><p>" + content.Load().(string) + "</p></body></html>"))
+	}))
+	defer srv.Close()
+
+	m := newTestMonitor(t)
+	var fail int32 = 1
+	var notified int32
+	m.AddNotifier(NotifierFunc(func(ctx context.Context, ch *Change) error {
+		atomic.AddInt32(&notified, 1)
+		if atomic.LoadInt32(&fail) == 1 {
+			return errors.New("smtp is down")
+		}
+		return nil
+	}))
+
+	tg := Target{Name: "page", URL: srv.URL}
+	if ch, err := m.Check(context.Background(), tg); ch != nil || err != nil {
+		t.Fatalf("initial check: got %v, %v", ch, err)
+	}
+
+	content.Store("two")
+	ch, err := m.Check(context.Background(), tg)
+	if ch == nil || err == nil || !strings.Contains(err.Error(), "smtp is down") {
+		t.Fatalf("got %v, %v", ch, err)
+	}
+	if s, err := m.Snapshot("page"); err != nil || s.Content != "one" {
+		t.Fatalf("snapshot is updated after failed notification: %v, %v", s, err)
+	}
+
+	// The change is notified again
+	atomic.StoreInt32(&fail, 0)
+	ch, err = m.Check(context.Background(), tg)
+	if ch == nil || err != nil {
+		t.Fatalf("got %v, %v", ch, err)
+	}
+	if n := atomic.LoadInt32(&notified); n != 2 {
+		t.Errorf("notified %d times, want 2", n)
+	}
+	if s, err := m.Snapshot("page"); err != nil || s.Content != "two" {
+		t.Fatalf("snapshot is not updated: %v, %v", s, err)
+	}
+
+	if ch, err := m.Check(context.Background(), tg); ch != nil || err != nil {
+		t.Fatalf("got %v, %v", ch, err)
+	}
+}
+
+func TestSnapshotPath(t *testing.T) {
+	m := newTestMonitor(t)
+
+	long := strings.Repeat("x", 300)
+	names := []string{
+		"https://example.com/?q=1",
+		"https://example.com/?q=2",
+		"a b",
+		"a_b",
+		"a?b",
+		long + "1",
+		long + "2",
+		"страница",
+	}
+
+	seen := make(map[string]string)
+	for _, name := range names {
+		p := m.snapshotPath(name)
+		base := filepath.Base(p)
+		if len(base) > 255 {
+			t.Errorf("file name of %q is too long: %d", name, len(base))
+		}
+		if strings.ContainsAny(base, `?*:/\ `) {
+			t.Errorf("file name of %q has special characters: %s", name, base)
+		}
+		if prev, ok := seen[p]; ok {
+			t.Errorf("file names of %q and %q collide: %s", prev, name, base)
+		}
+		seen[p] = name
+	}
+
+	if !strings.HasPrefix(filepath.Base(m.snapshotPath("https://example.com/?q=1")), "https___example.com__q_1-") {
+		t.Errorf("file name has no readable prefix: %s", m.snapshotPath("https://example.com/?q=1"))
+	}
+}
+
+func TestRegionText(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(
+		"<div><h1>Title\n  of page</h1><p>one\ntwo<br>three</p><script>x()</script><span>a</span> <span>b</span></div>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := RegionText(doc.Find("div")), "Title of page\none two\nthree\na b"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,74 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+
+	"github.com/ashep/aghpu/logger"
+	"github.com/ashep/aghpu/mail"
+)
+
+// Notifier notifies about target changes
+type Notifier interface {
+	Notify(ctx context.Context, ch *Change) error
+}
+
+// NotifierFunc is a function notifier
+type NotifierFunc func(ctx context.Context, ch *Change) error
+
+// Notify implements Notifier
+func (f NotifierFunc) Notify(ctx context.Context, ch *Change) error {
+	return f(ctx, ch)
+}
+
+// LogNotifier writes changes to a log
+type LogNotifier struct {
+	l *logger.Logger
+}
+
+// NewLogNotifier creates a new log notifier
+func NewLogNotifier(l *logger.Logger) *LogNotifier {
+	return &LogNotifier{l: l}
+}
+
+// Notify implements Notifier
+func (n *LogNotifier) Notify(_ context.Context, ch *Change) error {
+	n.l.Info("%s", ch.Text())
+	return nil
+}
+
+// MailNotifier sends changes by email
+type MailNotifier struct {
+	addr    string
+	auth    smtp.Auth
+	from    string
+	to      []string
+	subject string
+}
+
+// NewMailNotifier creates a new mail notifier sending messages through the SMTP server at addr.
+// Subject is prepended to the target name in message subjects.
+func NewMailNotifier(addr string, auth smtp.Auth, from string, to []string, subject string) (*MailNotifier, error) {
+	if len(to) == 0 {
+		return nil, errors.New("no recipients")
+	}
+
+	return &MailNotifier{
+		addr:    addr,
+		auth:    auth,
+		from:    from,
+		to:      to,
+		subject: subject,
+	}, nil
+}
+
+// Notify implements Notifier
+func (n *MailNotifier) Notify(_ context.Context, ch *Change) error {
+	subj := ch.Target.name() + " has changed"
+	if n.subject != "" {
+		subj = n.subject + " " + subj
+	}
+
+	return mail.Send(n.addr, n.auth, mail.NewMessage(n.from, n.to, subj, ch.Text()))
+}
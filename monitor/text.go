@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+
+	"github.com/ashep/aghpu/util"
+)
+
+// blockElements are elements which start a new line of a region text
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true, "dd": true, "div": true,
+	"dl": true, "dt": true, "fieldset": true, "figcaption": true, "figure": true, "footer": true, "form": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true,
+	"li": true, "main": true, "nav": true, "ol": true, "option": true, "p": true, "pre": true, "section": true,
+	"table": true, "td": true, "th": true, "tr": true, "ul": true,
+}
+
+// skippedElements are elements which content is not a part of a region text
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true, "iframe": true,
+}
+
+// RegionText returns a normalized text of a selection.
+//
+// Every block element starts a new line, lines are cleaned with util.CollapseSpace and empty lines are dropped,
+// so the result doesn't depend on the markup formatting.
+func RegionText(sel *goquery.Selection) string {
+	var (
+		lines []string
+		cur   strings.Builder
+	)
+
+	flush := func() {
+		if s := util.CollapseSpace(cur.String()); s != "" {
+			lines = append(lines, s)
+		}
+		cur.Reset()
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			cur.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if skippedElements[n.Data] {
+				return
+			}
+		}
+
+		block := n.Type == html.ElementNode && blockElements[n.Data]
+		if block {
+			flush()
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if block {
+			flush()
+		}
+	}
+
+	for _, n := range sel.Nodes {
+		walk(n)
+		flush()
+	}
+
+	return strings.Join(lines, "\n")
+}
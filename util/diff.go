@@ -0,0 +1,272 @@
+package util
+
+import (
+	"strings"
+)
+
+// DiffOp is a line diff operation
+type DiffOp int
+
+const (
+	DiffEqual  DiffOp = iota // line is present in both texts
+	DiffDelete               // line is present in the first text only
+	DiffInsert               // line is present in the second text only
+)
+
+// DiffLine is a line of a diff
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+// Diff returns line diff of two texts
+func Diff(a, b string) []DiffLine {
+	return DiffLines(splitLines(a), splitLines(b))
+}
+
+// splitLines splits a text into lines
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffMaxD is a maximum edit distance searched within a region of texts.
+// More different regions are diffed as deleted and inserted entirely, which keeps time linear for unrelated texts.
+const diffMaxD = 1024
+
+// DiffLines returns diff of two line sequences using linear space Myers' algorithm
+func DiffLines(a, b []string) []DiffLine {
+	// Lines are compared as numbers
+	ids := make(map[string]int)
+	intern := func(lines []string) []int {
+		r := make([]int, len(lines))
+		for i, s := range lines {
+			id, ok := ids[s]
+			if !ok {
+				id = len(ids)
+				ids[s] = id
+			}
+			r[i] = id
+		}
+		return r
+	}
+
+	df := &differ{a: a, b: b, r: make([]DiffLine, 0, len(a)+len(b))}
+	df.diff(intern(a), intern(b), 0, 0)
+
+	return df.r
+}
+
+// differ builds a diff of two line sequences
+type differ struct {
+	a, b []string
+	r    []DiffLine
+}
+
+// diff appends diff of line ID sequences a and b starting at lines aOff and bOff of the texts
+func (df *differ) diff(a, b []int, aOff, bOff int) {
+	// Common prefix and suffix are not worth searching
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	for i := 0; i < pre; i++ {
+		df.r = append(df.r, DiffLine{DiffEqual, df.a[aOff+i]})
+	}
+
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	maOff, mbOff := aOff+pre, bOff+pre
+	switch {
+	case len(ma) == 0:
+		df.insert(mbOff, len(mb))
+	case len(mb) == 0:
+		df.delete(maOff, len(ma))
+	default:
+		df.bisect(ma, mb, maOff, mbOff)
+	}
+
+	for i := len(a) - suf; i < len(a); i++ {
+		df.r = append(df.r, DiffLine{DiffEqual, df.a[aOff+i]})
+	}
+}
+
+// bisect finds the middle of the shortest edit path of a and b and diffs both halves
+func (df *differ) bisect(a, b []int, aOff, bOff int) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	vOff := maxD
+	vLen := 2*maxD + 2
+	v1 := make([]int, vLen)
+	v2 := make([]int, vLen)
+	for i := range v1 {
+		v1[i] = -1
+		v2[i] = -1
+	}
+	v1[vOff+1] = 0
+	v2[vOff+1] = 0
+
+	delta := n - m
+	// If the total number of lines is odd, the front path collides with the reverse one
+	front := delta%2 != 0
+
+	k1start, k1end, k2start, k2end := 0, 0, 0, 0
+	for d := 0; d < maxD && d < diffMaxD; d++ {
+		// Forward path
+		for k1 := -d + k1start; k1 <= d-k1end; k1 += 2 {
+			k1Off := vOff + k1
+			var x1 int
+			if k1 == -d || (k1 != d && v1[k1Off-1] < v1[k1Off+1]) {
+				x1 = v1[k1Off+1]
+			} else {
+				x1 = v1[k1Off-1] + 1
+			}
+			y1 := x1 - k1
+			for x1 < n && y1 < m && a[x1] == b[y1] {
+				x1++
+				y1++
+			}
+			v1[k1Off] = x1
+
+			switch {
+			case x1 > n:
+				// Ran off the right of the graph
+				k1end += 2
+			case y1 > m:
+				// Ran off the bottom of the graph
+				k1start += 2
+			case front:
+				if k2Off := vOff + delta - k1; k2Off >= 0 && k2Off < vLen && v2[k2Off] != -1 {
+					if x2 := n - v2[k2Off]; x1 >= x2 {
+						df.split(a, b, aOff, bOff, x1, y1)
+						return
+					}
+				}
+			}
+		}
+
+		// Reverse path
+		for k2 := -d + k2start; k2 <= d-k2end; k2 += 2 {
+			k2Off := vOff + k2
+			var x2 int
+			if k2 == -d || (k2 != d && v2[k2Off-1] < v2[k2Off+1]) {
+				x2 = v2[k2Off+1]
+			} else {
+				x2 = v2[k2Off-1] + 1
+			}
+			y2 := x2 - k2
+			for x2 < n && y2 < m && a[n-x2-1] == b[m-y2-1] {
+				x2++
+				y2++
+			}
+			v2[k2Off] = x2
+
+			switch {
+			case x2 > n:
+				k2end += 2
+			case y2 > m:
+				k2start += 2
+			case !front:
+				if k1Off := vOff + delta - k2; k1Off >= 0 && k1Off < vLen && v1[k1Off] != -1 {
+					x1 := v1[k1Off]
+					y1 := vOff + x1 - k1Off
+					if x2 = n - x2; x1 >= x2 {
+						df.split(a, b, aOff, bOff, x1, y1)
+						return
+					}
+				}
+			}
+		}
+	}
+
+	// Nothing in common or too different
+	df.delete(aOff, n)
+	df.insert(bOff, m)
+}
+
+// split diffs parts of a and b before and after a point
+func (df *differ) split(a, b []int, aOff, bOff, x, y int) {
+	df.diff(a[:x], b[:y], aOff, bOff)
+	df.diff(a[x:], b[y:], aOff+x, bOff+y)
+}
+
+// delete appends n deleted lines of the first text starting at line i
+func (df *differ) delete(i, n int) {
+	for _, s := range df.a[i : i+n] {
+		df.r = append(df.r, DiffLine{DiffDelete, s})
+	}
+}
+
+// insert appends n inserted lines of the second text starting at line i
+func (df *differ) insert(i, n int) {
+	for _, s := range df.b[i : i+n] {
+		df.r = append(df.r, DiffLine{DiffInsert, s})
+	}
+}
+
+// DiffChanged reports whether a diff contains changes
+func DiffChanged(d []DiffLine) bool {
+	for _, l := range d {
+		if l.Op != DiffEqual {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FormatDiff formats a diff prefixing lines with "- ", "+ " or "  ".
+//
+// Only ctx unchanged lines around changes are kept, skipped lines are replaced with "...". Negative ctx keeps all the lines.
+func FormatDiff(d []DiffLine, ctx int) string {
+	keep := make([]bool, len(d))
+	for i, l := range d {
+		if l.Op == DiffEqual && ctx >= 0 {
+			continue
+		}
+		from, to := i-ctx, i+ctx
+		if ctx < 0 {
+			from, to = i, i
+		}
+		for j := from; j <= to; j++ {
+			if j >= 0 && j < len(d) {
+				keep[j] = true
+			}
+		}
+	}
+
+	var (
+		buf     strings.Builder
+		skipped bool
+	)
+	for i, l := range d {
+		if !keep[i] {
+			if !skipped {
+				buf.WriteString("...\n")
+				skipped = true
+			}
+			continue
+		}
+		skipped = false
+
+		switch l.Op {
+		case DiffDelete:
+			buf.WriteString("- ")
+		case DiffInsert:
+			buf.WriteString("+ ")
+		default:
+			buf.WriteString("  ")
+		}
+		buf.WriteString(l.Text)
+		buf.WriteString("\n")
+	}
+
+	return buf.String()
+}
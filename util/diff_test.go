@@ -0,0 +1,142 @@
+package util
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// applyDiff returns both texts described by a diff
+func applyDiff(d []DiffLine) ([]string, []string) {
+	var a, b []string
+	for _, l := range d {
+		if l.Op != DiffInsert {
+			a = append(a, l.Text)
+		}
+		if l.Op != DiffDelete {
+			b = append(b, l.Text)
+		}
+	}
+
+	return a, b
+}
+
+// lcsLen returns length of the longest common subsequence of two line sequences
+func lcsLen(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestDiffLinesMinimal(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	gen := func() []string {
+		r := make([]string, rnd.Intn(30))
+		for i := range r {
+			r[i] = string(rune('a' + rnd.Intn(4)))
+		}
+		return r
+	}
+
+	for i := 0; i < 500; i++ {
+		a, b := gen(), gen()
+		d := DiffLines(a, b)
+
+		ra, rb := applyDiff(d)
+		if !equalLines(ra, a) || !equalLines(rb, b) {
+			t.Fatalf("diff of %q and %q doesn't reproduce them: %v", a, b, d)
+		}
+
+		eq := 0
+		for _, l := range d {
+			if l.Op == DiffEqual {
+				eq++
+			}
+		}
+		if want := lcsLen(a, b); eq != want {
+			t.Fatalf("diff of %q and %q has %d equal lines, want %d", a, b, eq, want)
+		}
+	}
+}
+
+func TestDiffLinesLarge(t *testing.T) {
+	const n = 8000
+
+	a := make([]string, n)
+	b := make([]string, n)
+	for i := range a {
+		a[i] = "a" + strconv.Itoa(i)
+		b[i] = "b" + strconv.Itoa(i)
+	}
+
+	start := time.Now()
+	d := DiffLines(a, b)
+	if el := time.Since(start); el > 2*time.Second {
+		t.Errorf("diff of unrelated texts took %s", el)
+	}
+	ra, rb := applyDiff(d)
+	if !equalLines(ra, a) || !equalLines(rb, b) {
+		t.Fatal("diff of unrelated texts doesn't reproduce them")
+	}
+
+	// A few changes within large texts are found exactly
+	c := append([]string(nil), a...)
+	c[100] = "changed"
+	c = append(c[:5000], c[5001:]...)
+	d = DiffLines(a, c)
+	var changes []DiffLine
+	for _, l := range d {
+		if l.Op != DiffEqual {
+			changes = append(changes, l)
+		}
+	}
+	if len(changes) != 3 {
+		t.Errorf("got changes %v, want 3", changes)
+	}
+}
+
+func TestFormatDiff(t *testing.T) {
+	d := Diff("1\n2\n3\n4\n5\n6\n7\n", "1\n2\n3\nx\n5\n6\n7\n")
+	if !DiffChanged(d) {
+		t.Fatal("diff is not changed")
+	}
+
+	if got, want := FormatDiff(d, 1), "...\n  3\n- 4\n+ x\n  5\n...\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := FormatDiff(d, -1), "  1\n  2\n  3\n- 4\n+ x\n  5\n  6\n  7\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if DiffChanged(Diff("a\nb\n", "a\nb\n")) {
+		t.Error("equal texts are changed")
+	}
+}
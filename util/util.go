@@ -29,6 +29,16 @@ func TidyHTMLText(s string) string {
 	return s
 }
 
+// spaceRe matches runs of whitespaces including non-breaking spaces
+var spaceRe = regexp.MustCompile(`[\s\x{00A0}]+`)
+
+// CollapseSpace replaces every run of whitespaces, line breaks included, with a single space and trims the result.
+//
+// Unlike TidyHTMLText it keeps words separated by a single line break apart.
+func CollapseSpace(s string) string {
+	return strings.Trim(spaceRe.ReplaceAllLiteralString(s, " "), " ")
+}
+
 // CombineURL combines two URLs
 func CombineURL(a string, b string, args url.Values) string {
 	aURL, err := url.Parse(a)
@@ -0,0 +1,42 @@
+package util
+
+import "testing"
+
+func TestTidyHTMLText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"  hello  ", "hello"},
+		{"one\ntwo", "onetwo"},
+		{"one\ttwo", "one\ttwo"},
+		{"one \n\n  two", "one two"},
+		{"non breaking", "non breaking"},
+	}
+
+	for _, tt := range tests {
+		if got := TidyHTMLText(tt.in); got != tt.want {
+			t.Errorf("TidyHTMLText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCollapseSpace(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"  hello  ", "hello"},
+		{"one\ntwo", "one two"},
+		{"one\r\ntwo\tthree", "one two three"},
+		{"one \n\n  two", "one two"},
+		{"non breaking", "non breaking"},
+		{" \n\t ", ""},
+	}
+
+	for _, tt := range tests {
+		if got := CollapseSpace(tt.in); got != tt.want {
+			t.Errorf("CollapseSpace(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}